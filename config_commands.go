@@ -0,0 +1,216 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+
+	"github.com/amankumarsingh77/automated_backup_tool/internal/config"
+	"github.com/amankumarsingh77/automated_backup_tool/internal/core/backup"
+	"github.com/amankumarsingh77/automated_backup_tool/internal/security/credentials"
+	"github.com/amankumarsingh77/automated_backup_tool/internal/security/secret"
+	"github.com/amankumarsingh77/automated_backup_tool/internal/utils"
+	"github.com/amankumarsingh77/automated_backup_tool/internal/utils/filesystem"
+)
+
+// loadConfig reads the file named by -config, or BACKUP_CONFIG, and applies
+// its global settings. It returns nil when no file is given and the command
+// does not need one.
+func loadConfig(required bool) *config.Config {
+	if configFile == "" {
+		if required {
+			log.Fatalf("A config file is required. Use -config flag or set %s", config.EnvConfigFile)
+		}
+		return nil
+	}
+
+	cfg, err := config.Load(configFile)
+	if err != nil {
+		var errs config.Errors
+		if errors.As(err, &errs) {
+			log.Fatalf("Invalid config file:\n%v", errs)
+		}
+		log.Fatal(err)
+	}
+
+	utils.SetLogDir(cfg.Settings.LogDir)
+	filesystem.SetTempDir(cfg.Settings.TempDir)
+	backup.GlobalTaskManager.SetConcurrency(cfg.Settings.Concurrency)
+	return cfg
+}
+
+func handleValidate(cfg *config.Config) {
+	fmt.Printf("%s is valid: %d remotes, %d tasks\n", cfg.File, len(cfg.Remotes), len(cfg.Tasks))
+}
+
+func handleApply(cfg *config.Config, args []string) {
+	applyCmd := flag.NewFlagSet("apply", flag.ExitOnError)
+	dryRun := applyCmd.Bool("dry-run", false, "Show what would change without changing anything")
+	applyCmd.Parse(args)
+
+	credManager, err := credentials.NewCredentialManager(masterPassword)
+	if err != nil {
+		log.Fatalf("Failed to initialize credential manager: %v", err)
+	}
+
+	for _, name := range cfg.RemoteNames() {
+		cred, err := declaredRemote(credManager, name, cfg.Remotes[name])
+		if err != nil {
+			log.Fatalf("Remote %s: %v", name, err)
+		}
+		if *dryRun {
+			fmt.Printf("Would store remote %s (%s)\n", name, cred.Provider)
+			continue
+		}
+		if err := credManager.StoreCredential(cred); err != nil {
+			log.Fatalf("Failed to store remote %s: %v", name, err)
+		}
+		fmt.Printf("Stored remote %s (%s)\n", name, cred.Provider)
+	}
+
+	declared := make([]backup.BackupTask, 0, len(cfg.Tasks))
+	for _, task := range cfg.Tasks {
+		t, err := declaredTask(cfg, credManager, task)
+		if err != nil {
+			log.Fatalf("%s:%d: task %s: %v", cfg.File, task.Line("name"), task.Name, err)
+		}
+		declared = append(declared, t)
+	}
+
+	result, err := backup.ApplyTasks(declared, *dryRun)
+	if err != nil {
+		log.Fatalf("Failed to apply tasks: %v", err)
+	}
+
+	printNames := func(done, planned string, names []string) {
+		if len(names) == 0 {
+			return
+		}
+		if *dryRun {
+			done = planned
+		}
+		fmt.Printf("%s: %s\n", done, strings.Join(names, ", "))
+	}
+	printNames("Created", "Would create", result.Created)
+	printNames("Updated", "Would update", result.Updated)
+	printNames("Deleted", "Would delete", result.Deleted)
+	if len(result.Unchanged) > 0 {
+		fmt.Printf("Unchanged: %s\n", strings.Join(result.Unchanged, ", "))
+	}
+}
+
+// declaredRemote turns a remote from the config file into a credential.
+// Without secret_source the secret configured earlier is kept, so secrets
+// can be entered once with configure and left out of the file.
+func declaredRemote(credManager *credentials.CredentialManager, name string, remote *config.Remote) (credentials.Credential, error) {
+	cred := credentials.Credential{
+		Name:        name,
+		Provider:    remote.Provider,
+		Key:         remote.Key,
+		RedirectURL: remote.RedirectURL,
+		Options:     remote.Options,
+	}
+
+	if remote.SecretSource != "" {
+		value, err := secret.Source(remote.SecretSource).Read(fmt.Sprintf("Secret for %s", name))
+		if err != nil {
+			return cred, fmt.Errorf("failed to read secret: %w", err)
+		}
+		cred.Secret = value
+	} else if old, err := credManager.GetCredential(name); err == nil && old.Provider == cred.Provider {
+		cred.Secret = old.Secret
+	}
+	return cred, nil
+}
+
+// declaredTask turns a task from the config file into a backup task.
+func declaredTask(cfg *config.Config, credManager *credentials.CredentialManager, task *config.Task) (backup.BackupTask, error) {
+	var err error
+	provider := ""
+	if task.Remote != "" {
+		if provider, err = remoteProvider(cfg, credManager, task.Remote); err != nil {
+			return backup.BackupTask{}, err
+		}
+	}
+
+	// The source of a cloud backup is a folder on the remote.
+	source := task.Source
+	if task.From != "" {
+		if _, err := remoteProvider(cfg, credManager, task.From); err != nil {
+			return backup.BackupTask{}, err
+		}
+	} else if source, err = configPath(cfg, source); err != nil {
+		return backup.BackupTask{}, err
+	}
+	mirror := task.Mirror
+	if mirror != "" {
+		if mirror, err = configPath(cfg, mirror); err != nil {
+			return backup.BackupTask{}, err
+		}
+	}
+
+	t := backup.BackupTask{
+		Name:                task.Name,
+		SourcePath:          source,
+		Provider:            provider,
+		Remote:              task.Remote,
+		DestinationPath:     task.Dest,
+		NameTemplate:        task.NameTemplate,
+		Repository:          config.Bool(task.Repository),
+		Mode:                task.Mode,
+		FullEvery:           task.FullEvery,
+		Schedule:            task.Schedule,
+		Recurring:           task.Schedule != "",
+		Compress:            config.Bool(task.Compress),
+		Encrypt:             config.Bool(task.Encrypt),
+		EncryptionKeySource: task.KeySource,
+		IsSingle:            config.Bool(task.Single),
+		IsSync:              config.Bool(task.Sync),
+		SourceRemote:        task.From,
+		MirrorPath:          mirror,
+		KeepDeleted:         task.KeepDeleted,
+	}
+	if r := task.Retention; r != nil {
+		t.Retention = &backup.RetentionPolicy{
+			KeepLast:    r.KeepLast,
+			KeepHourly:  r.KeepHourly,
+			KeepDaily:   r.KeepDaily,
+			KeepWeekly:  r.KeepWeekly,
+			KeepMonthly: r.KeepMonthly,
+			KeepYearly:  r.KeepYearly,
+			KeepWithin:  r.KeepWithin,
+		}
+	}
+	for _, target := range task.Notify {
+		t.NotifyURLs = append(t.NotifyURLs, cfg.Notifications[target].URL)
+	}
+	return t, nil
+}
+
+// remoteProvider returns the provider of a remote declared in the config
+// file or configured before.
+func remoteProvider(cfg *config.Config, credManager *credentials.CredentialManager, name string) (string, error) {
+	if remote, ok := cfg.Remotes[name]; ok {
+		return remote.Provider, nil
+	}
+	if cred, err := credManager.GetCredential(name); err == nil {
+		return cred.Provider, nil
+	}
+	return "", fmt.Errorf("remote %s is neither declared nor configured", name)
+}
+
+// configPath makes a local path absolute. Relative paths are relative to
+// the config file, not to where apply happens to run.
+func configPath(cfg *config.Config, p string) (string, error) {
+	if !filepath.IsAbs(p) {
+		p = filepath.Join(filepath.Dir(cfg.File), p)
+	}
+	p, err := filepath.Abs(p)
+	if err != nil {
+		return "", fmt.Errorf("error getting absolute path: %w", err)
+	}
+	return p, nil
+}
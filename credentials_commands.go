@@ -0,0 +1,280 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/amankumarsingh77/automated_backup_tool/internal/core/backup"
+	"github.com/amankumarsingh77/automated_backup_tool/internal/security/credentials"
+	"github.com/amankumarsingh77/automated_backup_tool/internal/security/secret"
+	"github.com/amankumarsingh77/automated_backup_tool/internal/storage"
+	"github.com/amankumarsingh77/automated_backup_tool/internal/storage/oauthutil"
+)
+
+// credentialTestTimeout bounds how long credentials test waits for a remote.
+const credentialTestTimeout = time.Minute
+
+func handleCredentials(args []string) {
+	if len(args) < 1 {
+		printUsage()
+		os.Exit(1)
+	}
+
+	credManager, err := credentials.NewCredentialManager(masterPassword)
+	if err != nil {
+		log.Fatalf("Failed to initialize credential manager: %v", err)
+	}
+
+	switch args[0] {
+	case "list":
+		handleCredentialsList(credManager)
+	case "show":
+		if len(args) != 2 {
+			log.Fatal("Usage: credentials show <remote>")
+		}
+		handleCredentialsShow(credManager, args[1])
+	case "remove":
+		removeCmd := flag.NewFlagSet("credentials remove", flag.ExitOnError)
+		force := removeCmd.Bool("force", false, "Remove the remote even if backup tasks still use it")
+		removeCmd.Parse(args[1:])
+		if removeCmd.NArg() != 1 {
+			log.Fatal("Usage: credentials remove [-force] <remote>")
+		}
+		handleCredentialsRemove(credManager, removeCmd.Arg(0), *force)
+	case "export":
+		exportCmd := flag.NewFlagSet("credentials export", flag.ExitOnError)
+		out := exportCmd.String("out", "", "File to write the encrypted export to")
+		passwordSource := exportCmd.String("password-source", "", "Where to read the export password (default: ask twice)")
+		exportCmd.Parse(args[1:])
+		handleCredentialsExport(credManager, *out, *passwordSource, exportCmd.Args())
+	case "import":
+		importCmd := flag.NewFlagSet("credentials import", flag.ExitOnError)
+		in := importCmd.String("in", "", "Export file to import")
+		passwordSource := importCmd.String("password-source", "", "Where to read the export password (default: ask)")
+		overwrite := importCmd.Bool("overwrite", false, "Replace remotes that are already configured")
+		importCmd.Parse(args[1:])
+		handleCredentialsImport(credManager, *in, *passwordSource, *overwrite)
+	case "test":
+		handleCredentialsTest(credManager, args[1:])
+	default:
+		printUsage()
+		os.Exit(1)
+	}
+}
+
+func handleCredentialsList(credManager *credentials.CredentialManager) {
+	creds, err := credManager.ListCredentials()
+	if err != nil {
+		log.Fatalf("Failed to list credentials: %v", err)
+	}
+	if len(creds) == 0 {
+		fmt.Println("No remotes configured")
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tPROVIDER\tKEY\tSECRET\tTOKEN")
+	for _, cred := range creds {
+		masked := cred.Masked()
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", cred.Name, cred.Provider, orDash(masked.Key), orDash(masked.Secret), tokenStatus(cred))
+	}
+	w.Flush()
+}
+
+func handleCredentialsShow(credManager *credentials.CredentialManager, name string) {
+	cred, err := credManager.GetCredential(name)
+	if err != nil {
+		log.Fatalf("Failed to get credentials: %v", err)
+	}
+	masked := cred.Masked()
+
+	fmt.Printf("Name: %s\n", masked.Name)
+	fmt.Printf("Provider: %s\n", masked.Provider)
+	if masked.Key != "" {
+		fmt.Printf("Key: %s\n", masked.Key)
+	}
+	if masked.Secret != "" {
+		fmt.Printf("Secret: %s\n", masked.Secret)
+	}
+	if masked.RedirectURL != "" {
+		fmt.Printf("Redirect URL: %s\n", masked.RedirectURL)
+	}
+	keys := make([]string, 0, len(masked.Options))
+	for key := range masked.Options {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Printf("Option %s: %s\n", key, masked.Options[key])
+	}
+	fmt.Printf("Token: %s\n", tokenStatus(*cred))
+}
+
+func handleCredentialsRemove(credManager *credentials.CredentialManager, name string, force bool) {
+	if _, err := credManager.GetCredential(name); err != nil {
+		log.Fatalf("Failed to get credentials: %v", err)
+	}
+
+	tasks, err := backup.ListTasks()
+	if err != nil {
+		log.Fatalf("Failed to list tasks: %v", err)
+	}
+	var users []string
+	for _, task := range tasks {
+		if task.RemoteName() == name || task.SourceRemote == name {
+			users = append(users, task.ID)
+		}
+	}
+	if len(users) > 0 && !force {
+		log.Fatalf("Remote %s is used by backup tasks %s. Use -force to remove it anyway", name, strings.Join(users, ", "))
+	}
+
+	if err := credManager.DeleteCredential(name); err != nil {
+		log.Fatalf("Failed to remove credentials: %v", err)
+	}
+	fmt.Printf("Removed remote %s\n", name)
+}
+
+func handleCredentialsExport(credManager *credentials.CredentialManager, out, passwordSource string, names []string) {
+	if out == "" {
+		log.Fatal("Output file is required. Use -out flag")
+	}
+
+	password, err := readExportPassword(passwordSource, true)
+	if err != nil {
+		log.Fatalf("Failed to read export password: %v", err)
+	}
+	data, err := credManager.Export(password, names...)
+	if err != nil {
+		log.Fatalf("Failed to export credentials: %v", err)
+	}
+	if err := os.WriteFile(out, data, 0600); err != nil {
+		log.Fatalf("Failed to write export: %v", err)
+	}
+	fmt.Printf("Exported credentials to %s. The export includes OAuth tokens, keep it safe.\n", out)
+}
+
+func handleCredentialsImport(credManager *credentials.CredentialManager, in, passwordSource string, overwrite bool) {
+	if in == "" {
+		log.Fatal("Input file is required. Use -in flag")
+	}
+	data, err := os.ReadFile(in)
+	if err != nil {
+		log.Fatalf("Failed to read export: %v", err)
+	}
+
+	password, err := readExportPassword(passwordSource, false)
+	if err != nil {
+		log.Fatalf("Failed to read export password: %v", err)
+	}
+	imported, skipped, err := credManager.Import(data, password, overwrite)
+	if err != nil {
+		log.Fatalf("Failed to import credentials: %v", err)
+	}
+	for _, name := range imported {
+		fmt.Printf("Imported remote %s\n", name)
+	}
+	for _, name := range skipped {
+		fmt.Printf("Skipped remote %s, it is already configured. Use -overwrite to replace it\n", name)
+	}
+}
+
+// handleCredentialsTest connects to the named remotes, or to all of them,
+// with the stored configuration. It never starts a new OAuth login, so an
+// expired token is reported instead of hidden.
+func handleCredentialsTest(credManager *credentials.CredentialManager, names []string) {
+	if len(names) == 0 {
+		creds, err := credManager.ListCredentials()
+		if err != nil {
+			log.Fatalf("Failed to list credentials: %v", err)
+		}
+		for _, cred := range creds {
+			names = append(names, cred.Name)
+		}
+	}
+
+	failed := false
+	for _, name := range names {
+		if err := testRemote(credManager, name); err != nil {
+			fmt.Printf("%s: FAILED: %v\n", name, err)
+			failed = true
+			continue
+		}
+		fmt.Printf("%s: ok\n", name)
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func testRemote(credManager *credentials.CredentialManager, name string) error {
+	cred, err := credManager.GetCredential(name)
+	if err != nil {
+		return err
+	}
+	provider, err := storage.New(cred.Provider, storage.Config{
+		Name:       name,
+		Credential: cred,
+		Tokens:     credManager.TokenStore(name),
+	})
+	if err != nil {
+		return err
+	}
+	if closer, ok := provider.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	ctx, cancel := context.WithTimeout(oauthutil.WithoutLogin(context.Background()), credentialTestTimeout)
+	defer cancel()
+	return provider.Authenticate(ctx)
+}
+
+// readExportPassword reads the password protecting an export. Without a
+// source it is asked for on the terminal, twice when confirm is set.
+func readExportPassword(source string, confirm bool) (string, error) {
+	if source != "" {
+		return secret.Source(source).Read("Export password")
+	}
+	password, err := secret.ReadPrompt("Export password")
+	if err != nil || !confirm {
+		return password, err
+	}
+	repeated, err := secret.ReadPrompt("Repeat export password")
+	if err != nil {
+		return "", err
+	}
+	if repeated != password {
+		return "", errors.New("passwords do not match")
+	}
+	return password, nil
+}
+
+func tokenStatus(cred credentials.Credential) string {
+	switch {
+	case cred.Token == nil:
+		return "-"
+	case cred.Token.RefreshToken != "":
+		return "saved"
+	case cred.Token.Expiry.IsZero():
+		return "saved, no expiry"
+	case time.Now().After(cred.Token.Expiry):
+		return "expired"
+	}
+	return "expires " + cred.Token.Expiry.Format(time.RFC3339)
+}
+
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
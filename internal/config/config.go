@@ -1,45 +1,303 @@
+// Package config reads the declarative configuration file that describes
+// remotes, backup tasks and global settings, so a backup setup can be kept
+// in version control and applied with one command.
 package config
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
 
-	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
 )
 
-type GoogleDriveConfig struct {
-	ClientID                   string `yaml:"client_id"`
-	ClientSecret               string `yaml:"client_secret"`
-	GOOGLE_CLIENT_REDIRECT_URL string `yaml:"google_client_redirect_url"`
+// EnvConfigFile names the configuration file when no -config flag is given.
+const EnvConfigFile = "BACKUP_CONFIG"
+
+// Config is the root of the configuration file.
+type Config struct {
+	Settings      Settings                `yaml:"settings"`
+	Remotes       map[string]*Remote      `yaml:"remotes"`
+	Notifications map[string]Notification `yaml:"notifications"`
+	Profiles      map[string]*Task        `yaml:"profiles"`
+	Tasks         []*Task                 `yaml:"tasks"`
+
+	// File is the path the configuration was read from.
+	File string `yaml:"-"`
 }
 
-type OneDriveConfig struct {
-	ClientID                     string `yaml:"client_id"`
-	ONEDRIVE_CLIENT_REDIRECT_URL string `yaml:"onedrive_client_redirect_url"`
+// Settings are global settings for every command.
+type Settings struct {
+	LogDir  string `yaml:"log_dir"`
+	TempDir string `yaml:"temp_dir"`
+	// Concurrency limits how many backup tasks run at the same time. Zero
+	// means no limit.
+	Concurrency int `yaml:"concurrency"`
+
+	pos position
 }
 
-type Config struct {
-	Providers struct {
-		GoogleDrive GoogleDriveConfig
-		OneDrive    OneDriveConfig
-	}
-}
-
-func LoadConfig() *Config {
-	godotenv.Load()
-	return &Config{
-		Providers: struct {
-			GoogleDrive GoogleDriveConfig
-			OneDrive    OneDriveConfig
-		}{
-			GoogleDrive: GoogleDriveConfig{
-				ClientID:                   os.Getenv("GOOGLE_CLIENT_ID"),
-				ClientSecret:               os.Getenv("GOOGLE_CLIENT_SECRET"),
-				GOOGLE_CLIENT_REDIRECT_URL: os.Getenv("GOOGLE_CLIENT_REDIRECT_URL"),
-			},
-			OneDrive: OneDriveConfig{
-				ClientID:                     os.Getenv("ONEDRIVE_CLIENT_ID"),
-				ONEDRIVE_CLIENT_REDIRECT_URL: os.Getenv("ONEDRIVE_CLIENT_REDIRECT_URL"),
-			},
-		},
+// Remote declares a remote like the configure command does. The secret is
+// never written into the file, only where to read it from.
+type Remote struct {
+	Provider     string            `yaml:"provider"`
+	Key          string            `yaml:"key"`
+	SecretSource string            `yaml:"secret_source"`
+	RedirectURL  string            `yaml:"redirect_url"`
+	Options      map[string]string `yaml:"options"`
+
+	pos position
+}
+
+// Notification is a target told about the outcome of every run.
+type Notification struct {
+	// Type is the kind of target. Only "webhook" is supported, which gets
+	// a JSON POST request.
+	Type string `yaml:"type"`
+	URL  string `yaml:"url"`
+
+	pos position
+}
+
+// Task declares a backup task. Tasks are matched to the task store by
+// name. A profile holds defaults for the tasks that name it; fields set on
+// the task win.
+type Task struct {
+	Name      string     `yaml:"name"`
+	Profile   string     `yaml:"profile"`
+	Source    string     `yaml:"source"`
+	Remote    string     `yaml:"remote"`
+	Dest      string     `yaml:"dest"`
+	Schedule  string     `yaml:"schedule"`
+	Compress  *bool      `yaml:"compress"`
+	Encrypt   *bool      `yaml:"encrypt"`
+	KeySource string     `yaml:"key_source"`
+	Single    *bool      `yaml:"single"`
+	Sync      *bool      `yaml:"sync"`
+	Retention *Retention `yaml:"retention"`
+	Notify    []string   `yaml:"notify"`
+	// From names a cloud remote to back up from; Source is then a folder
+	// on it. Its copy is kept in Mirror, which is enough of a backup
+	// without a Remote.
+	From        string `yaml:"from"`
+	Mirror      string `yaml:"mirror"`
+	KeepDeleted string `yaml:"keep_deleted"`
+	// NameTemplate names the archive of each run below Dest, see the
+	// naming package. Without one every run replaces the previous archive.
+	NameTemplate string `yaml:"name_template"`
+	// Repository stores the runs deduplicated in a repository at Dest
+	// instead of uploading an archive each time.
+	Repository *bool `yaml:"repository"`
+	// Mode is full, incremental or differential; FullEvery forces a full
+	// backup every so many runs of an incremental or differential task.
+	Mode      string `yaml:"mode"`
+	FullEvery int    `yaml:"full_every"`
+
+	pos position
+}
+
+// Retention declares which snapshots of a task are kept.
+type Retention struct {
+	KeepLast    int    `yaml:"keep_last"`
+	KeepHourly  int    `yaml:"keep_hourly"`
+	KeepDaily   int    `yaml:"keep_daily"`
+	KeepWeekly  int    `yaml:"keep_weekly"`
+	KeepMonthly int    `yaml:"keep_monthly"`
+	KeepYearly  int    `yaml:"keep_yearly"`
+	KeepWithin  string `yaml:"keep_within"`
+
+	pos position
+}
+
+// Bool returns the value of an optional flag, false when it is not set.
+func Bool(b *bool) bool {
+	return b != nil && *b
+}
+
+// DefaultFile returns the configuration file to use when no -config flag
+// is given: the file named by BACKUP_CONFIG, or the empty string.
+func DefaultFile() string {
+	return os.Getenv(EnvConfigFile)
+}
+
+// Load reads and validates the configuration file at path. Profiles are
+// applied to the tasks that use them.
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	cfg, err := Parse(data)
+	if err != nil {
+		return nil, prefixFile(path, err)
+	}
+	cfg.File = path
+	return cfg, nil
+}
+
+// Parse decodes and validates a configuration.
+func Parse(data []byte) (*Config, error) {
+	cfg := &Config{}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return nil, yamlError(err)
+	}
+
+	cfg.applyProfiles()
+	if errs := cfg.Validate(); len(errs) > 0 {
+		return nil, errs
+	}
+	return cfg, nil
+}
+
+// Task returns the task called name.
+func (c *Config) Task(name string) (*Task, bool) {
+	for _, task := range c.Tasks {
+		if task.Name == name {
+			return task, true
+		}
+	}
+	return nil, false
+}
+
+// RemoteNames returns the names of the declared remotes, sorted.
+func (c *Config) RemoteNames() []string {
+	names := make([]string, 0, len(c.Remotes))
+	for name := range c.Remotes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// applyProfiles fills the fields a task leaves unset from its profile.
+func (c *Config) applyProfiles() {
+	for _, task := range c.Tasks {
+		profile, ok := c.Profiles[task.Profile]
+		if !ok || profile == nil {
+			continue
+		}
+		task.merge(profile)
+	}
+}
+
+func (t *Task) merge(defaults *Task) {
+	target := reflect.ValueOf(t).Elem()
+	source := reflect.ValueOf(defaults).Elem()
+	for i := 0; i < target.NumField(); i++ {
+		field := target.Field(i)
+		if !field.CanSet() || target.Type().Field(i).Name == "Name" || !field.IsZero() {
+			continue
+		}
+		field.Set(source.Field(i))
+	}
+}
+
+// Line returns the line a field of the task is set on, or the line of the
+// task itself.
+func (t *Task) Line(field string) int {
+	return t.pos.at(field)
+}
+
+// Line returns the line a field of the remote is set on, or the line of
+// the remote itself.
+func (r *Remote) Line(field string) int {
+	return r.pos.at(field)
+}
+
+func (s *Settings) UnmarshalYAML(node *yaml.Node) error {
+	type plain Settings
+	return decodeStrict(node, (*plain)(s), &s.pos)
+}
+
+func (r *Remote) UnmarshalYAML(node *yaml.Node) error {
+	type plain Remote
+	return decodeStrict(node, (*plain)(r), &r.pos)
+}
+
+func (n *Notification) UnmarshalYAML(node *yaml.Node) error {
+	type plain Notification
+	return decodeStrict(node, (*plain)(n), &n.pos)
+}
+
+func (t *Task) UnmarshalYAML(node *yaml.Node) error {
+	type plain Task
+	return decodeStrict(node, (*plain)(t), &t.pos)
+}
+
+func (r *Retention) UnmarshalYAML(node *yaml.Node) error {
+	type plain Retention
+	return decodeStrict(node, (*plain)(r), &r.pos)
+}
+
+// position remembers where a mapping and each of its keys appear in the
+// file, so validation errors can point at the offending line.
+type position struct {
+	line   int
+	fields map[string]int
+}
+
+func (p position) at(field string) int {
+	if line, ok := p.fields[field]; ok {
+		return line
+	}
+	return p.line
+}
+
+// decodeStrict decodes a mapping into v, recording positions in pos. A
+// custom unmarshaler does not inherit the decoder's KnownFields setting, so
+// unknown keys are rejected here.
+func decodeStrict(node *yaml.Node, v any, pos *position) error {
+	if node.Kind != yaml.MappingNode {
+		return &Error{Line: node.Line, Msg: "expected a mapping"}
+	}
+
+	known := yamlKeys(reflect.TypeOf(v).Elem())
+	pos.line = node.Line
+	pos.fields = make(map[string]int)
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key := node.Content[i]
+		if !known[key.Value] {
+			return &Error{Line: key.Line, Msg: fmt.Sprintf("unknown field %q", key.Value)}
+		}
+		pos.fields[key.Value] = key.Line
+	}
+	if err := node.Decode(v); err != nil {
+		return yamlError(err)
+	}
+	return nil
+}
+
+func yamlKeys(t reflect.Type) map[string]bool {
+	keys := make(map[string]bool)
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("yaml"), ",")
+		if name != "" && name != "-" {
+			keys[name] = true
+		}
+	}
+	return keys
+}
+
+func prefixFile(path string, err error) error {
+	var errs Errors
+	if errors.As(err, &errs) {
+		for i := range errs {
+			errs[i].File = path
+		}
+		return errs
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		e.File = path
+		return e
 	}
+	return fmt.Errorf("%s: %w", filepath.Clean(path), err)
 }
@@ -0,0 +1,207 @@
+package config
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	_ "github.com/amankumarsingh77/automated_backup_tool/internal/storage/local"
+)
+
+const validConfig = `
+settings:
+  log_dir: /var/log/backup
+  concurrency: 2
+
+remotes:
+  nas:
+    provider: local
+    options:
+      root: /mnt/nas
+
+notifications:
+  ops:
+    type: webhook
+    url: https://hooks.example.com/backup
+
+profiles:
+  nightly:
+    remote: nas
+    schedule: "0 2 * * *"
+    compress: true
+    retention:
+      keep_daily: 7
+      keep_within: 30d
+    notify: [ops]
+
+tasks:
+  - name: documents
+    profile: nightly
+    source: /home/alice/Documents
+    dest: /documents
+    name_template: "{task}/{date}-{host}.tar.gz"
+    mode: incremental
+    full_every: 7
+  - name: photos
+    profile: nightly
+    source: /home/alice/Pictures
+    dest: /photos
+    compress: false
+    schedule: "0 3 * * 0"
+  - name: shared
+    from: gdrive
+    source: /Shared
+    mirror: /srv/mirror/shared
+    keep_deleted: 90d
+`
+
+func TestParse(t *testing.T) {
+	cfg, err := Parse([]byte(validConfig))
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+
+	if cfg.Settings.Concurrency != 2 || cfg.Settings.LogDir != "/var/log/backup" {
+		t.Errorf("Unexpected settings: %+v", cfg.Settings)
+	}
+	if remote := cfg.Remotes["nas"]; remote == nil || remote.Provider != "local" || remote.Options["root"] != "/mnt/nas" {
+		t.Errorf("Unexpected remote: %+v", remote)
+	}
+
+	documents, ok := cfg.Task("documents")
+	if !ok {
+		t.Fatal("Task documents not found")
+	}
+	if documents.Remote != "nas" || documents.Schedule != "0 2 * * *" || !Bool(documents.Compress) {
+		t.Errorf("Profile not applied: %+v", documents)
+	}
+	if documents.NameTemplate != "{task}/{date}-{host}.tar.gz" {
+		t.Errorf("Unexpected name template %q", documents.NameTemplate)
+	}
+	if documents.Mode != "incremental" || documents.FullEvery != 7 {
+		t.Errorf("Unexpected mode %q, full every %d", documents.Mode, documents.FullEvery)
+	}
+	if documents.Retention == nil || documents.Retention.KeepDaily != 7 || len(documents.Notify) != 1 {
+		t.Errorf("Profile retention or notify not applied: %+v", documents)
+	}
+
+	shared, _ := cfg.Task("shared")
+	if shared == nil || shared.From != "gdrive" || shared.Mirror != "/srv/mirror/shared" {
+		t.Errorf("Unexpected cloud task: %+v", shared)
+	}
+
+	photos, _ := cfg.Task("photos")
+	if photos.Schedule != "0 3 * * 0" {
+		t.Errorf("Task schedule should win over the profile, got %q", photos.Schedule)
+	}
+	if photos.Compress == nil || *photos.Compress {
+		t.Error("An explicit false should win over the profile")
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		line   int
+		msg    string
+	}{
+		{
+			name:   "unknown field",
+			config: "tasks:\n  - name: a\n    source: /a\n    remote: nas\n    dest: /a\n    shedule: daily\n",
+			line:   6,
+			msg:    `unknown field "shedule"`,
+		},
+		{
+			name:   "wrong type",
+			config: "settings:\n  concurrency: many\n",
+			line:   2,
+			msg:    "cannot unmarshal",
+		},
+		{
+			name:   "unknown provider",
+			config: "remotes:\n  box:\n    provider: dropbox\n",
+			line:   3,
+			msg:    "dropbox",
+		},
+		{
+			name:   "bad schedule",
+			config: "tasks:\n  - name: a\n    source: /a\n    remote: nas\n    dest: /a\n    schedule: every night\n",
+			line:   6,
+			msg:    "invalid schedule",
+		},
+		{
+			name:   "encrypt without key source",
+			config: "tasks:\n  - name: a\n    source: /a\n    remote: nas\n    dest: /a\n    encrypt: true\n",
+			line:   6,
+			msg:    "key_source",
+		},
+		{
+			name:   "key source read once",
+			config: "tasks:\n  - name: a\n    source: /a\n    remote: nas\n    dest: /a\n    encrypt: true\n    key_source: fd:3\n",
+			line:   7,
+			msg:    "can only be read once",
+		},
+		{
+			name:   "duplicate task",
+			config: "tasks:\n  - name: a\n    source: /a\n    remote: nas\n    dest: /a\n  - name: a\n    source: /b\n    remote: nas\n    dest: /b\n",
+			line:   6,
+			msg:    "already declared on line 2",
+		},
+		{
+			name:   "cloud source without compress",
+			config: "tasks:\n  - name: a\n    from: gdrive\n    source: /Team\n    remote: nas\n    dest: /a\n",
+			line:   3,
+			msg:    "requires compress",
+		},
+		{
+			name:   "bad name template",
+			config: "tasks:\n  - name: a\n    source: /a\n    remote: nas\n    dest: /a\n    name_template: \"{task}-{time}.gz\"\n",
+			line:   6,
+			msg:    "unknown placeholder {time}",
+		},
+		{
+			name:   "incremental without compress",
+			config: "tasks:\n  - name: a\n    source: /a\n    remote: nas\n    dest: /a\n    mode: incremental\n",
+			line:   6,
+			msg:    "requires compress",
+		},
+		{
+			name:   "bad retention",
+			config: "tasks:\n  - name: a\n    source: /a\n    remote: nas\n    dest: /a\n    retention:\n      keep_within: soon\n",
+			line:   7,
+			msg:    "invalid duration",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.config))
+			var errs Errors
+			if !errors.As(err, &errs) || len(errs) == 0 {
+				t.Fatalf("Expected validation errors, got %v", err)
+			}
+			if errs[0].Line != tt.line || !strings.Contains(errs[0].Msg, tt.msg) {
+				t.Errorf("Expected %q on line %d, got %v", tt.msg, tt.line, errs)
+			}
+		})
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	tests := map[string]time.Duration{
+		"30d": 30 * 24 * time.Hour,
+		"2w":  14 * 24 * time.Hour,
+		"1y":  365 * 24 * time.Hour,
+		"12h": 12 * time.Hour,
+	}
+	for input, want := range tests {
+		if got, err := ParseDuration(input); err != nil || got != want {
+			t.Errorf("ParseDuration(%q) = %v, %v, want %v", input, got, err, want)
+		}
+	}
+	if _, err := ParseDuration("-1d"); err == nil {
+		t.Error("Expected an error for a negative duration")
+	}
+}
@@ -0,0 +1,75 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Error is a problem found at a line of the configuration file.
+type Error struct {
+	File string
+	Line int
+	Msg  string
+}
+
+func (e *Error) Error() string {
+	switch {
+	case e.File != "" && e.Line > 0:
+		return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Msg)
+	case e.Line > 0:
+		return fmt.Sprintf("line %d: %s", e.Line, e.Msg)
+	case e.File != "":
+		return fmt.Sprintf("%s: %s", e.File, e.Msg)
+	}
+	return e.Msg
+}
+
+// Errors collects every problem found while validating a configuration.
+type Errors []Error
+
+func (errs Errors) Error() string {
+	lines := make([]string, len(errs))
+	for i := range errs {
+		lines[i] = errs[i].Error()
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (errs *Errors) add(line int, format string, args ...any) {
+	*errs = append(*errs, Error{Line: line, Msg: fmt.Sprintf(format, args...)})
+}
+
+var yamlLine = regexp.MustCompile(`^(?:yaml: )?line (\d+): (.*)$`)
+
+// yamlError turns the errors of the YAML decoder into Errors, keeping the
+// line numbers it reports.
+func yamlError(err error) error {
+	var errs Errors
+	if errors.As(err, &errs) {
+		return err
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		return Errors{*e}
+	}
+
+	messages := []string{err.Error()}
+	var typeErr *yaml.TypeError
+	if errors.As(err, &typeErr) {
+		messages = typeErr.Errors
+	}
+	for _, msg := range messages {
+		if m := yamlLine.FindStringSubmatch(msg); m != nil {
+			line, _ := strconv.Atoi(m[1])
+			errs.add(line, "%s", m[2])
+			continue
+		}
+		errs.add(0, "%s", strings.TrimPrefix(msg, "yaml: "))
+	}
+	return errs
+}
@@ -0,0 +1,210 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/amankumarsingh77/automated_backup_tool/internal/core/naming"
+	"github.com/amankumarsingh77/automated_backup_tool/internal/core/snapshot"
+	"github.com/amankumarsingh77/automated_backup_tool/internal/security/credentials"
+	"github.com/amankumarsingh77/automated_backup_tool/internal/security/secret"
+	"github.com/amankumarsingh77/automated_backup_tool/internal/storage"
+	"github.com/robfig/cron/v3"
+)
+
+// Validate checks the configuration and returns every problem found.
+func (c *Config) Validate() Errors {
+	var errs Errors
+
+	if c.Settings.Concurrency < 0 {
+		errs.add(c.Settings.pos.at("concurrency"), "concurrency must not be negative")
+	}
+
+	for _, name := range c.RemoteNames() {
+		remote := c.Remotes[name]
+		if remote == nil {
+			errs.add(0, "remote %q is empty", name)
+			continue
+		}
+		if err := credentials.ValidateRemoteName(name); err != nil {
+			errs.add(remote.pos.line, "%v", err)
+		}
+		if remote.Provider == "" {
+			errs.add(remote.pos.line, "remote %q: provider is required", name)
+		} else if err := storage.Validate(remote.Provider); err != nil {
+			errs.add(remote.Line("provider"), "remote %q: %v", name, err)
+		}
+		if remote.SecretSource != "" {
+			if err := secret.Source(remote.SecretSource).Validate(); err != nil {
+				errs.add(remote.Line("secret_source"), "remote %q: %v", name, err)
+			}
+		}
+	}
+
+	notifications := make([]string, 0, len(c.Notifications))
+	for name := range c.Notifications {
+		notifications = append(notifications, name)
+	}
+	sort.Strings(notifications)
+	for _, name := range notifications {
+		notification := c.Notifications[name]
+		switch notification.Type {
+		case "", "webhook":
+		default:
+			errs.add(notification.pos.at("type"), "notification %q: unknown type %q, expected webhook", name, notification.Type)
+		}
+		if u, err := url.Parse(notification.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs.add(notification.pos.at("url"), "notification %q: url must be an http or https URL", name)
+		}
+	}
+
+	seen := make(map[string]int)
+	for _, task := range c.Tasks {
+		if task == nil {
+			continue
+		}
+		label := fmt.Sprintf("task %q", task.Name)
+		if task.Name == "" {
+			errs.add(task.pos.line, "task name is required")
+			label = "task"
+		} else if line, ok := seen[task.Name]; ok {
+			errs.add(task.Line("name"), "task %q is already declared on line %d", task.Name, line)
+		} else {
+			seen[task.Name] = task.Line("name")
+		}
+
+		if task.Profile != "" && c.Profiles[task.Profile] == nil {
+			errs.add(task.Line("profile"), "%s: unknown profile %q", label, task.Profile)
+		}
+		if task.Source == "" {
+			errs.add(task.pos.line, "%s: source is required", label)
+		}
+		mirrorOnly := task.From != "" && task.Mirror != "" && task.Remote == ""
+		if task.Remote == "" && !mirrorOnly {
+			errs.add(task.pos.line, "%s: remote is required", label)
+		}
+		if task.Dest == "" && !mirrorOnly {
+			errs.add(task.pos.line, "%s: dest is required", label)
+		}
+		if task.From != "" {
+			if Bool(task.Single) || Bool(task.Sync) {
+				errs.add(task.Line("from"), "%s: from cannot be combined with single or sync", label)
+			}
+			if task.Remote != "" && !Bool(task.Compress) && !Bool(task.Repository) {
+				errs.add(task.Line("from"), "%s: uploading a cloud folder to another remote requires compress or repository", label)
+			}
+		}
+		if task.NameTemplate != "" {
+			if Bool(task.Sync) {
+				errs.add(task.Line("name_template"), "%s: name_template cannot be combined with sync", label)
+			}
+			if err := naming.Validate(task.NameTemplate); err != nil {
+				errs.add(task.Line("name_template"), "%s: %v", label, err)
+			}
+		}
+		if Bool(task.Repository) && (Bool(task.Sync) || Bool(task.Compress) || task.NameTemplate != "") {
+			errs.add(task.Line("repository"), "%s: repository cannot be combined with sync, compress or name_template", label)
+		}
+		switch task.Mode {
+		case "", snapshot.ModeFull:
+			if task.FullEvery != 0 {
+				errs.add(task.Line("full_every"), "%s: full_every needs mode incremental or differential", label)
+			}
+		case snapshot.ModeIncremental, snapshot.ModeDifferential:
+			if !Bool(task.Compress) || Bool(task.Single) || Bool(task.Sync) || Bool(task.Repository) {
+				errs.add(task.Line("mode"), "%s: %s mode requires compress and cannot be combined with single, sync or repository", label, task.Mode)
+			}
+			if task.FullEvery < 0 {
+				errs.add(task.Line("full_every"), "%s: full_every must not be negative", label)
+			}
+		default:
+			errs.add(task.Line("mode"), "%s: unknown mode %q, use full, incremental or differential", label, task.Mode)
+		}
+		if task.KeepDeleted != "" {
+			if _, err := ParseDuration(task.KeepDeleted); err != nil {
+				errs.add(task.Line("keep_deleted"), "%s: %v", label, err)
+			}
+		}
+		if task.Schedule != "" {
+			if _, err := cron.ParseStandard(task.Schedule); err != nil {
+				errs.add(task.Line("schedule"), "%s: invalid schedule: %v", label, err)
+			}
+		}
+		if Bool(task.Encrypt) && task.KeySource == "" {
+			errs.add(task.Line("encrypt"), "%s: encrypt requires key_source, keys are never stored in the config file", label)
+		}
+		if task.KeySource != "" {
+			if err := secret.Source(task.KeySource).ValidateRepeatable(); err != nil {
+				errs.add(task.Line("key_source"), "%s: %v", label, err)
+			}
+		}
+		if Bool(task.Single) && Bool(task.Sync) {
+			errs.add(task.Line("sync"), "%s: single and sync cannot be combined", label)
+		}
+		if task.Retention != nil {
+			task.Retention.validate(label, &errs)
+		}
+		for _, target := range task.Notify {
+			if _, ok := c.Notifications[target]; !ok {
+				errs.add(task.Line("notify"), "%s: unknown notification %q", label, target)
+			}
+		}
+	}
+	return errs
+}
+
+func (r *Retention) validate(label string, errs *Errors) {
+	counts := []struct {
+		field string
+		count int
+	}{
+		{"keep_last", r.KeepLast},
+		{"keep_hourly", r.KeepHourly},
+		{"keep_daily", r.KeepDaily},
+		{"keep_weekly", r.KeepWeekly},
+		{"keep_monthly", r.KeepMonthly},
+		{"keep_yearly", r.KeepYearly},
+	}
+	for _, c := range counts {
+		if c.count < 0 {
+			errs.add(r.pos.at(c.field), "%s: %s must not be negative", label, c.field)
+		}
+	}
+	if r.KeepWithin != "" {
+		if _, err := ParseDuration(r.KeepWithin); err != nil {
+			errs.add(r.pos.at("keep_within"), "%s: %v", label, err)
+		}
+	}
+}
+
+// ParseDuration parses a duration like time.ParseDuration, and also
+// accepts a whole number of days, weeks or years such as "30d", "2w" or
+// "1y", which retention periods are usually given in.
+func ParseDuration(s string) (time.Duration, error) {
+	units := []struct {
+		suffix string
+		unit   time.Duration
+	}{
+		{"d", 24 * time.Hour},
+		{"w", 7 * 24 * time.Hour},
+		{"y", 365 * 24 * time.Hour},
+	}
+	for _, u := range units {
+		if n, ok := strings.CutSuffix(s, u.suffix); ok {
+			count, err := strconv.Atoi(n)
+			if err != nil || count < 0 {
+				return 0, fmt.Errorf("invalid duration %q", s)
+			}
+			return time.Duration(count) * u.unit, nil
+		}
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+	return d, nil
+}
@@ -0,0 +1,100 @@
+package backup
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ApplyResult lists the task names touched by ApplyTasks.
+type ApplyResult struct {
+	Created   []string
+	Updated   []string
+	Deleted   []string
+	Unchanged []string
+}
+
+// ApplyTasks reconciles the task store with the tasks declared in a config
+// file. Declared tasks are matched to stored ones by name: new ones are
+// created, changed ones updated in place, keeping their ID and status, and
+// managed tasks no longer declared are deleted. Tasks created on the
+// command line are left alone. With dryRun the store is not written.
+func ApplyTasks(declared []BackupTask, dryRun bool) (ApplyResult, error) {
+	var result ApplyResult
+
+	stored, err := LoadTasks()
+	if err != nil {
+		return result, fmt.Errorf("failed to load tasks: %w", err)
+	}
+
+	byName := make(map[string]BackupTask, len(declared))
+	for _, task := range declared {
+		if task.Name == "" {
+			return result, fmt.Errorf("declared task for %s has no name", task.SourcePath)
+		}
+		if _, ok := byName[task.Name]; ok {
+			return result, fmt.Errorf("task %s is declared twice", task.Name)
+		}
+		byName[task.Name] = task
+	}
+
+	var tasks []BackupTask
+	for _, task := range stored {
+		want, declared := byName[task.Name]
+		switch {
+		case task.Name == "" || (!declared && !task.Managed):
+			tasks = append(tasks, task)
+		case !declared:
+			result.Deleted = append(result.Deleted, task.Name)
+		case !task.Managed:
+			return result, fmt.Errorf("task %s already exists and was not created from a config file, rename one of them", task.Name)
+		default:
+			delete(byName, task.Name)
+			if sameDefinition(task, want) {
+				result.Unchanged = append(result.Unchanged, task.Name)
+				tasks = append(tasks, task)
+				continue
+			}
+			want.ID, want.CreatedAt = task.ID, task.CreatedAt
+			want.Status, want.ErrorMessage = task.Status, task.ErrorMessage
+			want.Managed = true
+			result.Updated = append(result.Updated, task.Name)
+			tasks = append(tasks, want)
+		}
+	}
+
+	var created []BackupTask
+	for _, task := range byName {
+		task.ID = uuid.New().String()
+		task.CreatedAt = time.Now()
+		task.Status = StatusPending
+		task.Managed = true
+		created = append(created, task)
+		result.Created = append(result.Created, task.Name)
+	}
+	sort.Slice(created, func(i, j int) bool { return created[i].Name < created[j].Name })
+	tasks = append(tasks, created...)
+
+	sort.Strings(result.Created)
+	if dryRun || (len(result.Created) == 0 && len(result.Updated) == 0 && len(result.Deleted) == 0) {
+		return result, nil
+	}
+	if err := SaveTasks(tasks); err != nil {
+		return result, fmt.Errorf("failed to save tasks: %w", err)
+	}
+	return result, nil
+}
+
+// sameDefinition reports whether two tasks are declared the same way,
+// ignoring the state of their runs.
+func sameDefinition(a, b BackupTask) bool {
+	for _, t := range []*BackupTask{&a, &b} {
+		t.ID, t.CreatedAt, t.Status, t.ErrorMessage = "", time.Time{}, "", ""
+		t.Managed = true
+		t.watcher, t.stopSync = nil, nil
+	}
+	return reflect.DeepEqual(a, b)
+}
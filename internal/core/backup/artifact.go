@@ -0,0 +1,59 @@
+package backup
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/amankumarsingh77/automated_backup_tool/internal/core/naming"
+	"github.com/amankumarsingh77/automated_backup_tool/internal/core/snapshot"
+	"github.com/amankumarsingh77/automated_backup_tool/internal/storage"
+)
+
+// chainTemplate names the archives of incremental and differential tasks
+// without a name template, which must not replace each other.
+const chainTemplate = "{source}-{date}{ext}"
+
+// artifactPath returns where the archive of a run started at started is
+// uploaded. input is the file or folder the archive was made from and ext
+// the extensions compression and encryption added to it. Without a name
+// template the archive of a full backup task is named after input and
+// replaces the one the previous run uploaded; sync tasks always keep file
+// names.
+func (t *BackupTask) artifactPath(input, ext string, started time.Time) (string, error) {
+	template := t.NameTemplate
+	if template == "" && t.mode() != snapshot.ModeFull {
+		template = chainTemplate
+	}
+	if template == "" || t.syncRun {
+		return path.Join(t.DestinationPath, filepath.Base(input)+ext), nil
+	}
+
+	host, err := os.Hostname()
+	if err != nil {
+		return "", fmt.Errorf("failed to get host name: %w", err)
+	}
+	task := t.Name
+	if task == "" {
+		task = t.ID
+	}
+	source := filepath.Base(t.SourcePath)
+	if t.SourceRemote != "" {
+		source = path.Base(storage.CleanPath(t.SourcePath))
+	}
+
+	name, err := naming.Expand(template, naming.Vars{
+		Task:   task,
+		TaskID: t.ID,
+		Host:   host,
+		Source: source,
+		Ext:    ext,
+		Time:   started,
+	})
+	if err != nil {
+		return "", err
+	}
+	return path.Join(t.DestinationPath, name), nil
+}
@@ -0,0 +1,229 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/amankumarsingh77/automated_backup_tool/internal/core/snapshot"
+	"github.com/amankumarsingh77/automated_backup_tool/internal/security/encryption"
+	"github.com/amankumarsingh77/automated_backup_tool/internal/storage"
+	"github.com/amankumarsingh77/automated_backup_tool/internal/utils"
+	"github.com/amankumarsingh77/automated_backup_tool/internal/utils/filesystem"
+)
+
+// mode returns the task's backup mode, see the snapshot package.
+func (t *BackupTask) mode() string {
+	if t.Mode == "" {
+		return snapshot.ModeFull
+	}
+	return t.Mode
+}
+
+// validateMode checks the backup mode of a new task. Incremental and
+// differential backups archive a selection of the files of a folder, so
+// they need compression.
+func (t *BackupTask) validateMode() error {
+	switch t.mode() {
+	case snapshot.ModeFull:
+		if t.FullEvery != 0 {
+			return errors.New("a full backup every N runs needs the incremental or differential mode")
+		}
+		return nil
+	case snapshot.ModeIncremental, snapshot.ModeDifferential:
+	default:
+		return fmt.Errorf("unknown backup mode %q, use full, incremental or differential", t.Mode)
+	}
+	if t.FullEvery < 0 {
+		return errors.New("the number of runs between full backups cannot be negative")
+	}
+	if !t.Compress || t.IsSingle || t.IsSync || t.Repository {
+		return fmt.Errorf("%s backups need compression and cannot be combined with single file, sync or repository tasks", t.Mode)
+	}
+	return nil
+}
+
+// planArchive picks the files the archive of a run holds, returning nil
+// when it holds the whole source. A full run of a task excluding parts of
+// its source returns the files of the manifest. An incremental or
+// differential run records the snapshot it builds on and the deleted files
+// in snap and returns the files that changed since that snapshot.
+func (t *BackupTask) planArchive(ctx context.Context, snap *snapshot.Snapshot) (map[string]bool, error) {
+	logger := utils.GetLogger()
+
+	snap.Mode = t.mode()
+	if snap.Mode == snapshot.ModeFull {
+		return t.fullArchive(snap), nil
+	}
+
+	snapshots, err := t.Snapshots(ctx)
+	if err != nil {
+		return nil, err
+	}
+	archives := snapshots[:0]
+	for _, s := range snapshots {
+		if s.Data != "" {
+			archives = append(archives, s)
+		}
+	}
+	parent := snapshot.Parent(archives, snap.Mode, t.FullEvery)
+	if parent == nil {
+		logger.Info("Starting a new chain of %s backups with a full backup", snap.Mode)
+		snap.Mode = snapshot.ModeFull
+		return t.fullArchive(snap), nil
+	}
+
+	changed, deleted := snapshot.Diff(parent.Files, snap.Files)
+	snap.Parent = parent.ID
+	snap.Deleted = deleted
+	files := make(map[string]bool, len(changed))
+	for _, name := range changed {
+		files[name] = true
+	}
+	logger.Info("Making %s backup on snapshot %s: %d files changed, %d deleted", snap.Mode, parent.ShortID(), len(changed), len(deleted))
+	return files, nil
+}
+
+// fullArchive returns the files the archive of a full run holds: nil for
+// the whole source, or when parts of it are excluded, the files of the
+// manifest of snap.
+func (t *BackupTask) fullArchive(snap *snapshot.Snapshot) map[string]bool {
+	if len(t.excluded()) == 0 {
+		return nil
+	}
+	files := make(map[string]bool, len(snap.Files))
+	for _, file := range snap.Files {
+		files[file.Path] = true
+	}
+	return files
+}
+
+// restoreArchives restores an archive snapshot. The archives of its chain
+// are unpacked oldest first, each followed by removing the files it records
+// as deleted; the manifest of s then sets the modification times. A chain
+// holding an archive a later run replaced is not restored, since that
+// would restore the later run's files.
+func (t *BackupTask) restoreArchives(ctx context.Context, s *snapshot.Snapshot, target string) error {
+	snapshots, err := t.Snapshots(ctx)
+	if err != nil {
+		return err
+	}
+	chain, err := snapshot.Chain(snapshots, s)
+	if err != nil {
+		return err
+	}
+	for _, link := range chain {
+		if by := snapshot.ReplacedBy(snapshots, link); by != nil {
+			return fmt.Errorf("the archive of snapshot %s at %s was replaced by snapshot %s; give the task a name template to keep the archive of every run",
+				link.ShortID(), link.Data, by.ShortID())
+		}
+	}
+
+	provider, err := t.newProvider()
+	if err != nil {
+		return fmt.Errorf("failed to initialize remote %s: %w", t.RemoteName(), err)
+	}
+	if closer, ok := provider.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	if err := os.MkdirAll(target, 0755); err != nil {
+		return fmt.Errorf("failed to create restore target: %w", err)
+	}
+	for _, link := range chain {
+		if err := t.restoreArchive(ctx, provider, link, target); err != nil {
+			return fmt.Errorf("failed to restore the archive of snapshot %s: %w", link.ShortID(), err)
+		}
+		for _, name := range link.Deleted {
+			local, err := localPath(target, name)
+			if err != nil {
+				return err
+			}
+			if err := os.RemoveAll(local); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, file := range s.Files {
+		if file.Mode&fs.ModeSymlink != 0 {
+			continue
+		}
+		local, err := localPath(target, file.Path)
+		if err != nil {
+			return err
+		}
+		if err := os.Chtimes(local, file.ModTime, file.ModTime); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// restoreArchive unpacks the archive of a single snapshot into target.
+func (t *BackupTask) restoreArchive(ctx context.Context, provider storage.StorageProvider, s *snapshot.Snapshot, target string) error {
+	temp, err := os.CreateTemp(filesystem.TempDir(), "restore-*")
+	if err != nil {
+		return err
+	}
+	temp.Close()
+	defer os.Remove(temp.Name())
+
+	if err := provider.Download(ctx, temp.Name(), s.Data); err != nil {
+		return fmt.Errorf("failed to download %s: %w", s.Data, err)
+	}
+	archive := temp.Name()
+	if t.Encrypt {
+		if archive, err = t.decryptArchive(archive); err != nil {
+			return fmt.Errorf("failed to decrypt %s: %w", s.Data, err)
+		}
+		defer os.Remove(archive)
+	}
+	if t.Compress {
+		return filesystem.ExtractArchive(archive, target)
+	}
+
+	// Without compression only a single file can be uploaded.
+	if len(s.Files) != 1 {
+		return fmt.Errorf("%s is not an archive", s.Data)
+	}
+	local, err := localPath(target, s.Files[0].Path)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(archive)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(local, data, s.Files[0].Mode.Perm())
+}
+
+// decryptArchive decrypts a downloaded archive with the task's key and
+// returns the name of the decrypted copy.
+func (t *BackupTask) decryptArchive(name string) (string, error) {
+	key, err := t.encryptionKey()
+	if err != nil {
+		return "", err
+	}
+	if key == "" {
+		return "", errors.New("the encryption key of the task is unknown")
+	}
+	encryptionManager, err := encryption.NewEncryptionManager(key)
+	if err != nil {
+		return "", err
+	}
+	return encryptionManager.DecryptFile(name)
+}
+
+// localPath returns where the manifest path name is restored below target.
+func localPath(target, name string) (string, error) {
+	local := filepath.FromSlash(name)
+	if !filepath.IsLocal(local) {
+		return "", fmt.Errorf("snapshot holds an invalid path %q", name)
+	}
+	return filepath.Join(target, local), nil
+}
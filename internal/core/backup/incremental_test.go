@@ -0,0 +1,175 @@
+package backup
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/amankumarsingh77/automated_backup_tool/internal/core/snapshot"
+	_ "github.com/amankumarsingh77/automated_backup_tool/internal/storage/local"
+	"github.com/amankumarsingh77/automated_backup_tool/internal/utils"
+	"github.com/amankumarsingh77/automated_backup_tool/internal/utils/filesystem"
+)
+
+// setupTaskEnv points the task store, credentials, logs and temporary
+// files of the package into a temporary home directory.
+func setupTaskEnv(t *testing.T) {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	utils.SetLogDir(filepath.Join(home, "logs"))
+
+	oldTaskFile := taskFile
+	taskFile = filepath.Join(home, "backup_tasks.json")
+	t.Cleanup(func() { taskFile = oldTaskFile })
+
+	filesystem.SetTempDir(t.TempDir())
+	t.Cleanup(func() { filesystem.SetTempDir("") })
+
+	if err := GlobalTaskManager.Initialize("master password"); err != nil {
+		t.Fatalf("Failed to initialize task manager: %v", err)
+	}
+}
+
+// readTree returns the contents of the regular files below dir by their
+// slash separated relative path.
+func readTree(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	files := make(map[string]string)
+	err := filepath.WalkDir(dir, func(name string, entry fs.DirEntry, err error) error {
+		if err != nil || !entry.Type().IsRegular() {
+			return err
+		}
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, name)
+		files[filepath.ToSlash(rel)] = string(data)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func writeFile(t *testing.T, name, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(name, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEncryptedIncrementalChain(t *testing.T) {
+	setupTaskEnv(t)
+
+	source := filepath.Join(t.TempDir(), "data")
+	writeFile(t, filepath.Join(source, "a.txt"), "alpha")
+	writeFile(t, filepath.Join(source, "docs", "b.txt"), "beta")
+	writeFile(t, filepath.Join(source, "c.txt"), "gamma")
+
+	task := &BackupTask{
+		SourcePath:      source,
+		Provider:        "local",
+		DestinationPath: t.TempDir(),
+		NameTemplate:    "{source}-{date:20060102T150405.000000000}{ext}",
+		Compress:        true,
+		Encrypt:         true,
+		EncryptionKey:   "task key",
+		Mode:            snapshot.ModeIncremental,
+	}
+	if _, err := task.Create(); err != nil {
+		t.Fatalf("Failed to create task: %v", err)
+	}
+
+	var states []map[string]string
+	changes := []func(){
+		func() {},
+		func() {
+			writeFile(t, filepath.Join(source, "a.txt"), "alpha 2")
+			os.Remove(filepath.Join(source, "c.txt"))
+		},
+		func() {
+			writeFile(t, filepath.Join(source, "docs", "d.txt"), "delta")
+		},
+	}
+	for _, change := range changes {
+		change()
+		if err := task.ExecuteTask(); err != nil {
+			t.Fatalf("Backup failed: %v", err)
+		}
+		states = append(states, readTree(t, source))
+	}
+
+	ctx := context.Background()
+	snapshots, err := task.Snapshots(ctx)
+	if err != nil {
+		t.Fatalf("Failed to list snapshots: %v", err)
+	}
+	if len(snapshots) != len(states) {
+		t.Fatalf("Expected %d snapshots, got %d", len(states), len(snapshots))
+	}
+	if snapshots[0].Mode != snapshot.ModeFull || snapshots[1].Mode != snapshot.ModeIncremental || snapshots[2].Parent != snapshots[1].ID {
+		t.Errorf("Unexpected chain: %+v %+v %+v", snapshots[0], snapshots[1], snapshots[2])
+	}
+
+	for i, s := range snapshots {
+		target := t.TempDir()
+		if err := task.Restore(ctx, s, target); err != nil {
+			t.Fatalf("Failed to restore snapshot %d: %v", i, err)
+		}
+		if got := readTree(t, target); !reflect.DeepEqual(got, states[i]) {
+			t.Errorf("Snapshot %d restored %v, expected %v", i, got, states[i])
+		}
+	}
+}
+
+func TestReplacedArchiveIsNotRestored(t *testing.T) {
+	setupTaskEnv(t)
+
+	source := filepath.Join(t.TempDir(), "data")
+	writeFile(t, filepath.Join(source, "a.txt"), "alpha")
+
+	// Without a name template every run uploads data.gz again.
+	task := &BackupTask{
+		SourcePath:      source,
+		Provider:        "local",
+		DestinationPath: t.TempDir(),
+		Compress:        true,
+	}
+	if _, err := task.Create(); err != nil {
+		t.Fatalf("Failed to create task: %v", err)
+	}
+	for _, content := range []string{"alpha", "alpha 2"} {
+		writeFile(t, filepath.Join(source, "a.txt"), content)
+		if err := task.ExecuteTask(); err != nil {
+			t.Fatalf("Backup failed: %v", err)
+		}
+	}
+
+	ctx := context.Background()
+	snapshots, err := task.Snapshots(ctx)
+	if err != nil {
+		t.Fatalf("Failed to list snapshots: %v", err)
+	}
+	if len(snapshots) != 2 || snapshots[0].Data != snapshots[1].Data {
+		t.Fatalf("Expected two snapshots of the same archive, got %v", snapshotIDs(snapshots))
+	}
+	if err := task.Restore(ctx, snapshots[0], t.TempDir()); err == nil {
+		t.Error("Expected restoring the replaced archive to fail")
+	}
+	target := t.TempDir()
+	if err := task.Restore(ctx, snapshots[1], target); err != nil {
+		t.Fatalf("Failed to restore the latest snapshot: %v", err)
+	}
+	if got := readTree(t, target); got["a.txt"] != "alpha 2" {
+		t.Errorf("Restored %v, expected the latest run", got)
+	}
+}
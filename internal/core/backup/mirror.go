@@ -0,0 +1,107 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+	"time"
+
+	"github.com/amankumarsingh77/automated_backup_tool/internal/config"
+	"github.com/amankumarsingh77/automated_backup_tool/internal/core/mirror"
+	"github.com/amankumarsingh77/automated_backup_tool/internal/storage"
+	"github.com/amankumarsingh77/automated_backup_tool/internal/utils"
+	"github.com/amankumarsingh77/automated_backup_tool/internal/utils/filesystem"
+)
+
+// defaultKeepDeleted is how long a mirror keeps files deleted from the
+// cloud when the task does not say.
+const defaultKeepDeleted = 30 * 24 * time.Hour
+
+// mirrorOnly reports whether the task only keeps a local copy of a cloud
+// folder, without uploading it anywhere.
+func (t *BackupTask) mirrorOnly() bool {
+	return t.SourceRemote != "" && t.RemoteName() == ""
+}
+
+// excluded returns the relative paths of the source that are not backed
+// up. The copy of a cloud folder keeps the files deleted in the cloud in
+// mirror.DeletedDir, which only the copy itself holds on to.
+func (t *BackupTask) excluded() []string {
+	if t.SourceRemote == "" {
+		return nil
+	}
+	return []string{mirror.DeletedDir}
+}
+
+// validateSourceRemote rejects a source remote that is configured but
+// cannot read the folders of its account. Remotes that are not configured
+// yet fail when the task runs.
+func (t *BackupTask) validateSourceRemote() error {
+	if GlobalTaskManager.credManager == nil {
+		return nil
+	}
+	provider, err := openRemote(t.SourceRemote, t.SourceRemote)
+	if err != nil {
+		return nil
+	}
+	if closer, ok := provider.(io.Closer); ok {
+		defer closer.Close()
+	}
+	return checkSource(t.SourceRemote, provider)
+}
+
+// checkSource returns why folders cannot be backed up from the provider of
+// remote, or nil.
+func checkSource(remote string, provider storage.StorageProvider) error {
+	if checker, ok := provider.(storage.SourceChecker); ok {
+		if err := checker.CheckSource(); err != nil {
+			return fmt.Errorf("cannot back up from remote %s: %w", remote, err)
+		}
+	}
+	return nil
+}
+
+// pullSource brings the local copy of the cloud folder the task backs up
+// up to date and returns the directory holding it.
+func (t *BackupTask) pullSource(ctx context.Context) (string, error) {
+	logger := utils.GetLogger()
+
+	keepDeleted := defaultKeepDeleted
+	if t.KeepDeleted != "" {
+		var err error
+		if keepDeleted, err = config.ParseDuration(t.KeepDeleted); err != nil {
+			return "", err
+		}
+	}
+
+	appDir, err := filesystem.AppDataDir()
+	if err != nil {
+		return "", err
+	}
+	dir := t.MirrorPath
+	if dir == "" {
+		dir = filepath.Join(appDir, "mirrors", t.ID)
+	}
+	statePath := filepath.Join(appDir, "mirrors", t.ID+".json")
+
+	provider, err := openRemote(t.SourceRemote, t.SourceRemote)
+	if err != nil {
+		return "", fmt.Errorf("failed to initialize remote %s: %w", t.SourceRemote, err)
+	}
+	if closer, ok := provider.(io.Closer); ok {
+		defer closer.Close()
+	}
+	if err := checkSource(t.SourceRemote, provider); err != nil {
+		return "", err
+	}
+
+	logger.Info("Copying %s from %s to %s", t.SourcePath, t.SourceRemote, dir)
+	result, err := mirror.Pull(ctx, provider, t.SourcePath, dir, statePath, mirror.Options{KeepDeleted: keepDeleted})
+	if err != nil {
+		return "", err
+	}
+	logger.Info("Copied %s from %s: %d downloaded, %d moved, %d set aside as deleted, %d skipped",
+		t.SourcePath, t.SourceRemote, result.Downloaded, result.Moved, result.Removed, result.Skipped)
+	return dir, nil
+}
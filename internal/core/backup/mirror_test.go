@@ -0,0 +1,94 @@
+package backup
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/amankumarsingh77/automated_backup_tool/internal/core/mirror"
+	"github.com/amankumarsingh77/automated_backup_tool/internal/security/credentials"
+	_ "github.com/amankumarsingh77/automated_backup_tool/internal/storage/gdrive"
+)
+
+func TestCloudBackupLeavesOutDeletedFiles(t *testing.T) {
+	setupTaskEnv(t)
+
+	// The local provider stands in for the cloud drive.
+	cloud := filepath.Join(t.TempDir(), "drive")
+	writeFile(t, filepath.Join(cloud, "a.txt"), "alpha")
+	writeFile(t, filepath.Join(cloud, "b.txt"), "beta")
+
+	mirrorPath := filepath.Join(t.TempDir(), "mirror")
+	task := &BackupTask{
+		SourcePath:      cloud,
+		SourceRemote:    "local",
+		MirrorPath:      mirrorPath,
+		Provider:        "local",
+		DestinationPath: t.TempDir(),
+		Compress:        true,
+	}
+	if _, err := task.Create(); err != nil {
+		t.Fatalf("Failed to create task: %v", err)
+	}
+	if err := task.ExecuteTask(); err != nil {
+		t.Fatalf("Backup failed: %v", err)
+	}
+	os.Remove(filepath.Join(cloud, "b.txt"))
+	if err := task.ExecuteTask(); err != nil {
+		t.Fatalf("Backup failed: %v", err)
+	}
+
+	if matches, _ := filepath.Glob(filepath.Join(mirrorPath, mirror.DeletedDir, "*", "b.txt")); len(matches) != 1 {
+		t.Fatalf("Expected the mirror to keep the deleted file, got %v", matches)
+	}
+
+	ctx := context.Background()
+	snapshots, err := task.Snapshots(ctx)
+	if err != nil {
+		t.Fatalf("Failed to list snapshots: %v", err)
+	}
+	if len(snapshots) != 2 {
+		t.Fatalf("Expected 2 snapshots, got %d", len(snapshots))
+	}
+	last := snapshots[1]
+	for _, file := range last.Files {
+		if strings.HasPrefix(file.Path, mirror.DeletedDir) {
+			t.Errorf("Snapshot lists the deleted file %s", file.Path)
+		}
+	}
+
+	target := t.TempDir()
+	if err := task.Restore(ctx, last, target); err != nil {
+		t.Fatalf("Failed to restore: %v", err)
+	}
+	if got, want := readTree(t, target), map[string]string{"a.txt": "alpha"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Restored %v, expected %v", got, want)
+	}
+}
+
+func TestDeviceLoginRemoteCannotBeBackedUp(t *testing.T) {
+	setupTaskEnv(t)
+
+	err := GlobalTaskManager.credManager.StoreCredential(credentials.Credential{
+		Name:     "tv-gdrive",
+		Provider: "gdrive",
+		Key:      "client-id",
+		Secret:   "client-secret",
+		Options:  map[string]string{"login": "device"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to store credential: %v", err)
+	}
+
+	task := &BackupTask{
+		SourcePath:   "Photos",
+		SourceRemote: "tv-gdrive",
+		MirrorPath:   t.TempDir(),
+	}
+	if _, err := task.Create(); err == nil || !strings.Contains(err.Error(), "device login") {
+		t.Errorf("Expected backing up a device login remote to be rejected, got %v", err)
+	}
+}
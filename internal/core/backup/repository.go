@@ -0,0 +1,144 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/amankumarsingh77/automated_backup_tool/internal/core/repository"
+	"github.com/amankumarsingh77/automated_backup_tool/internal/core/snapshot"
+	"github.com/amankumarsingh77/automated_backup_tool/internal/storage"
+	"github.com/amankumarsingh77/automated_backup_tool/internal/utils"
+)
+
+// repositoryKey returns the key the task's repository is encrypted with,
+// empty for an unencrypted one. A generated key would be lost after the
+// run, so an encrypted repository needs a configured key.
+func (t *BackupTask) repositoryKey() (string, error) {
+	if !t.Encrypt {
+		return "", nil
+	}
+	key, err := t.encryptionKey()
+	if err != nil {
+		return "", err
+	}
+	if key == "" {
+		return "", errors.New("an encrypted repository needs an encryption key or key source")
+	}
+	return key, nil
+}
+
+// backupToRepository stores input in the deduplicated repository at the
+// task's destination, creating the repository on the first run, and
+// uploads the snapshot pointing at the stored tree.
+func (t *BackupTask) backupToRepository(ctx context.Context, input string, snap *snapshot.Snapshot) error {
+	logger := utils.GetLogger()
+
+	key, err := t.repositoryKey()
+	if err != nil {
+		return err
+	}
+	provider, err := t.newProvider()
+	if err != nil {
+		return fmt.Errorf("failed to initialize remote %s: %w", t.RemoteName(), err)
+	}
+	if closer, ok := provider.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	repo, err := repository.Open(ctx, provider, t.DestinationPath, key)
+	if errors.Is(err, repository.ErrNoRepository) {
+		logger.Info("Creating repository in %s on %s", t.DestinationPath, t.RemoteName())
+		repo, err = repository.Init(ctx, provider, t.DestinationPath, key, repository.DefaultChunkerParams)
+	}
+	if err != nil {
+		return err
+	}
+
+	logger.Info("Storing %s in the repository on %s", input, t.RemoteName())
+	tree, stats, err := repo.Backup(ctx, input, t.excluded()...)
+	if err != nil {
+		return err
+	}
+	logger.Info("Stored %d files: %d of %d bytes were new, in %d packs", stats.Files, stats.NewBytes, stats.Bytes, stats.Packs)
+
+	snap.Tree = tree
+	snap.Files = make([]snapshot.File, len(stats.Entries))
+	for i, entry := range stats.Entries {
+		snap.Files[i] = snapshot.File{Path: entry.Path, Size: entry.Size, Mode: entry.Mode, ModTime: entry.ModTime, SHA256: entry.SHA256}
+	}
+	snap.Finished = time.Now()
+	cipher, err := t.snapshotCipher()
+	if err != nil {
+		return err
+	}
+	if err := snapshot.Save(ctx, provider, t.DestinationPath, snap, cipher); err != nil {
+		return err
+	}
+	logger.Info("Stored snapshot %s of %d files", snap.ShortID(), len(snap.Files))
+	return nil
+}
+
+// restoreRepository writes the tree of a repository snapshot into target.
+func (t *BackupTask) restoreRepository(ctx context.Context, s *snapshot.Snapshot, target string) error {
+	key, err := t.repositoryKey()
+	if err != nil {
+		return err
+	}
+	provider, err := t.newProvider()
+	if err != nil {
+		return fmt.Errorf("failed to initialize remote %s: %w", t.RemoteName(), err)
+	}
+	if closer, ok := provider.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	repo, err := repository.Open(ctx, provider, t.DestinationPath, key)
+	if err != nil {
+		return err
+	}
+	return repo.Restore(ctx, s.Tree, target)
+}
+
+// pruneRepository deletes the data of the task's repository that no
+// snapshot in it references. Other tasks may share the repository, so the
+// snapshots of every task count, except the removed ones a dry run has not
+// deleted. With dryRun set nothing is deleted.
+func (t *BackupTask) pruneRepository(ctx context.Context, provider storage.StorageProvider, removed []*snapshot.Snapshot, dryRun bool) (repository.PruneStats, error) {
+	logger := utils.GetLogger()
+
+	key, err := t.repositoryKey()
+	if err != nil {
+		return repository.PruneStats{}, err
+	}
+	repo, err := repository.Open(ctx, provider, t.DestinationPath, key)
+	if err != nil {
+		return repository.PruneStats{}, err
+	}
+	snapshots, err := snapshot.List(ctx, provider, t.DestinationPath)
+	if err != nil {
+		return repository.PruneStats{}, err
+	}
+	gone := make(map[string]bool, len(removed))
+	for _, s := range removed {
+		gone[s.ID] = true
+	}
+	var trees []string
+	for _, s := range snapshots {
+		if s.Tree != "" && !gone[s.ID] {
+			trees = append(trees, s.Tree)
+		}
+	}
+
+	stats, err := repo.Prune(ctx, trees, dryRun)
+	if err != nil {
+		return stats, fmt.Errorf("failed to prune the repository: %w", err)
+	}
+	if dryRun {
+		return stats, nil
+	}
+	logger.Info("Removed %d unused blobs of %d bytes from the repository, deleted %d and rewrote %d packs", stats.Blobs, stats.Bytes, stats.Deleted, stats.Repacked)
+	return stats, nil
+}
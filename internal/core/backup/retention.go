@@ -0,0 +1,215 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/amankumarsingh77/automated_backup_tool/internal/config"
+	"github.com/amankumarsingh77/automated_backup_tool/internal/core/repository"
+	"github.com/amankumarsingh77/automated_backup_tool/internal/core/snapshot"
+	"github.com/amankumarsingh77/automated_backup_tool/internal/storage"
+	"github.com/amankumarsingh77/automated_backup_tool/internal/utils"
+)
+
+// RetentionPolicy declares which backups of a task are kept. A zero count
+// does not keep anything by that rule; the zero policy keeps everything.
+type RetentionPolicy struct {
+	KeepLast    int `json:"keep_last,omitempty"`
+	KeepHourly  int `json:"keep_hourly,omitempty"`
+	KeepDaily   int `json:"keep_daily,omitempty"`
+	KeepWeekly  int `json:"keep_weekly,omitempty"`
+	KeepMonthly int `json:"keep_monthly,omitempty"`
+	KeepYearly  int `json:"keep_yearly,omitempty"`
+	// KeepWithin keeps every backup younger than the duration, such as
+	// "30d".
+	KeepWithin string `json:"keep_within,omitempty"`
+}
+
+// IsZero reports whether the policy keeps everything.
+func (p *RetentionPolicy) IsZero() bool {
+	return p == nil || *p == RetentionPolicy{}
+}
+
+// Validate checks the counts and the duration of the policy.
+func (p *RetentionPolicy) Validate() error {
+	if p.IsZero() {
+		return nil
+	}
+	if p.KeepLast < 0 || p.KeepHourly < 0 || p.KeepDaily < 0 || p.KeepWeekly < 0 || p.KeepMonthly < 0 || p.KeepYearly < 0 {
+		return errors.New("retention counts must not be negative")
+	}
+	if p.KeepWithin != "" {
+		if _, err := config.ParseDuration(p.KeepWithin); err != nil {
+			return fmt.Errorf("invalid keep within: %w", err)
+		}
+	}
+	return nil
+}
+
+// retentionPeriods are the calendar rules of a policy. A rule keeping n
+// backups keeps the latest backup of each of the last n periods that have
+// one; periods follow the local time zone.
+var retentionPeriods = []struct {
+	count  func(p *RetentionPolicy) int
+	period func(t time.Time) string
+}{
+	{func(p *RetentionPolicy) int { return p.KeepHourly }, func(t time.Time) string { return t.Format("2006-01-02 15") }},
+	{func(p *RetentionPolicy) int { return p.KeepDaily }, func(t time.Time) string { return t.Format("2006-01-02") }},
+	{func(p *RetentionPolicy) int { return p.KeepWeekly }, func(t time.Time) string {
+		year, week := t.ISOWeek()
+		return fmt.Sprintf("%d-W%02d", year, week)
+	}},
+	{func(p *RetentionPolicy) int { return p.KeepMonthly }, func(t time.Time) string { return t.Format("2006-01") }},
+	{func(p *RetentionPolicy) int { return p.KeepYearly }, func(t time.Time) string { return t.Format("2006") }},
+}
+
+// Apply splits snapshots into those the policy keeps at the time now and
+// those it removes, both oldest first. A kept incremental or differential
+// snapshot keeps the snapshots it builds on, so it can still be restored.
+func (p *RetentionPolicy) Apply(snapshots []*snapshot.Snapshot, now time.Time) (keep, remove []*snapshot.Snapshot, err error) {
+	if p.IsZero() {
+		return snapshots, nil, nil
+	}
+	if err := p.Validate(); err != nil {
+		return nil, nil, err
+	}
+
+	newest := append([]*snapshot.Snapshot(nil), snapshots...)
+	sort.SliceStable(newest, func(i, j int) bool {
+		return newest[i].Started.After(newest[j].Started)
+	})
+
+	kept := make(map[*snapshot.Snapshot]bool)
+	for i := 0; i < p.KeepLast && i < len(newest); i++ {
+		kept[newest[i]] = true
+	}
+	if p.KeepWithin != "" {
+		within, _ := config.ParseDuration(p.KeepWithin)
+		for _, s := range newest {
+			if s.Started.After(now.Add(-within)) {
+				kept[s] = true
+			}
+		}
+	}
+	for _, rule := range retentionPeriods {
+		count, last := rule.count(p), ""
+		for _, s := range newest {
+			if count == 0 {
+				break
+			}
+			if period := rule.period(s.Started.Local()); period != last {
+				kept[s] = true
+				last = period
+				count--
+			}
+		}
+	}
+
+	byID := make(map[string]*snapshot.Snapshot, len(snapshots))
+	for _, s := range snapshots {
+		byID[s.ID] = s
+	}
+	for s := range kept {
+		for !s.Full() {
+			parent, ok := byID[s.Parent]
+			if !ok || kept[parent] {
+				break
+			}
+			kept[parent] = true
+			s = parent
+		}
+	}
+
+	for _, s := range snapshots {
+		if kept[s] {
+			keep = append(keep, s)
+		} else {
+			remove = append(remove, s)
+		}
+	}
+	return keep, remove, nil
+}
+
+// PruneResult is the outcome of Prune.
+type PruneResult struct {
+	// Keep and Remove are the snapshots kept and removed, oldest first.
+	Keep, Remove []*snapshot.Snapshot
+	// Repository summarizes the data removed from the repository of a
+	// repository task.
+	Repository repository.PruneStats
+}
+
+// Prune applies the task's retention policy to its snapshots and deletes
+// the ones it does not keep, unless dryRun is set. The archives of removed
+// snapshots are deleted; for a repository task, the data only removed
+// snapshots reference is deleted from the repository. A dry run of a
+// repository task reports the data that would be deleted.
+func (t *BackupTask) Prune(ctx context.Context, dryRun bool) (PruneResult, error) {
+	var result PruneResult
+	snapshots, err := t.Snapshots(ctx)
+	if err != nil {
+		return result, err
+	}
+	result.Keep, result.Remove, err = t.Retention.Apply(snapshots, time.Now())
+	if err != nil || len(result.Remove) == 0 || dryRun && !t.Repository {
+		return result, err
+	}
+	keep, remove := result.Keep, result.Remove
+
+	provider, err := t.newProvider()
+	if err != nil {
+		return result, fmt.Errorf("failed to initialize remote %s: %w", t.RemoteName(), err)
+	}
+	if closer, ok := provider.(io.Closer); ok {
+		defer closer.Close()
+	}
+	if dryRun {
+		result.Repository, err = t.pruneRepository(ctx, provider, remove, true)
+		return result, err
+	}
+
+	// Runs without a name template upload their archive under the same
+	// name, so older snapshots can point at the archive of a kept one.
+	inUse := make(map[string]bool)
+	for _, s := range keep {
+		inUse[s.Data] = true
+	}
+	for _, s := range remove {
+		if s.Data != "" && !inUse[s.Data] {
+			if err := provider.Delete(ctx, s.Data); err != nil && !errors.Is(err, storage.ErrNotFound) {
+				return result, fmt.Errorf("failed to delete %s: %w", s.Data, err)
+			}
+			inUse[s.Data] = true
+		}
+		if err := snapshot.Delete(ctx, provider, t.DestinationPath, s); err != nil {
+			return result, err
+		}
+	}
+
+	if t.Repository {
+		result.Repository, err = t.pruneRepository(ctx, provider, remove, false)
+	}
+	return result, err
+}
+
+// applyRetention prunes the task's snapshots after a run. A failed prune
+// is logged and does not fail the run.
+func (t *BackupTask) applyRetention(ctx context.Context) {
+	if t.Retention.IsZero() || t.syncRun || t.mirrorOnly() {
+		return
+	}
+
+	logger := utils.GetLogger()
+	result, err := t.Prune(ctx, false)
+	if err != nil {
+		logger.Error("Failed to apply the retention policy of task %s: %v", t.ID, err)
+		return
+	}
+	if len(result.Remove) > 0 {
+		logger.Info("Retention policy of task %s removed %d snapshots", t.ID, len(result.Remove))
+	}
+}
@@ -0,0 +1,87 @@
+package backup
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/amankumarsingh77/automated_backup_tool/internal/core/snapshot"
+)
+
+func snapshotIDs(snapshots []*snapshot.Snapshot) string {
+	ids := ""
+	for _, s := range snapshots {
+		ids += s.ID + " "
+	}
+	return ids
+}
+
+func TestRetentionApply(t *testing.T) {
+	now := time.Date(2024, 6, 10, 12, 0, 0, 0, time.Local)
+	var snapshots []*snapshot.Snapshot
+	// Two backups a day for the last five days, oldest first.
+	for day := 4; day >= 0; day-- {
+		for _, hour := range []int{1, 9} {
+			snapshots = append(snapshots, &snapshot.Snapshot{
+				ID:      fmt.Sprintf("d%dh%d", day, hour),
+				Started: time.Date(2024, 6, 10-day, hour, 0, 0, 0, time.Local),
+			})
+		}
+	}
+
+	tests := []struct {
+		name   string
+		policy *RetentionPolicy
+		keep   string
+	}{
+		{"zero policy", nil, snapshotIDs(snapshots)},
+		{"keep last", &RetentionPolicy{KeepLast: 3}, "d1h9 d0h1 d0h9 "},
+		{"keep daily", &RetentionPolicy{KeepDaily: 2}, "d1h9 d0h9 "},
+		{"keep within", &RetentionPolicy{KeepWithin: "1d"}, "d0h1 d0h9 "},
+		{"combined", &RetentionPolicy{KeepLast: 1, KeepDaily: 3}, "d2h9 d1h9 d0h9 "},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keep, remove, err := tt.policy.Apply(snapshots, now)
+			if err != nil {
+				t.Fatalf("Failed to apply policy: %v", err)
+			}
+			if got := snapshotIDs(keep); got != tt.keep {
+				t.Errorf("Expected to keep %q, got %q", tt.keep, got)
+			}
+			if len(keep)+len(remove) != len(snapshots) {
+				t.Errorf("Expected %d snapshots in total, got %d kept and %d removed", len(snapshots), len(keep), len(remove))
+			}
+		})
+	}
+}
+
+func TestRetentionKeepsChains(t *testing.T) {
+	started := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	snapshots := []*snapshot.Snapshot{
+		{ID: "old", Mode: snapshot.ModeFull, Started: started},
+		{ID: "full", Mode: snapshot.ModeFull, Started: started.Add(time.Hour)},
+		{ID: "inc1", Mode: snapshot.ModeIncremental, Parent: "full", Started: started.Add(2 * time.Hour)},
+		{ID: "inc2", Mode: snapshot.ModeIncremental, Parent: "inc1", Started: started.Add(3 * time.Hour)},
+	}
+
+	keep, remove, err := (&RetentionPolicy{KeepLast: 1}).Apply(snapshots, started.Add(4*time.Hour))
+	if err != nil {
+		t.Fatalf("Failed to apply policy: %v", err)
+	}
+	if got := snapshotIDs(keep); got != "full inc1 inc2 " {
+		t.Errorf("Expected the chain of inc2 to be kept, got %q", got)
+	}
+	if got := snapshotIDs(remove); got != "old " {
+		t.Errorf("Expected only old to be removed, got %q", got)
+	}
+}
+
+func TestRetentionValidate(t *testing.T) {
+	if err := (&RetentionPolicy{KeepDaily: -1}).Validate(); err == nil {
+		t.Error("Expected a negative count to be rejected")
+	}
+	if err := (&RetentionPolicy{KeepWithin: "soon"}).Validate(); err == nil {
+		t.Error("Expected an invalid duration to be rejected")
+	}
+}
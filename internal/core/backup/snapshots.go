@@ -0,0 +1,101 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/amankumarsingh77/automated_backup_tool/internal/core/snapshot"
+	"github.com/amankumarsingh77/automated_backup_tool/internal/security/encryption"
+)
+
+// newSnapshot starts the snapshot of a run. Sync tasks upload files as they
+// change and have no runs to take snapshots of.
+func (t *BackupTask) newSnapshot() (*snapshot.Snapshot, error) {
+	if t.syncRun || t.mirrorOnly() {
+		return nil, nil
+	}
+	source := t.SourcePath
+	if t.SourceRemote != "" {
+		source = t.SourceRemote + ":" + t.SourcePath
+	}
+	return snapshot.New(t.ID, t.Name, source)
+}
+
+// Snapshots lists the snapshots the task stored on its remote, oldest
+// first. Snapshots of other tasks sharing the destination are left out.
+// The snapshots of an encrypted task are opened with its key; without a
+// known key they stay sealed, see the snapshot package.
+func (t *BackupTask) Snapshots(ctx context.Context) ([]*snapshot.Snapshot, error) {
+	if t.RemoteName() == "" {
+		return nil, fmt.Errorf("task %s keeps no snapshots, it does not upload to a remote", t.ID)
+	}
+
+	provider, err := t.newProvider()
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize remote %s: %w", t.RemoteName(), err)
+	}
+	if closer, ok := provider.(io.Closer); ok {
+		defer closer.Close()
+	}
+	snapshots, err := snapshot.List(ctx, provider, t.DestinationPath)
+	if err != nil {
+		return nil, err
+	}
+	cipher, err := t.snapshotCipher()
+	if err != nil {
+		return nil, err
+	}
+	own := snapshots[:0]
+	for _, s := range snapshots {
+		if s.TaskID != t.ID {
+			continue
+		}
+		if cipher != nil {
+			if err := s.Open(cipher); err != nil {
+				return nil, err
+			}
+		}
+		own = append(own, s)
+	}
+	return own, nil
+}
+
+// snapshotCipher returns the cipher sealing the snapshots of an encrypted
+// task, or nil when the task is not encrypted or its key is unknown.
+func (t *BackupTask) snapshotCipher() (snapshot.Cipher, error) {
+	if !t.Encrypt {
+		return nil, nil
+	}
+	key, err := t.encryptionKey()
+	if err != nil || key == "" {
+		return nil, err
+	}
+	encryptionManager, err := encryption.NewEncryptionManager(key)
+	if err != nil {
+		return nil, err
+	}
+	return encryptionManager, nil
+}
+
+// Restore writes the files of a snapshot of the task into target.
+func (t *BackupTask) Restore(ctx context.Context, s *snapshot.Snapshot, target string) error {
+	if s.Tree != "" {
+		return t.restoreRepository(ctx, s, target)
+	}
+	return t.restoreArchives(ctx, s, target)
+}
+
+// FindTask returns the stored task with the given ID or name.
+func FindTask(idOrName string) (*BackupTask, error) {
+	tasks, err := LoadTasks()
+	if err != nil {
+		return nil, err
+	}
+	for i := range tasks {
+		if tasks[i].ID == idOrName || (tasks[i].Name != "" && tasks[i].Name == idOrName) {
+			return &tasks[i], nil
+		}
+	}
+	return nil, fmt.Errorf("task %s not found", idOrName)
+}
@@ -6,17 +6,23 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"path"
 	"path/filepath"
 	"sync"
 	"time"
 
 	"github.com/robfig/cron/v3"
 
+	"github.com/amankumarsingh77/automated_backup_tool/internal/config"
+	"github.com/amankumarsingh77/automated_backup_tool/internal/core/naming"
+	"github.com/amankumarsingh77/automated_backup_tool/internal/core/snapshot"
 	filesync "github.com/amankumarsingh77/automated_backup_tool/internal/core/sync"
+	"github.com/amankumarsingh77/automated_backup_tool/internal/notify"
 	"github.com/amankumarsingh77/automated_backup_tool/internal/security/credentials"
 	"github.com/amankumarsingh77/automated_backup_tool/internal/security/encryption"
-	"github.com/amankumarsingh77/automated_backup_tool/internal/storage/gdrive"
-	"github.com/amankumarsingh77/automated_backup_tool/internal/storage/onedrive"
+	"github.com/amankumarsingh77/automated_backup_tool/internal/security/secret"
+	"github.com/amankumarsingh77/automated_backup_tool/internal/storage"
+	"github.com/amankumarsingh77/automated_backup_tool/internal/storage/oauthutil"
 	"github.com/amankumarsingh77/automated_backup_tool/internal/utils"
 	"github.com/amankumarsingh77/automated_backup_tool/internal/utils/filesystem"
 	"github.com/amankumarsingh77/automated_backup_tool/internal/utils/retry"
@@ -32,29 +38,74 @@ const (
 	StatusSyncing   = "syncing"
 )
 
+
+
+
+
 type BackupTask struct {
-	ID              string    `json:"id"`
-	SourcePath      string    `json:"source_path"`
-	Provider        string    `json:"provider"`
-	DestinationPath string    `json:"destination_path"`
-	Schedule        string    `json:"schedule"`
-	Recurring       bool      `json:"recurring"`
-	Compress        bool      `json:"compress"`
-	Encrypt         bool      `json:"encrypt"`
-	EncryptionKey   string    `json:"encryption_key,omitempty"`
-	CreatedAt       time.Time `json:"created_at"`
-	Status          string    `json:"status"`
-	IsSingle        bool      `json:"is_single"`
-	IsSync          bool      `json:"is_sync"`
-	ErrorMessage    string    `json:"error_message,omitempty"`
-	watcher         *filesync.FolderWatcher
-	stopSync        chan struct{}
+	ID                  string           `json:"id"`
+	Name                string           `json:"name,omitempty"`
+	Managed             bool             `json:"managed,omitempty"`
+	SourcePath          string           `json:"source_path"`
+	Provider            string           `json:"provider"`
+	Remote              string           `json:"remote,omitempty"`
+	DestinationPath     string           `json:"destination_path"`
+	NameTemplate        string           `json:"name_template,omitempty"`
+	Repository          bool             `json:"repository,omitempty"`
+	Mode                string           `json:"mode,omitempty"`
+	FullEvery           int              `json:"full_every,omitempty"`
+	Schedule            string           `json:"schedule"`
+	Recurring           bool             `json:"recurring"`
+	Compress            bool             `json:"compress"`
+	Encrypt             bool             `json:"encrypt"`
+	EncryptionKey       string           `json:"encryption_key,omitempty"`
+	EncryptionKeySource string           `json:"encryption_key_source,omitempty"`
+	CreatedAt           time.Time        `json:"created_at"`
+	Status              string           `json:"status"`
+	IsSingle            bool             `json:"is_single"`
+	IsSync              bool             `json:"is_sync"`
+	SourceRemote        string           `json:"source_remote,omitempty"`
+	MirrorPath          string           `json:"mirror_path,omitempty"`
+	KeepDeleted         string           `json:"keep_deleted,omitempty"`
+	Retention           *RetentionPolicy `json:"retention,omitempty"`
+	NotifyURLs          []string         `json:"notify_urls,omitempty"`
+	ErrorMessage        string           `json:"error_message,omitempty"`
+	watcher             *filesync.FolderWatcher
+	stopSync            chan struct{}
+	// syncRun marks the upload of a single changed file by a sync task.
+	syncRun bool
 }
 
 type TaskManager struct {
 	mu          sync.RWMutex
 	schedulers  map[string]*cron.Cron
 	credManager *credentials.CredentialManager
+	slots       chan struct{}
+}
+
+// SetConcurrency limits how many backup runs execute at the same time.
+// Zero removes the limit. It must be called before any task runs.
+func (tm *TaskManager) SetConcurrency(n int) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	tm.slots = nil
+	if n > 0 {
+		tm.slots = make(chan struct{}, n)
+	}
+}
+
+// acquire waits for a free run slot and returns the function releasing it.
+func (tm *TaskManager) acquire() func() {
+	tm.mu.RLock()
+	slots := tm.slots
+	tm.mu.RUnlock()
+
+	if slots == nil {
+		return func() {}
+	}
+	slots <- struct{}{}
+	return func() { <-slots }
 }
 
 func (tm *TaskManager) Initialize(masterPassword string) error {
@@ -78,8 +129,8 @@ func (t *BackupTask) Create() (string, error) {
 	t.CreatedAt = time.Now()
 	t.Status = StatusPending
 
-	if t.SourcePath == "" || t.Provider == "" {
-		return "", errors.New("cannot create a backup task without a Sourcepath or Provider")
+	if err := t.validate(); err != nil {
+		return "", err
 	}
 
 	totTasks, err := LoadTasks()
@@ -97,6 +148,74 @@ func (t *BackupTask) Create() (string, error) {
 	return t.ID, nil
 }
 
+// validate checks the settings of a new task. A zero retention policy is
+// dropped.
+func (t *BackupTask) validate() error {
+	if t.SourcePath == "" || (t.Provider == "" && !t.mirrorOnly()) {
+		return errors.New("cannot create a backup task without a Sourcepath or Provider")
+	}
+	if t.DestinationPath == "" && !t.mirrorOnly() {
+		return errors.New("cannot create a backup task without a destination path")
+	}
+
+	if t.NameTemplate != "" {
+		if t.IsSync {
+			return errors.New("a name template cannot be combined with sync")
+		}
+		if err := naming.Validate(t.NameTemplate); err != nil {
+			return err
+		}
+	}
+	if t.Repository && (t.IsSync || t.Compress || t.NameTemplate != "") {
+		return errors.New("a repository task cannot be combined with sync, compression or a name template")
+	}
+	if err := t.validateMode(); err != nil {
+		return err
+	}
+	if t.Encrypt && t.EncryptionKey == "" && t.EncryptionKeySource == "" {
+		return errors.New("encryption needs an encryption key or key source")
+	}
+	if t.EncryptionKeySource != "" {
+		if err := secret.Source(t.EncryptionKeySource).ValidateRepeatable(); err != nil {
+			return err
+		}
+	}
+
+	if t.Retention.IsZero() {
+		t.Retention = nil
+	} else if t.IsSync {
+		return errors.New("a retention policy cannot be combined with sync, which keeps no snapshots")
+	} else if err := t.Retention.Validate(); err != nil {
+		return err
+	}
+
+	if t.SourceRemote != "" {
+		switch {
+		case t.IsSync || t.IsSingle:
+			return errors.New("backing up a cloud folder cannot be combined with sync or single file tasks")
+		case t.mirrorOnly() && t.MirrorPath == "":
+			return errors.New("backing up a cloud folder needs a mirror folder or a remote to store it")
+		case !t.mirrorOnly() && !t.Compress && !t.Repository:
+			return errors.New("uploading a cloud folder to another remote needs compression or a repository")
+		}
+		if t.KeepDeleted != "" {
+			if _, err := config.ParseDuration(t.KeepDeleted); err != nil {
+				return fmt.Errorf("invalid keep deleted: %w", err)
+			}
+		}
+		if err := t.validateSourceRemote(); err != nil {
+			return err
+		}
+	}
+
+	if t.Provider != "" {
+		if err := storage.Validate(t.Provider); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func ListTasks() ([]BackupTask, error) {
 	totTasks, err := LoadTasks()
 	if err != nil {
@@ -129,7 +248,12 @@ func (t *BackupTask) ExecuteTask() error {
 		return t.startSync()
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Hour)
+	release := GlobalTaskManager.acquire()
+	defer release()
+
+	// Runs are unattended, so an expired login fails the run instead of
+	// waiting for someone to sign in.
+	ctx, cancel := context.WithTimeout(oauthutil.WithoutLogin(context.Background()), 2*time.Hour)
 	defer cancel()
 
 	
@@ -155,22 +279,133 @@ func (t *BackupTask) ExecuteTask() error {
 			}
 		}()
 
+		if pending := t.loadPendingUpload(); pending != nil {
+			logger.Info("Resuming the upload of %s left by an interrupted run", pending.RemotePath)
+			return t.upload(ctx, pending)
+		}
+
+		snap, err := t.newSnapshot()
+		if err != nil {
+			logger.Error("Failed to start snapshot: %v", err)
+			return retry.NewRetryableError(err, false)
+		}
+
 		filePath := t.SourcePath
-		var err error
+
+		if t.SourceRemote != "" {
+			filePath, err = t.pullSource(ctx)
+			if err != nil {
+				logger.Error("Failed to copy %s from %s: %v", t.SourcePath, t.SourceRemote, err)
+				t.Status = StatusFailed
+				UpdateTaskStatus(t.ID, t.Status, err.Error())
+				return retry.NewRetryableError(err, retryable(err))
+			}
+			if t.mirrorOnly() {
+				t.Status = StatusCompleted
+				if err := UpdateTaskStatus(t.ID, t.Status, ""); err != nil {
+					logger.Error("Failed to update task status: %v", err)
+					return retry.NewRetryableError(err, true)
+				}
+				logger.Info("Backup task %s completed successfully", t.ID)
+				return nil
+			}
+		}
+
+		input, started := filePath, time.Now()
+		if snap != nil {
+			started = snap.Started
+		}
+		// A repository backup describes the files while storing them, so
+		// the source is read once.
+		if snap != nil && !t.Repository {
+			logger.Info("Hashing %s", filePath)
+			snap.Files, err = snapshot.Scan(filePath, t.excluded()...)
+			if err != nil {
+				logger.Error("Failed to build manifest: %v", err)
+				t.Status = StatusFailed
+				UpdateTaskStatus(t.ID, t.Status, err.Error())
+				return retry.NewRetryableError(err, true)
+			}
+		}
+
+		if t.Repository {
+			if err := t.backupToRepository(ctx, filePath, snap); err != nil {
+				logger.Error("Failed to store backup in the repository on %s: %v", t.RemoteName(), err)
+				t.Status = StatusFailed
+				UpdateTaskStatus(t.ID, t.Status, err.Error())
+				return retry.NewRetryableError(err, retryable(err))
+			}
+			t.Status = StatusCompleted
+			if err := UpdateTaskStatus(t.ID, t.Status, ""); err != nil {
+				logger.Error("Failed to update task status: %v", err)
+				return retry.NewRetryableError(err, true)
+			}
+			logger.Info("Backup task %s completed successfully", t.ID)
+			return nil
+		}
+
+		// made lists the files this attempt creates. Once uploading starts
+		// the archive is kept until it is uploaded, see pendingUpload.
+		var made []string
+		defer func() {
+			for _, name := range made {
+				os.Remove(name)
+			}
+		}()
+
+		var archived map[string]bool
+		if snap != nil {
+			if archived, err = t.planArchive(ctx, snap); err != nil {
+				logger.Error("Failed to read the previous snapshots: %v", err)
+				t.Status = StatusFailed
+				UpdateTaskStatus(t.ID, t.Status, err.Error())
+				return retry.NewRetryableError(err, retryable(err))
+			}
+		}
+
+		// ext collects the extensions compression and encryption add, to
+		// name the upload.
+		ext := ""
+		// Compress before encrypting: the files an incremental run selects
+		// are paths in the source folder, and encrypted data does not compress.
+		if t.Compress {
+			logger.Info("Compressing file %s", filePath)
+			if archived != nil {
+				filePath, err = filesystem.CompressFiles(filePath, archived)
+			} else {
+				filePath, err = filesystem.CompressFile(filePath)
+			}
+			if err != nil {
+				errMsg := fmt.Sprintf("could not compress backup task: %s", err)
+				logger.Error("Compression failed: %v", err)
+				t.Status = StatusFailed
+				UpdateTaskStatus(t.ID, t.Status, errMsg)
+				return retry.NewRetryableError(err, true)
+			}
+			made = append(made, filePath)
+			ext += ".gz"
+			logger.Info("File compressed successfully")
+		}
 
 		
 		if t.Encrypt {
 			logger.Info("Encrypting file %s", filePath)
-			if t.EncryptionKey == "" {
+			key, err := t.encryptionKey()
+			if err != nil {
+				logger.Error("Failed to read encryption key: %v", err)
+				return retry.NewRetryableError(err, false)
+			}
+			if key == "" {
 				logger.Info("No encryption key provided, generating random key")
 				t.EncryptionKey, err = encryption.GenerateRandomKey()
 				if err != nil {
 					logger.Error("Failed to generate encryption key: %v", err)
 					return retry.NewRetryableError(err, false)
 				}
+				key = t.EncryptionKey
 			}
 
-			encryptionManager, err := encryption.NewEncryptionManager(t.EncryptionKey)
+			encryptionManager, err := encryption.NewEncryptionManager(key)
 			if err != nil {
 				logger.Error("Failed to create encryption manager: %v", err)
 				return retry.NewRetryableError(err, false)
@@ -181,80 +416,120 @@ func (t *BackupTask) ExecuteTask() error {
 				logger.Error("Failed to encrypt file: %v", err)
 				return retry.NewRetryableError(err, false)
 			}
-			defer os.Remove(filePath) 
+			made = append(made, filePath)
+			ext += ".encrypted"
 			logger.Info("File encrypted successfully")
 		}
 
-		
-		if t.Compress {
-			logger.Info("Compressing file %s", filePath)
-			filePath, err = filesystem.CompressFile(filePath)
-			if err != nil {
-				errMsg := fmt.Sprintf("could not compress backup task: %s", err)
-				logger.Error("Compression failed: %v", err)
-				t.Status = StatusFailed
-				UpdateTaskStatus(t.ID, t.Status, errMsg)
-				return retry.NewRetryableError(err, true)
-			}
-			defer os.Remove(filePath) 
-			logger.Info("File compressed successfully")
-		}
-
-		logger.Info("Getting credentials for provider %s", t.Provider)
-		creds, err := GlobalTaskManager.credManager.GetCredential(t.Provider)
+		remotePath, err := t.artifactPath(input, ext, started)
 		if err != nil {
-			logger.Error("Failed to get credentials: %v", err)
+			logger.Error("Failed to name the backup: %v", err)
+			t.Status = StatusFailed
+			UpdateTaskStatus(t.ID, t.Status, err.Error())
 			return retry.NewRetryableError(err, false)
 		}
 
-		switch t.Provider {
-		case "gdrive":
-			logger.Info("Uploading to Google Drive: %s", t.DestinationPath)
-			gdriveProvider := gdrive.NewGoogleDriveProvider()
-			gdriveProvider.SetCredentials(creds.Key, creds.Secret, creds.RedirectURL)
-			err = gdriveProvider.Upload(t.IsSingle, filePath, t.DestinationPath)
-			if err != nil {
-				errMsg := fmt.Sprintf("cannot upload backup task to gdrive: %v", err)
-				logger.Error("Google Drive upload failed: %v", err)
-				t.Status = StatusFailed
-				UpdateTaskStatus(t.ID, t.Status, errMsg)
+		pending := &pendingUpload{Archive: filePath, RemotePath: remotePath, Snapshot: snap, Created: started}
+		if len(made) > 0 && !t.syncRun {
+			if err := t.savePendingUpload(pending); err != nil {
+				logger.Error("Failed to save the upload state: %v", err)
 				return retry.NewRetryableError(err, true)
 			}
-			logger.Info("Successfully uploaded to Google Drive")
+			made = made[:len(made)-1]
+		}
+		return t.upload(ctx, pending)
+	}
 
-		case "onedrive":
-			logger.Info("Uploading to OneDrive: %s", t.DestinationPath)
-			onedriveProvider := onedrive.NewOneDriveProvider()
-			err = onedriveProvider.Upload(filePath, t.DestinationPath)
-			if err != nil {
-				errMsg := fmt.Sprintf("cannot upload backup task to onedrive: %v", err.Error())
-				logger.Error("OneDrive upload failed: %v", err)
-				t.Status = StatusFailed
-				UpdateTaskStatus(t.ID, t.Status, errMsg)
-				return retry.NewRetryableError(err, true)
-			}
-			logger.Info("Successfully uploaded to OneDrive")
+	started := time.Now()
+	err := backoff.RetryWithBackoff(ctx, operation)
+	if err == nil {
+		t.applyRetention(ctx)
+	}
+	t.notify(started, err)
+	return err
+}
 
-		default:
-			errMsg := fmt.Sprintf("unsupported provider %s", t.Provider)
-			logger.Error("Unsupported provider: %s", t.Provider)
-			t.Status = StatusFailed
-			UpdateTaskStatus(t.ID, t.Status, errMsg)
-			return retry.NewRetryableError(fmt.Errorf(errMsg), false)
-		}
+// notify reports the outcome of a run to the task's webhooks. A failed
+// notification is logged and does not fail the run.
+func (t *BackupTask) notify(started time.Time, runErr error) {
+	if len(t.NotifyURLs) == 0 {
+		return
+	}
 
-		t.Status = StatusCompleted
-		if err := UpdateTaskStatus(t.ID, t.Status, ""); err != nil {
-			logger.Error("Failed to update task status: %v", err)
-			return retry.NewRetryableError(err, true)
+	event := notify.Event{
+		TaskID:   t.ID,
+		TaskName: t.Name,
+		Source:   t.SourcePath,
+		Remote:   t.RemoteName(),
+		Status:   StatusCompleted,
+		Started:  started,
+		Finished: time.Now(),
+	}
+	if runErr != nil {
+		event.Status = StatusFailed
+		event.Error = runErr.Error()
+	}
+
+	logger := utils.GetLogger()
+	for _, url := range t.NotifyURLs {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		if err := notify.Webhook(ctx, url, event); err != nil {
+			logger.Error("Failed to notify %s about task %s: %v", url, t.ID, err)
 		}
+		cancel()
+	}
+}
+
+// retryable reports whether a run failing with err can succeed when it is
+// tried again. A missing login does not fix itself.
+func retryable(err error) bool {
+	return !errors.Is(err, oauthutil.ErrLoginRequired)
+}
 
-		logger.Info("Backup task %s completed successfully", t.ID)
-		return nil
+// encryptionKey returns the key to encrypt the backup with, reading it from
+// EncryptionKeySource when the task does not store the key itself.
+func (t *BackupTask) encryptionKey() (string, error) {
+	if t.EncryptionKey != "" || t.EncryptionKeySource == "" {
+		return t.EncryptionKey, nil
 	}
+	return secret.Source(t.EncryptionKeySource).Read("Encryption key for " + t.SourcePath)
+}
 
-	
-	return backoff.RetryWithBackoff(ctx, operation)
+// RemoteName returns the remote the task uploads to. Tasks created before
+// remotes had names use the default remote of their provider.
+func (t *BackupTask) RemoteName() string {
+	if t.Remote != "" {
+		return t.Remote
+	}
+	return t.Provider
+}
+
+// newProvider instantiates the storage provider the task uploads to, using
+// the credentials stored for its remote. Providers that need credentials
+// reject a missing configuration themselves.
+func (t *BackupTask) newProvider() (storage.StorageProvider, error) {
+	return openRemote(t.RemoteName(), t.Provider)
+}
+
+// openRemote instantiates the provider of a configured remote. provider is
+// used for remotes without stored credentials.
+func openRemote(remote, provider string) (storage.StorageProvider, error) {
+	logger := utils.GetLogger()
+	logger.Info("Getting credentials for remote %s", remote)
+	credManager := GlobalTaskManager.credManager
+	creds, err := credManager.GetCredential(remote)
+	if err != nil && !errors.Is(err, credentials.ErrCredentialNotFound) {
+		return nil, fmt.Errorf("failed to get credentials: %w", err)
+	}
+
+	if creds != nil {
+		provider = creds.Provider
+	}
+	return storage.New(provider, storage.Config{
+		Name:       remote,
+		Credential: creds,
+		Tokens:     credManager.TokenStore(remote),
+	})
 }
 
 func (t *BackupTask) startSync() error {
@@ -262,7 +537,7 @@ func (t *BackupTask) startSync() error {
 	logger.Info("Starting sync task for folder: %s", t.SourcePath)
 
 	
-	stateFile := filepath.Join(os.TempDir(), fmt.Sprintf("sync_state_%s.json", t.ID))
+	stateFile := filepath.Join(filesystem.TempDir(), fmt.Sprintf("sync_state_%s.json", t.ID))
 
 	watcher, err := filesync.NewFolderWatcher(stateFile)
 	if err != nil {
@@ -292,19 +567,7 @@ func (t *BackupTask) startSync() error {
 				}
 
 				
-				fileTask := &BackupTask{
-					ID:              t.ID,
-					SourcePath:      filePath,
-					Provider:        t.Provider,
-					DestinationPath: filepath.Join(t.DestinationPath, relPath),
-					Encrypt:         t.Encrypt,
-					EncryptionKey:   t.EncryptionKey,
-					Compress:        t.Compress,
-					IsSingle:        true,
-					Status:          StatusPending,
-				}
-
-				
+				fileTask := t.syncTask(filePath, relPath)
 				if err := fileTask.ExecuteTask(); err != nil {
 					logger.Error("Failed to upload file %s: %v", filePath, err)
 				} else {
@@ -330,6 +593,25 @@ func (t *BackupTask) startSync() error {
 	return nil
 }
 
+// syncTask returns the run of sync task t that uploads the changed file
+// filePath, found at relPath in the synced folder.
+func (t *BackupTask) syncTask(filePath, relPath string) *BackupTask {
+	return &BackupTask{
+		ID:                  t.ID,
+		SourcePath:          filePath,
+		Provider:            t.Provider,
+		Remote:              t.Remote,
+		DestinationPath:     path.Join(t.DestinationPath, filepath.ToSlash(filepath.Dir(relPath))),
+		Encrypt:             t.Encrypt,
+		EncryptionKey:       t.EncryptionKey,
+		EncryptionKeySource: t.EncryptionKeySource,
+		Compress:            t.Compress,
+		IsSingle:            true,
+		Status:              StatusPending,
+		syncRun:             true,
+	}
+}
+
 func (t *BackupTask) StopSync() error {
 	if t.IsSync && t.stopSync != nil {
 		close(t.stopSync)
@@ -401,8 +683,6 @@ func (t *BackupTask) ScheduleTask() error {
 			return fmt.Errorf("backup task %s timed out", t.ID)
 		}
 	}
-	
-	return nil
 }
 
 func (t *BackupTask) TempSchedule() error {
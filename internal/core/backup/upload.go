@@ -0,0 +1,169 @@
+package backup
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/amankumarsingh77/automated_backup_tool/internal/core/snapshot"
+	"github.com/amankumarsingh77/automated_backup_tool/internal/storage"
+	"github.com/amankumarsingh77/automated_backup_tool/internal/utils"
+	"github.com/amankumarsingh77/automated_backup_tool/internal/utils/filesystem"
+	"github.com/amankumarsingh77/automated_backup_tool/internal/utils/retry"
+)
+
+// pendingUploadLifetime is how long the archive of an interrupted run is
+// kept for the next attempt to upload.
+const pendingUploadLifetime = 24 * time.Hour
+
+// pendingUpload is a run whose archive is not uploaded yet. It is saved
+// before the upload starts, and the archive is kept until the upload
+// completes, so the next attempt, also after a crash or restart, uploads
+// the same archive to the same path instead of making a new one. Providers
+// with resumable uploads continue where the interrupted upload stopped.
+type pendingUpload struct {
+	// ID is the upload ID handed to the provider, made of the task ID and
+	// the snapshot ID. It is empty when the source file is uploaded as it
+	// is, which is not removed, and for sync runs; neither is saved.
+	ID         string             `json:"id"`
+	Archive    string             `json:"archive"`
+	RemotePath string             `json:"remote_path"`
+	Snapshot   *snapshot.Snapshot `json:"snapshot,omitempty"`
+	Created    time.Time          `json:"created"`
+}
+
+// pendingUploadFile returns where the pending upload of a task is saved.
+func pendingUploadFile(taskID string) (string, error) {
+	appDir, err := filesystem.AppDataDir()
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(appDir, "uploads")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create upload state directory: %w", err)
+	}
+	return filepath.Join(dir, "task-"+taskID+".json"), nil
+}
+
+// loadPendingUpload returns the upload an earlier attempt of the task did
+// not finish, or nil. Uploads whose archive is gone or that are older than
+// pendingUploadLifetime are dropped. Sync runs share the ID of their task
+// but upload a different file each, so they neither save nor resume
+// uploads: a failed one is made again on the next change of the file.
+func (t *BackupTask) loadPendingUpload() *pendingUpload {
+	if t.syncRun {
+		return nil
+	}
+	name, err := pendingUploadFile(t.ID)
+	if err != nil {
+		return nil
+	}
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil
+	}
+	var pending pendingUpload
+	if err := json.Unmarshal(data, &pending); err != nil || pending.ID == "" {
+		os.Remove(name)
+		return nil
+	}
+	if _, err := os.Stat(pending.Archive); err != nil || time.Since(pending.Created) > pendingUploadLifetime {
+		t.removePendingUpload(&pending)
+		return nil
+	}
+	return &pending
+}
+
+// savePendingUpload saves p under an upload ID made of the task ID and the
+// snapshot ID, or the start of the run for runs without a snapshot.
+func (t *BackupTask) savePendingUpload(p *pendingUpload) error {
+	p.ID = t.ID + "-" + strconv.FormatInt(p.Created.UnixNano(), 10)
+	if p.Snapshot != nil {
+		p.ID = t.ID + "-" + p.Snapshot.ID
+	}
+
+	name, err := pendingUploadFile(t.ID)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(name, data, 0600)
+}
+
+// removePendingUpload deletes the saved state and the archive of p.
+func (t *BackupTask) removePendingUpload(p *pendingUpload) {
+	if p.ID == "" {
+		return
+	}
+	if name, err := pendingUploadFile(t.ID); err == nil {
+		os.Remove(name)
+	}
+	if p.Archive != "" {
+		os.Remove(p.Archive)
+	}
+}
+
+// upload uploads the archive of a run and stores its snapshot. When this
+// fails, the pending upload stays for the next attempt.
+func (t *BackupTask) upload(ctx context.Context, pending *pendingUpload) error {
+	logger := utils.GetLogger()
+
+	provider, err := t.newProvider()
+	if err != nil {
+		logger.Error("Failed to initialize remote %s: %v", t.RemoteName(), err)
+		t.Status = StatusFailed
+		UpdateTaskStatus(t.ID, t.Status, err.Error())
+		return retry.NewRetryableError(err, false)
+	}
+	if closer, ok := provider.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	uploadCtx := ctx
+	if pending.ID != "" {
+		uploadCtx = storage.WithUploadID(ctx, pending.ID)
+	}
+	logger.Info("Uploading to %s: %s", t.RemoteName(), pending.RemotePath)
+	if err := provider.Upload(uploadCtx, pending.Archive, pending.RemotePath); err != nil {
+		errMsg := fmt.Sprintf("cannot upload backup task to %s: %v", t.RemoteName(), err)
+		logger.Error("Upload to %s failed: %v", t.RemoteName(), err)
+		t.Status = StatusFailed
+		UpdateTaskStatus(t.ID, t.Status, errMsg)
+		return retry.NewRetryableError(err, retryable(err))
+	}
+	logger.Info("Successfully uploaded to %s", t.RemoteName())
+
+	if snap := pending.Snapshot; snap != nil {
+		snap.Data = storage.CleanPath(pending.RemotePath)
+		snap.Finished = time.Now()
+		cipher, err := t.snapshotCipher()
+		if err == nil {
+			err = snapshot.Save(ctx, provider, t.DestinationPath, snap, cipher)
+		}
+		if err != nil {
+			logger.Error("Failed to store snapshot on %s: %v", t.RemoteName(), err)
+			t.Status = StatusFailed
+			UpdateTaskStatus(t.ID, t.Status, err.Error())
+			return retry.NewRetryableError(err, retryable(err))
+		}
+		logger.Info("Stored snapshot %s of %d files", snap.ShortID(), len(snap.Files))
+	}
+	t.removePendingUpload(pending)
+
+	t.Status = StatusCompleted
+	if err := UpdateTaskStatus(t.ID, t.Status, ""); err != nil {
+		logger.Error("Failed to update task status: %v", err)
+		return retry.NewRetryableError(err, true)
+	}
+
+	logger.Info("Backup task %s completed successfully", t.ID)
+	return nil
+}
@@ -0,0 +1,165 @@
+package backup
+
+import (
+	"context"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/amankumarsingh77/automated_backup_tool/internal/core/snapshot"
+	"github.com/amankumarsingh77/automated_backup_tool/internal/storage"
+	"github.com/amankumarsingh77/automated_backup_tool/internal/storage/local"
+	"github.com/amankumarsingh77/automated_backup_tool/internal/storage/oauthutil"
+	"github.com/amankumarsingh77/automated_backup_tool/internal/utils/filesystem"
+)
+
+// interruptedProvider stores uploads in a local folder and records those
+// of backups, not snapshots. Its first backup upload fails, like a run
+// killed while uploading.
+type interruptedProvider struct {
+	*local.LocalProvider
+	failed  bool
+	uploads []recordedUpload
+}
+
+type recordedUpload struct {
+	id, remotePath, content string
+}
+
+var interrupted = &interruptedProvider{}
+
+func init() {
+	storage.Register("interrupted", func(storage.Config) (storage.StorageProvider, error) {
+		return interrupted, nil
+	})
+}
+
+func (p *interruptedProvider) Upload(ctx context.Context, localPath, remotePath string) error {
+	if path.Base(path.Dir(remotePath)) == snapshot.Dir {
+		return p.LocalProvider.Upload(ctx, localPath, remotePath)
+	}
+	content, err := os.ReadFile(localPath)
+	if err != nil {
+		return err
+	}
+	p.uploads = append(p.uploads, recordedUpload{storage.UploadID(ctx), remotePath, string(content)})
+	if !p.failed {
+		p.failed = true
+		// A missing login is not retried, so the run fails at once.
+		return oauthutil.ErrLoginRequired
+	}
+	return p.LocalProvider.Upload(ctx, localPath, remotePath)
+}
+
+// resetInterrupted stores the uploads of interruptedProvider in a new
+// folder and makes its next backup upload fail.
+func resetInterrupted(t *testing.T) {
+	*interrupted = interruptedProvider{LocalProvider: local.NewLocalProvider(t.TempDir())}
+}
+
+func TestInterruptedUploadResumesSameArchive(t *testing.T) {
+	setupTaskEnv(t)
+	resetInterrupted(t)
+
+	source := filepath.Join(t.TempDir(), "data")
+	writeFile(t, filepath.Join(source, "a.txt"), "alpha")
+
+	task := &BackupTask{
+		SourcePath:      source,
+		Provider:        "interrupted",
+		DestinationPath: "backups",
+		NameTemplate:    "{source}-{date:20060102T150405.000000000}{ext}",
+		Compress:        true,
+		Encrypt:         true,
+		EncryptionKey:   "task key",
+	}
+	if _, err := task.Create(); err != nil {
+		t.Fatalf("Failed to create task: %v", err)
+	}
+	if err := task.ExecuteTask(); err == nil {
+		t.Fatal("Expected the interrupted run to fail")
+	}
+	pending := task.loadPendingUpload()
+	if pending == nil {
+		t.Fatal("Expected the interrupted upload to be saved")
+	}
+
+	// The restarted process reads the task from the store again. Changes
+	// to the source since belong to the next run.
+	writeFile(t, filepath.Join(source, "a.txt"), "alpha 2")
+	restarted, err := FindTask(task.ID)
+	if err != nil {
+		t.Fatalf("Failed to find task: %v", err)
+	}
+	if err := restarted.ExecuteTask(); err != nil {
+		t.Fatalf("Failed to resume the upload: %v", err)
+	}
+
+	if len(interrupted.uploads) != 2 {
+		t.Fatalf("Expected 2 uploads, got %d", len(interrupted.uploads))
+	}
+	first, second := interrupted.uploads[0], interrupted.uploads[1]
+	if first != second || !strings.HasPrefix(first.id, task.ID+"-") {
+		t.Errorf("Expected the same archive to be uploaded again under the same ID, got %q to %s and %q to %s",
+			first.id, first.remotePath, second.id, second.remotePath)
+	}
+	if _, err := os.Stat(pending.Archive); !os.IsNotExist(err) {
+		t.Error("Expected the archive to be removed after the upload")
+	}
+	if restarted.loadPendingUpload() != nil {
+		t.Error("Expected the pending upload to be removed")
+	}
+
+	snapshots, err := restarted.Snapshots(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to list snapshots: %v", err)
+	}
+	if len(snapshots) != 1 || first.id != task.ID+"-"+snapshots[0].ID {
+		t.Errorf("Expected the snapshot of the interrupted run, got %v", snapshotIDs(snapshots))
+	}
+}
+
+func TestSyncRunAfterFailedSyncUpload(t *testing.T) {
+	setupTaskEnv(t)
+	resetInterrupted(t)
+
+	source := filepath.Join(t.TempDir(), "data")
+	writeFile(t, filepath.Join(source, "a.txt"), "alpha")
+	writeFile(t, filepath.Join(source, "b.txt"), "beta")
+
+	task := &BackupTask{
+		SourcePath:      source,
+		Provider:        "interrupted",
+		DestinationPath: "backups",
+		Compress:        true,
+		IsSync:          true,
+	}
+	if _, err := task.Create(); err != nil {
+		t.Fatalf("Failed to create task: %v", err)
+	}
+
+	if err := task.syncTask(filepath.Join(source, "a.txt"), "a.txt").ExecuteTask(); err == nil {
+		t.Fatal("Expected the interrupted sync upload to fail")
+	}
+	if err := task.syncTask(filepath.Join(source, "b.txt"), "b.txt").ExecuteTask(); err != nil {
+		t.Fatalf("Failed to sync the next file: %v", err)
+	}
+
+	if len(interrupted.uploads) != 2 {
+		t.Fatalf("Expected 2 uploads, got %d", len(interrupted.uploads))
+	}
+	if got := interrupted.uploads[1].remotePath; got != "backups/b.txt.gz" {
+		t.Errorf("Expected the changed file to be uploaded to backups/b.txt.gz, got %s", got)
+	}
+	if _, err := interrupted.Stat(context.Background(), "backups/b.txt.gz"); err != nil {
+		t.Errorf("Expected the changed file to be stored: %v", err)
+	}
+	if task.loadPendingUpload() != nil {
+		t.Error("Expected sync runs to leave no pending upload")
+	}
+	if entries, _ := os.ReadDir(filesystem.TempDir()); len(entries) != 0 {
+		t.Errorf("Expected the archives of sync runs to be removed, found %d files", len(entries))
+	}
+}
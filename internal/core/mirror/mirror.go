@@ -0,0 +1,437 @@
+// Package mirror keeps a local copy of a folder tree stored with a
+// provider, so cloud drives can be backed up like local folders. Providers
+// with a change feed are followed incrementally; others are listed in full
+// on every run.
+package mirror
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/amankumarsingh77/automated_backup_tool/internal/storage"
+)
+
+// DeletedDir is the folder inside a mirror that files deleted from the
+// source are moved to. Each run that removes something gets a subfolder
+// named by its start time.
+const DeletedDir = ".deleted"
+
+// deletedStamp is the layout of the subfolders of DeletedDir.
+const deletedStamp = "2006-01-02T150405"
+
+// Options tune a pull.
+type Options struct {
+	// KeepDeleted is how long files deleted from the source are kept in
+	// DeletedDir. Zero keeps them forever.
+	KeepDeleted time.Duration
+}
+
+// Result counts what a pull did.
+type Result struct {
+	// Full is set when the whole tree was listed instead of following the
+	// change feed.
+	Full       bool
+	Downloaded int
+	Moved      int
+	Removed    int
+	// Skipped counts objects the provider cannot download, such as
+	// Google Forms.
+	Skipped int
+}
+
+// item is an object copied into the mirror.
+type item struct {
+	// Path is relative to the mirrored folder on the remote.
+	Path string `json:"path"`
+	// Local is relative to the mirror directory. It differs from Path for
+	// documents exported to a file format on download.
+	Local   string    `json:"local"`
+	IsDir   bool      `json:"is_dir,omitempty"`
+	Size    int64     `json:"size,omitempty"`
+	ModTime time.Time `json:"mod_time"`
+	Hash    string    `json:"hash,omitempty"`
+}
+
+// state is what a mirror remembers between runs.
+type state struct {
+	RemotePath string `json:"remote_path"`
+	Cursor     string `json:"cursor,omitempty"`
+	RootID     string `json:"root_id,omitempty"`
+	// Items are keyed by the provider's object ID, or by path for path
+	// addressed providers.
+	Items map[string]*item `json:"items"`
+}
+
+type puller struct {
+	provider   storage.StorageProvider
+	remotePath string
+	dir        string
+	started    time.Time
+	state      *state
+	result     Result
+}
+
+// Pull brings dir up to date with the tree below remotePath. statePath is
+// where the IDs and versions of the copied objects and the change feed
+// cursor are kept between runs. Files removed from the source are moved
+// to DeletedDir rather than deleted, so a mistake in the cloud does not
+// wipe the copy.
+func Pull(ctx context.Context, provider storage.StorageProvider, remotePath, dir, statePath string, opts Options) (Result, error) {
+	p := &puller{
+		provider:   provider,
+		remotePath: storage.CleanPath(remotePath),
+		dir:        dir,
+		started:    time.Now(),
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return p.result, fmt.Errorf("failed to create mirror directory: %w", err)
+	}
+
+	var err error
+	p.state, err = loadState(statePath)
+	if err != nil {
+		return p.result, err
+	}
+	// A task pointed at another folder starts over.
+	if p.state.RemotePath != p.remotePath {
+		p.state = &state{RemotePath: p.remotePath, Items: make(map[string]*item)}
+	}
+
+	feed, _ := provider.(storage.ChangeFeed)
+	switch {
+	case feed == nil || p.state.Cursor == "":
+		err = p.pullAll(ctx, feed)
+	default:
+		err = p.pullChanges(ctx, feed)
+		if errors.Is(err, storage.ErrCursorExpired) {
+			err = p.pullAll(ctx, feed)
+		}
+	}
+	if err != nil {
+		return p.result, err
+	}
+
+	if err := saveState(statePath, p.state); err != nil {
+		return p.result, err
+	}
+	if err := purgeDeleted(dir, p.started, opts.KeepDeleted); err != nil {
+		return p.result, err
+	}
+	return p.result, nil
+}
+
+// pullAll lists the whole tree and copies what differs from the mirror.
+// The cursor is taken before listing, so changes made meanwhile are seen
+// again on the next run.
+func (p *puller) pullAll(ctx context.Context, feed storage.ChangeFeed) error {
+	p.result.Full = true
+
+	// The change feed names parents by ID, so the ID of the mirrored
+	// folder itself is needed to follow it.
+	cursor, rootID := "", ""
+	if feed != nil {
+		var err error
+		if _, cursor, err = feed.Changes(ctx, p.remotePath, ""); err != nil {
+			return fmt.Errorf("failed to start change feed: %w", err)
+		}
+		root, err := p.provider.Stat(ctx, p.remotePath)
+		if err != nil {
+			return fmt.Errorf("failed to find %s: %w", p.remotePath, err)
+		}
+		rootID = root.ID
+	}
+
+	objects, err := p.provider.ListFiles(ctx, p.remotePath)
+	if err != nil {
+		return err
+	}
+
+	seen := make(map[string]bool, len(objects))
+	for _, object := range objects {
+		rel := p.relative(object.Path)
+		key := object.ID
+		if key == "" {
+			key = rel
+		}
+		seen[key] = true
+		if err := p.apply(ctx, key, rel, object); err != nil {
+			return err
+		}
+	}
+	for key := range p.state.Items {
+		if !seen[key] {
+			if err := p.remove(key); err != nil {
+				return err
+			}
+		}
+	}
+
+	p.state.Cursor = cursor
+	p.state.RootID = rootID
+	return nil
+}
+
+// pullChanges applies the changes reported since the last run. Feeds name
+// objects by ID and parent ID, so paths are rebuilt from the folders the
+// mirror knows. Changes whose parent is unknown are retried after the
+// others, as a new folder may be reported after its contents; objects
+// still outside the tree then have moved away from it.
+func (p *puller) pullChanges(ctx context.Context, feed storage.ChangeFeed) error {
+	changes, cursor, err := feed.Changes(ctx, p.remotePath, p.state.Cursor)
+	if err != nil {
+		return err
+	}
+
+	for len(changes) > 0 {
+		var pending []storage.Change
+		for _, change := range changes {
+			if change.ID == p.state.RootID {
+				continue
+			}
+			if change.Removed {
+				if err := p.remove(change.ID); err != nil {
+					return err
+				}
+				continue
+			}
+			parent, ok := p.folderPath(change.ParentID)
+			if !ok {
+				pending = append(pending, change)
+				continue
+			}
+			if err := p.apply(ctx, change.ID, path.Join(parent, change.Object.Path), change.Object); err != nil {
+				return err
+			}
+		}
+
+		if len(pending) == len(changes) {
+			for _, change := range pending {
+				if err := p.remove(change.ID); err != nil {
+					return err
+				}
+			}
+			break
+		}
+		changes = pending
+	}
+
+	p.state.Cursor = cursor
+	return nil
+}
+
+// folderPath returns the path of the folder with the given ID relative to
+// the mirrored folder.
+func (p *puller) folderPath(id string) (string, bool) {
+	if id == "" {
+		return "", false
+	}
+	if id == p.state.RootID {
+		return ".", true
+	}
+	if it, ok := p.state.Items[id]; ok && it.IsDir {
+		return it.Path, true
+	}
+	return "", false
+}
+
+// apply brings the mirror copy of one object up to date: it is moved if
+// it was renamed and downloaded if its content changed.
+func (p *puller) apply(ctx context.Context, key, rel string, object storage.RemoteObject) error {
+	local := rel + object.Metadata[storage.MetaExportExtension]
+	if isReserved(local) {
+		return nil
+	}
+
+	old, known := p.state.Items[key]
+	if known && old.Local != local {
+		if err := p.move(old, rel, local); err != nil {
+			return err
+		}
+	}
+
+	target := filepath.Join(p.dir, filepath.FromSlash(local))
+	if object.IsDir {
+		if err := os.MkdirAll(target, 0755); err != nil {
+			return fmt.Errorf("failed to create folder: %w", err)
+		}
+		p.state.Items[key] = &item{Path: rel, Local: local, IsDir: true, ModTime: object.ModTime}
+		return nil
+	}
+
+	if known && old.Size == object.Size && old.Hash == object.Hash && old.ModTime.Equal(object.ModTime) {
+		if _, err := os.Stat(target); err == nil {
+			return nil
+		}
+	}
+
+	if err := p.download(ctx, rel, target, object.ModTime); err != nil {
+		if errors.Is(err, storage.ErrUnsupported) {
+			p.result.Skipped++
+			return nil
+		}
+		return err
+	}
+	p.result.Downloaded++
+	p.state.Items[key] = &item{
+		Path:    rel,
+		Local:   local,
+		Size:    object.Size,
+		ModTime: object.ModTime,
+		Hash:    object.Hash,
+	}
+	return nil
+}
+
+// download fetches a file next to its final place and renames it over
+// the old copy, so an interrupted run never leaves a truncated file.
+func (p *puller) download(ctx context.Context, rel, target string, modTime time.Time) error {
+	tmp := filepath.Join(filepath.Dir(target), "."+filepath.Base(target)+".part")
+	defer os.Remove(tmp)
+
+	if err := p.provider.Download(ctx, tmp, path.Join(p.remotePath, rel)); err != nil {
+		return fmt.Errorf("failed to download %s: %w", rel, err)
+	}
+	if !modTime.IsZero() {
+		os.Chtimes(tmp, modTime, modTime)
+	}
+	if err := os.Rename(tmp, target); err != nil {
+		return fmt.Errorf("failed to store %s: %w", rel, err)
+	}
+	return nil
+}
+
+// move follows a rename or move on the remote. Moving a folder moves
+// everything below it, so the paths of its contents are updated too.
+func (p *puller) move(old *item, rel, local string) error {
+	from := filepath.Join(p.dir, filepath.FromSlash(old.Local))
+	to := filepath.Join(p.dir, filepath.FromSlash(local))
+	if err := os.MkdirAll(filepath.Dir(to), 0755); err != nil {
+		return fmt.Errorf("failed to create folder: %w", err)
+	}
+	if err := os.Rename(from, to); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to move %s: %w", old.Local, err)
+	}
+
+	if old.IsDir {
+		for _, it := range p.state.Items {
+			if it != old && strings.HasPrefix(it.Path, old.Path+"/") {
+				it.Path = rel + strings.TrimPrefix(it.Path, old.Path)
+				it.Local = local + strings.TrimPrefix(it.Local, old.Local)
+			}
+		}
+	}
+	old.Path, old.Local = rel, local
+	p.result.Moved++
+	return nil
+}
+
+// remove moves the copy of an object deleted from the source into this
+// run's folder below DeletedDir.
+func (p *puller) remove(key string) error {
+	old, ok := p.state.Items[key]
+	if !ok {
+		return nil
+	}
+
+	from := filepath.Join(p.dir, filepath.FromSlash(old.Local))
+	to := filepath.Join(p.dir, DeletedDir, p.started.Format(deletedStamp), filepath.FromSlash(old.Local))
+	if _, err := os.Stat(from); err == nil {
+		if err := os.MkdirAll(filepath.Dir(to), 0755); err != nil {
+			return fmt.Errorf("failed to create folder: %w", err)
+		}
+		if err := os.Rename(from, to); err != nil {
+			return fmt.Errorf("failed to set aside %s: %w", old.Local, err)
+		}
+	}
+
+	delete(p.state.Items, key)
+	if old.IsDir {
+		for k, it := range p.state.Items {
+			if strings.HasPrefix(it.Path, old.Path+"/") {
+				delete(p.state.Items, k)
+			}
+		}
+	}
+	p.result.Removed++
+	return nil
+}
+
+// relative returns remotePath relative to the mirrored folder.
+func (p *puller) relative(remotePath string) string {
+	if p.remotePath == "." {
+		return remotePath
+	}
+	return strings.TrimPrefix(remotePath, p.remotePath+"/")
+}
+
+// isReserved reports whether a remote object would land in DeletedDir.
+func isReserved(local string) bool {
+	return local == DeletedDir || strings.HasPrefix(local, DeletedDir+"/")
+}
+
+// purgeDeleted drops the folders below DeletedDir older than keep.
+func purgeDeleted(dir string, now time.Time, keep time.Duration) error {
+	if keep == 0 {
+		return nil
+	}
+	entries, err := os.ReadDir(filepath.Join(dir, DeletedDir))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to read deleted files: %w", err)
+	}
+	for _, entry := range entries {
+		stamp, err := time.ParseInLocation(deletedStamp, entry.Name(), now.Location())
+		if err != nil || now.Sub(stamp) < keep {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(dir, DeletedDir, entry.Name())); err != nil {
+			return fmt.Errorf("failed to purge deleted files: %w", err)
+		}
+	}
+	return nil
+}
+
+func loadState(statePath string) (*state, error) {
+	s := &state{Items: make(map[string]*item)}
+	data, err := os.ReadFile(statePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return s, nil
+		}
+		return nil, fmt.Errorf("failed to read mirror state: %w", err)
+	}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("failed to parse mirror state: %w", err)
+	}
+	if s.Items == nil {
+		s.Items = make(map[string]*item)
+	}
+	return s, nil
+}
+
+func saveState(statePath string, s *state) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return fmt.Errorf("failed to encode mirror state: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(statePath), 0700); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+	tmp := statePath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write mirror state: %w", err)
+	}
+	if err := os.Rename(tmp, statePath); err != nil {
+		return fmt.Errorf("failed to write mirror state: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,277 @@
+package mirror
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/amankumarsingh77/automated_backup_tool/internal/storage"
+	"github.com/amankumarsingh77/automated_backup_tool/internal/storage/local"
+)
+
+// fakeDrive is an ID addressed store with a change feed, like Google Drive
+// and OneDrive.
+type fakeDrive struct {
+	objects   map[string]*fakeObject
+	changes   []storage.Change
+	downloads int
+}
+
+type fakeObject struct {
+	id, parent, name string
+	dir              bool
+	content          string
+	modTime          time.Time
+	mimeType         string
+}
+
+func newFakeDrive() *fakeDrive {
+	return &fakeDrive{objects: map[string]*fakeObject{"root": {id: "root", dir: true}}}
+}
+
+func (f *fakeDrive) put(id, parent, name, content string) {
+	f.putDocument(id, parent, name, content, "")
+}
+
+// putDocument stores a cloud document, which is exported on download.
+func (f *fakeDrive) putDocument(id, parent, name, content, mimeType string) {
+	o := &fakeObject{id: id, parent: parent, name: name, content: content, modTime: time.Now(), mimeType: mimeType}
+	f.objects[id] = o
+	f.changes = append(f.changes, storage.Change{ID: id, Object: f.object(o, name), ParentID: parent})
+}
+
+func (f *fakeDrive) mkdir(id, parent, name string) {
+	f.put(id, parent, name, "")
+	f.objects[id].dir = true
+	f.changes[len(f.changes)-1].Object.IsDir = true
+}
+
+func (f *fakeDrive) move(id, parent string) {
+	o := f.objects[id]
+	o.parent = parent
+	f.changes = append(f.changes, storage.Change{ID: id, Object: f.object(o, o.name), ParentID: parent})
+}
+
+func (f *fakeDrive) remove(id string) {
+	delete(f.objects, id)
+	f.changes = append(f.changes, storage.Change{ID: id, Removed: true})
+}
+
+func (f *fakeDrive) path(o *fakeObject) string {
+	if o.id == "root" {
+		return "."
+	}
+	return path.Join(f.path(f.objects[o.parent]), o.name)
+}
+
+func (f *fakeDrive) object(o *fakeObject, p string) storage.RemoteObject {
+	object := storage.RemoteObject{
+		Path:     p,
+		ID:       o.id,
+		Size:     int64(len(o.content)),
+		ModTime:  o.modTime,
+		IsDir:    o.dir,
+		Metadata: map[string]string{},
+	}
+	if o.mimeType == "document" {
+		object.Metadata[storage.MetaExportExtension] = ".docx"
+	}
+	return object
+}
+
+func (f *fakeDrive) find(remotePath string) (*fakeObject, error) {
+	for _, o := range f.objects {
+		if f.path(o) == storage.CleanPath(remotePath) {
+			return o, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", storage.ErrNotFound, remotePath)
+}
+
+func (f *fakeDrive) Authenticate(ctx context.Context) error { return nil }
+func (f *fakeDrive) Upload(ctx context.Context, localPath, remotePath string) error {
+	return storage.ErrUnsupported
+}
+func (f *fakeDrive) Delete(ctx context.Context, remotePath string) error {
+	return storage.ErrUnsupported
+}
+
+func (f *fakeDrive) Download(ctx context.Context, localPath, remotePath string) error {
+	o, err := f.find(remotePath)
+	if err != nil {
+		return err
+	}
+	if o.mimeType == "form" {
+		return fmt.Errorf("%w: forms cannot be exported", storage.ErrUnsupported)
+	}
+	f.downloads++
+	return os.WriteFile(localPath, []byte(o.content), 0600)
+}
+
+func (f *fakeDrive) Stat(ctx context.Context, remotePath string) (storage.RemoteObject, error) {
+	o, err := f.find(remotePath)
+	if err != nil {
+		return storage.RemoteObject{}, err
+	}
+	return f.object(o, f.path(o)), nil
+}
+
+func (f *fakeDrive) ListFiles(ctx context.Context, remotePath string) ([]storage.RemoteObject, error) {
+	var objects []storage.RemoteObject
+	for _, o := range f.objects {
+		if p := f.path(o); o.id != "root" && path.Dir(p) == storage.CleanPath(remotePath) {
+			objects = append(objects, f.object(o, p))
+			if o.dir {
+				below, _ := f.ListFiles(ctx, p)
+				objects = append(objects, below...)
+			}
+		}
+	}
+	return objects, nil
+}
+
+func (f *fakeDrive) Changes(ctx context.Context, remotePath, cursor string) ([]storage.Change, string, error) {
+	if cursor == "" {
+		return nil, strconv.Itoa(len(f.changes)), nil
+	}
+	n, _ := strconv.Atoi(cursor)
+	return f.changes[n:], strconv.Itoa(len(f.changes)), nil
+}
+
+func readFile(t *testing.T, name string) string {
+	t.Helper()
+	data, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", name, err)
+	}
+	return string(data)
+}
+
+func TestPullFollowsChanges(t *testing.T) {
+	ctx := context.Background()
+	drive := newFakeDrive()
+	drive.mkdir("team", "root", "Team")
+	drive.put("plan", "team", "plan.txt", "v1")
+	drive.putDocument("notes", "team", "Notes", "doc", "document")
+	drive.putDocument("survey", "team", "Survey", "", "form")
+
+	dir := t.TempDir()
+	statePath := filepath.Join(t.TempDir(), "state.json")
+
+	result, err := Pull(ctx, drive, "/", dir, statePath, Options{})
+	if err != nil {
+		t.Fatalf("Failed to pull: %v", err)
+	}
+	if !result.Full || result.Downloaded != 2 || result.Skipped != 1 {
+		t.Errorf("Unexpected first run: %+v", result)
+	}
+	if readFile(t, filepath.Join(dir, "Team", "plan.txt")) != "v1" {
+		t.Error("plan.txt not copied")
+	}
+	if readFile(t, filepath.Join(dir, "Team", "Notes.docx")) != "doc" {
+		t.Error("Exported document not stored with its extension")
+	}
+
+	drive.put("plan", "team", "plan.txt", "v2")
+	drive.mkdir("archive", "root", "Archive")
+	drive.move("notes", "archive")
+	drive.remove("survey")
+	downloads := drive.downloads
+
+	result, err = Pull(ctx, drive, "/", dir, statePath, Options{})
+	if err != nil {
+		t.Fatalf("Failed to pull changes: %v", err)
+	}
+	if result.Full || result.Downloaded != 1 || result.Moved != 1 {
+		t.Errorf("Unexpected incremental run: %+v", result)
+	}
+	if drive.downloads != downloads+1 {
+		t.Errorf("Expected only the changed file to be downloaded, got %d downloads", drive.downloads-downloads)
+	}
+	if readFile(t, filepath.Join(dir, "Team", "plan.txt")) != "v2" {
+		t.Error("Changed file not updated")
+	}
+	if readFile(t, filepath.Join(dir, "Archive", "Notes.docx")) != "doc" {
+		t.Error("Moved document not followed")
+	}
+}
+
+func TestPullSetsDeletedFilesAside(t *testing.T) {
+	ctx := context.Background()
+	drive := newFakeDrive()
+	drive.mkdir("team", "root", "Team")
+	drive.put("budget", "team", "budget.xlsx", "numbers")
+
+	dir := t.TempDir()
+	statePath := filepath.Join(t.TempDir(), "state.json")
+	if _, err := Pull(ctx, drive, "/", dir, statePath, Options{}); err != nil {
+		t.Fatalf("Failed to pull: %v", err)
+	}
+
+	drive.remove("team")
+	drive.remove("budget")
+	result, err := Pull(ctx, drive, "/", dir, statePath, Options{KeepDeleted: time.Hour})
+	if err != nil {
+		t.Fatalf("Failed to pull changes: %v", err)
+	}
+	if result.Removed != 1 {
+		t.Errorf("Expected the folder to be removed once, got %+v", result)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "Team")); !os.IsNotExist(err) {
+		t.Error("Deleted folder still in the mirror")
+	}
+
+	matches, _ := filepath.Glob(filepath.Join(dir, DeletedDir, "*", "Team", "budget.xlsx"))
+	if len(matches) != 1 || readFile(t, matches[0]) != "numbers" {
+		t.Fatalf("Deleted file not kept below %s: %v", DeletedDir, matches)
+	}
+
+	old := filepath.Join(dir, DeletedDir, time.Now().Add(-2*time.Hour).Format(deletedStamp))
+	if err := os.Rename(filepath.Dir(filepath.Dir(matches[0])), old); err != nil {
+		t.Fatalf("Failed to age deleted files: %v", err)
+	}
+	if _, err := Pull(ctx, drive, "/", dir, statePath, Options{KeepDeleted: time.Hour}); err != nil {
+		t.Fatalf("Failed to pull: %v", err)
+	}
+	if _, err := os.Stat(old); !os.IsNotExist(err) {
+		t.Error("Deleted files older than KeepDeleted were not purged")
+	}
+}
+
+func TestPullWithoutChangeFeed(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "share", "docs"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "share", "docs", "a.txt"), []byte("a"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	provider := local.NewLocalProvider(root)
+	dir := t.TempDir()
+	statePath := filepath.Join(t.TempDir(), "state.json")
+	if _, err := Pull(ctx, provider, "share", dir, statePath, Options{}); err != nil {
+		t.Fatalf("Failed to pull: %v", err)
+	}
+	if readFile(t, filepath.Join(dir, "docs", "a.txt")) != "a" {
+		t.Fatal("File not copied")
+	}
+
+	os.Remove(filepath.Join(root, "share", "docs", "a.txt"))
+	result, err := Pull(ctx, provider, "share", dir, statePath, Options{})
+	if err != nil {
+		t.Fatalf("Failed to pull: %v", err)
+	}
+	if !result.Full || result.Removed != 1 || result.Downloaded != 0 {
+		t.Errorf("Unexpected second run: %+v", result)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "docs", "a.txt")); !os.IsNotExist(err) {
+		t.Error("File removed from the source still in the mirror")
+	}
+}
@@ -0,0 +1,104 @@
+// Package naming expands the templates naming the archive a backup run
+// uploads, such as "{task}/{date:2006-01-02T150405}-{host}.tar.gz", so
+// that runs accumulate as distinct objects instead of replacing the
+// previous one.
+package naming
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+)
+
+// DefaultDateLayout formats {date} when the placeholder gives no layout.
+const DefaultDateLayout = "2006-01-02T150405"
+
+// Vars are the values the placeholders of a template expand to.
+type Vars struct {
+	// Task is the task name, or its ID when it has none: {task}.
+	Task string
+	// TaskID is the task ID: {id}.
+	TaskID string
+	// Host is the name of the machine running the backup: {host}.
+	Host string
+	// Source is the base name of the backed up file or folder: {source}.
+	Source string
+	// Ext holds the extensions compression and encryption added to the
+	// archive, such as ".gz.encrypted": {ext}.
+	Ext string
+	// Time is when the run started: {date} or {date:LAYOUT}, with LAYOUT
+	// in the notation of the time package.
+	Time time.Time
+}
+
+// Expand returns the remote name template gives for vars. The name is
+// relative to the destination of the task and may contain folders.
+func Expand(template string, vars Vars) (string, error) {
+	var b strings.Builder
+	rest := template
+	for {
+		start := strings.IndexByte(rest, '{')
+		if start < 0 {
+			b.WriteString(rest)
+			break
+		}
+		end := strings.IndexByte(rest[start:], '}')
+		if end < 0 {
+			return "", fmt.Errorf("invalid name template %q: unclosed {", template)
+		}
+		b.WriteString(rest[:start])
+
+		name, layout, hasLayout := strings.Cut(rest[start+1:start+end], ":")
+		switch name {
+		case "task":
+			b.WriteString(element(vars.Task))
+		case "id":
+			b.WriteString(element(vars.TaskID))
+		case "host":
+			b.WriteString(element(vars.Host))
+		case "source":
+			b.WriteString(element(vars.Source))
+		case "ext":
+			b.WriteString(element(vars.Ext))
+		case "date":
+			if !hasLayout {
+				layout = DefaultDateLayout
+			} else if layout == "" {
+				return "", fmt.Errorf("invalid name template %q: empty date layout", template)
+			}
+			b.WriteString(vars.Time.Format(layout))
+		default:
+			return "", fmt.Errorf("invalid name template %q: unknown placeholder {%s}", template, name)
+		}
+		if hasLayout && name != "date" {
+			return "", fmt.Errorf("invalid name template %q: {%s} takes no layout", template, name)
+		}
+		rest = rest[start+end+1:]
+	}
+
+	name := b.String()
+	if strings.HasSuffix(name, "/") {
+		return "", fmt.Errorf("invalid name template %q: it names a folder, not a file", template)
+	}
+	name = path.Clean(strings.TrimPrefix(name, "/"))
+	if name == "." || name == ".." || strings.HasPrefix(name, "../") {
+		return "", fmt.Errorf("invalid name template %q: the name must stay below the destination", template)
+	}
+	return name, nil
+}
+
+// Validate checks that template is well formed.
+func Validate(template string) error {
+	if template == "" {
+		return errors.New("name template is empty")
+	}
+	_, err := Expand(template, Vars{Task: "task", TaskID: "id", Host: "host", Source: "source", Time: time.Now()})
+	return err
+}
+
+// element makes a value safe to use within one path element.
+func element(value string) string {
+	return strings.NewReplacer("/", "-", "\\", "-").Replace(value)
+}
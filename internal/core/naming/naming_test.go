@@ -0,0 +1,53 @@
+package naming
+
+import (
+	"testing"
+	"time"
+)
+
+func TestExpand(t *testing.T) {
+	vars := Vars{
+		Task:   "documents",
+		TaskID: "3ce2176d",
+		Host:   "web/01",
+		Source: "src",
+		Ext:    ".encrypted.gz",
+		Time:   time.Date(2024, 5, 1, 2, 3, 4, 0, time.UTC),
+	}
+
+	tests := []struct {
+		template string
+		want     string
+	}{
+		{"{task}/{date:2006-01-02T150405}-{host}.tar.gz.enc", "documents/2024-05-01T020304-web-01.tar.gz.enc"},
+		{"{source}-{date}{ext}", "src-2024-05-01T020304.encrypted.gz"},
+		{"{date:2006/01}/{id}.gz", "2024/05/3ce2176d.gz"},
+		{"/fixed.gz", "fixed.gz"},
+	}
+	for _, tt := range tests {
+		got, err := Expand(tt.template, vars)
+		if err != nil {
+			t.Errorf("Expand(%q) failed: %v", tt.template, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Expand(%q) = %q, want %q", tt.template, got, tt.want)
+		}
+	}
+}
+
+func TestValidateRejects(t *testing.T) {
+	for _, template := range []string{
+		"",
+		"{task",
+		"{name}.gz",
+		"{host:x}.gz",
+		"{date:}.gz",
+		"{task}/",
+		"../{task}.gz",
+	} {
+		if err := Validate(template); err == nil {
+			t.Errorf("Validate(%q) accepted an invalid template", template)
+		}
+	}
+}
@@ -0,0 +1,307 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// Tree is a stored directory. Its ID is the hash of its JSON encoding, so
+// an unchanged directory is stored only once.
+type Tree struct {
+	Nodes []Node `json:"nodes"`
+}
+
+// Node is an entry of a tree.
+type Node struct {
+	Name    string      `json:"name"`
+	Type    string      `json:"type"`
+	Mode    fs.FileMode `json:"mode"`
+	ModTime time.Time   `json:"mtime"`
+	Size    int64       `json:"size,omitempty"`
+	// Content lists the data blobs of a file in order.
+	Content []string `json:"content,omitempty"`
+	// Subtree is the tree of a directory.
+	Subtree    string `json:"subtree,omitempty"`
+	LinkTarget string `json:"link_target,omitempty"`
+}
+
+// Node types.
+const (
+	NodeFile    = "file"
+	NodeDir     = "dir"
+	NodeSymlink = "symlink"
+)
+
+// Stats describe what a backup stored.
+type Stats struct {
+	Files int
+	// Bytes is the size of all file data, NewBytes the part of it that
+	// was not in the repository yet.
+	Bytes    int64
+	NewBytes int64
+	Blobs    int
+	NewBlobs int
+	Packs    int
+	// Entries lists what the backup holds, parents before their contents,
+	// so callers need not read the source again to describe it.
+	Entries []Entry
+}
+
+// Entry describes a stored file, directory or symlink. Path is relative to
+// the source and slash separated; a single file source has its base name
+// as the only path.
+type Entry struct {
+	Path    string
+	Mode    fs.FileMode
+	ModTime time.Time
+	Size    int64
+	// SHA256 is the hex encoded hash of the contents of a file.
+	SHA256 string
+}
+
+// packer fills a pack file.
+type packer struct {
+	buf   bytes.Buffer
+	blobs []packBlob
+}
+
+// backup holds the state of one Backup call: the packs being filled and the
+// blobs added to them. Trees and file data go to separate packs, so reading
+// the trees, as Prune does, does not download file data.
+type backup struct {
+	repo    *Repository
+	stats   Stats
+	packers map[BlobType]*packer
+	pending map[string]bool
+	// exclude lists the relative paths of the source not to store.
+	exclude []string
+}
+
+func newBackup(r *Repository) *backup {
+	return &backup{
+		repo:    r,
+		packers: map[BlobType]*packer{DataBlob: {}, TreeBlob: {}},
+		pending: make(map[string]bool),
+	}
+}
+
+// Backup stores the file or directory at source and returns the ID of the
+// tree describing it. A directory becomes the root tree; a single file
+// becomes the only node of the root tree. The entries of a directory whose
+// relative path is in exclude are not stored, along with their contents.
+func (r *Repository) Backup(ctx context.Context, source string, exclude ...string) (string, Stats, error) {
+	b := newBackup(r)
+	b.exclude = exclude
+
+	info, err := os.Lstat(source)
+	if err != nil {
+		return "", Stats{}, fmt.Errorf("failed to stat source: %w", err)
+	}
+	var root string
+	if info.IsDir() {
+		root, err = b.saveDir(ctx, source, "")
+	} else {
+		var node Node
+		if node, err = b.saveNode(ctx, source, info.Name(), info); err == nil {
+			root, err = b.saveTree(ctx, Tree{Nodes: []Node{node}})
+		}
+	}
+	if err != nil {
+		return "", b.stats, err
+	}
+
+	if err := b.flush(ctx); err != nil {
+		return "", b.stats, err
+	}
+	return root, b.stats, nil
+}
+
+// saveDir stores the directory dir, found at the relative path rel of the
+// source.
+func (b *backup) saveDir(ctx context.Context, dir, rel string) (string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", fmt.Errorf("failed to read directory: %w", err)
+	}
+
+	tree := Tree{Nodes: []Node{}}
+	for _, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return "", err
+		}
+		if !info.IsDir() && !info.Mode().IsRegular() && info.Mode()&fs.ModeSymlink == 0 {
+			// Sockets, devices and pipes hold no data to back up.
+			continue
+		}
+		if slices.Contains(b.exclude, path.Join(rel, entry.Name())) {
+			continue
+		}
+		node, err := b.saveNode(ctx, filepath.Join(dir, entry.Name()), path.Join(rel, entry.Name()), info)
+		if err != nil {
+			return "", err
+		}
+		tree.Nodes = append(tree.Nodes, node)
+	}
+	return b.saveTree(ctx, tree)
+}
+
+func (b *backup) saveNode(ctx context.Context, name, rel string, info fs.FileInfo) (Node, error) {
+	node := Node{
+		Name:    info.Name(),
+		Mode:    info.Mode(),
+		ModTime: info.ModTime().UTC(),
+	}
+	entry := len(b.stats.Entries)
+	b.stats.Entries = append(b.stats.Entries, Entry{Path: rel, Mode: node.Mode, ModTime: node.ModTime})
+
+	var err error
+	switch {
+	case info.IsDir():
+		node.Type = NodeDir
+		node.Subtree, err = b.saveDir(ctx, name, rel)
+	case info.Mode()&fs.ModeSymlink != 0:
+		node.Type = NodeSymlink
+		node.LinkTarget, err = os.Readlink(name)
+	default:
+		node.Type = NodeFile
+		node.Size = info.Size()
+		b.stats.Entries[entry].Size = node.Size
+		node.Content, b.stats.Entries[entry].SHA256, err = b.saveFileData(ctx, name)
+		b.stats.Files++
+	}
+	if err != nil {
+		return Node{}, err
+	}
+	return node, nil
+}
+
+// saveFileData stores the contents of the file name and returns the IDs of
+// its data blobs and the hash of the whole file.
+func (b *backup) saveFileData(ctx context.Context, name string) ([]string, string, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, "", err
+	}
+	defer file.Close()
+
+	content := []string{}
+	hash := sha256.New()
+	chunker := NewChunker(io.TeeReader(file, hash), b.repo.config.Chunker)
+	for {
+		chunk, err := chunker.Next()
+		if err == io.EOF {
+			return content, hex.EncodeToString(hash.Sum(nil)), nil
+		}
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		id, err := b.saveBlob(ctx, DataBlob, chunk)
+		if err != nil {
+			return nil, "", err
+		}
+		b.stats.Bytes += int64(len(chunk))
+		content = append(content, id)
+	}
+}
+
+func (b *backup) saveTree(ctx context.Context, tree Tree) (string, error) {
+	data, err := json.Marshal(tree)
+	if err != nil {
+		return "", err
+	}
+	return b.saveBlob(ctx, TreeBlob, data)
+}
+
+// saveBlob adds data to the current pack unless the repository already
+// stores it, and returns its ID.
+func (b *backup) saveBlob(ctx context.Context, typ BlobType, data []byte) (string, error) {
+	id := hash(data)
+	b.stats.Blobs++
+	if b.repo.Has(id) || b.pending[id] {
+		return id, nil
+	}
+	b.stats.NewBlobs++
+	if typ == DataBlob {
+		b.stats.NewBytes += int64(len(data))
+	}
+	return id, b.addBlob(ctx, typ, id, data)
+}
+
+// addBlob adds the blob id to the current pack of its type, uploading the
+// pack once it is full.
+func (b *backup) addBlob(ctx context.Context, typ BlobType, id string, data []byte) error {
+	p := b.packers[typ]
+	p.blobs = append(p.blobs, packBlob{ID: id, Type: typ, Offset: int64(p.buf.Len()), Length: int64(len(data))})
+	p.buf.Write(data)
+	b.pending[id] = true
+
+	if p.buf.Len() >= b.repo.packSize {
+		return b.flushPacker(ctx, p)
+	}
+	return nil
+}
+
+// flush uploads the packs being filled.
+func (b *backup) flush(ctx context.Context) error {
+	for _, typ := range []BlobType{DataBlob, TreeBlob} {
+		if err := b.flushPacker(ctx, b.packers[typ]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// flushPacker uploads the pack of p and an index file listing it. The list
+// of its blobs is appended to the pack, followed by the length of the list
+// as a 32 bit integer. Indexing every pack as soon as it is uploaded leaves
+// nothing unindexed when a backup fails partway: the next backup reuses
+// the blobs already uploaded, and Prune sees them. Prune merges the index
+// files into one.
+func (b *backup) flushPacker(ctx context.Context, p *packer) error {
+	if len(p.blobs) == 0 {
+		return nil
+	}
+
+	header, err := json.Marshal(p.blobs)
+	if err != nil {
+		return err
+	}
+	p.buf.Write(header)
+	binary.Write(&p.buf, binary.LittleEndian, uint32(len(header)))
+
+	data, err := b.repo.encrypt(p.buf.Bytes())
+	if err != nil {
+		return fmt.Errorf("failed to encrypt pack: %w", err)
+	}
+	id := hash(data)
+	if err := b.repo.upload(ctx, b.repo.packPath(id), data); err != nil {
+		return fmt.Errorf("failed to upload pack %s: %w", id[:8], err)
+	}
+
+	entry := packEntry{ID: id, Blobs: p.blobs}
+	if _, err := b.repo.writeIndex(ctx, []packEntry{entry}); err != nil {
+		return err
+	}
+	b.repo.addToIndex([]packEntry{entry})
+	b.stats.Packs++
+
+	p.buf.Reset()
+	p.blobs = nil
+	return nil
+}
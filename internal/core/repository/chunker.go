@@ -0,0 +1,103 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/bits"
+)
+
+// ChunkerParams bound the size of the chunks file data is cut into. Cut
+// points depend on the content only, so data inserted into a file moves
+// the chunk boundaries near the change and leaves all others in place.
+type ChunkerParams struct {
+	Min int `json:"min"`
+	Avg int `json:"avg"`
+	Max int `json:"max"`
+}
+
+// DefaultChunkerParams are used for new repositories.
+var DefaultChunkerParams = ChunkerParams{Min: 512 << 10, Avg: 1 << 20, Max: 8 << 20}
+
+func (p ChunkerParams) validate() error {
+	if p.Min <= 0 || p.Avg < p.Min || p.Max < p.Avg || p.Avg&(p.Avg-1) != 0 {
+		return fmt.Errorf("invalid chunker parameters %+v: need 0 < min <= avg <= max with avg a power of two", p)
+	}
+	return nil
+}
+
+// gear holds a random value per byte value for the rolling hash. The table
+// is part of the repository format and must never change.
+var gear = func() [256]uint64 {
+	var table [256]uint64
+	state := uint64(0x6261636b75702d31)
+	for i := range table {
+		// splitmix64
+		state += 0x9e3779b97f4a7c15
+		z := state
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		table[i] = z ^ (z >> 31)
+	}
+	return table
+}()
+
+// Chunker cuts a stream into content defined chunks with a gear hash, as
+// in FastCDC. A cut is made where the top bits of the hash are zero, which
+// happens on average every Avg bytes.
+type Chunker struct {
+	r      io.Reader
+	params ChunkerParams
+	mask   uint64
+	buf    []byte
+	n      int
+	eof    bool
+}
+
+// NewChunker returns a chunker reading from r.
+func NewChunker(r io.Reader, params ChunkerParams) *Chunker {
+	maskBits := bits.Len(uint(params.Avg)) - 1
+	return &Chunker{
+		r:      r,
+		params: params,
+		mask:   ((uint64(1) << maskBits) - 1) << (64 - maskBits),
+		buf:    make([]byte, params.Max),
+	}
+}
+
+// Next returns the next chunk, or io.EOF after the last one.
+func (c *Chunker) Next() ([]byte, error) {
+	if !c.eof && c.n < len(c.buf) {
+		n, err := io.ReadFull(c.r, c.buf[c.n:])
+		c.n += n
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			c.eof = true
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	if c.n == 0 {
+		return nil, io.EOF
+	}
+
+	cut := c.cut(c.buf[:c.n])
+	chunk := make([]byte, cut)
+	copy(chunk, c.buf[:cut])
+	c.n = copy(c.buf, c.buf[cut:c.n])
+	return chunk, nil
+}
+
+// cut returns the length of the chunk at the start of data.
+func (c *Chunker) cut(data []byte) int {
+	if len(data) <= c.params.Min {
+		return len(data)
+	}
+	var hash uint64
+	for i := c.params.Min; i < len(data); i++ {
+		hash = (hash << 1) + gear[data[i]]
+		if hash&c.mask == 0 {
+			return i + 1
+		}
+	}
+	return len(data)
+}
@@ -0,0 +1,60 @@
+package repository
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"testing"
+)
+
+var testParams = ChunkerParams{Min: 1 << 10, Avg: 4 << 10, Max: 16 << 10}
+
+func chunks(t *testing.T, data []byte) [][]byte {
+	t.Helper()
+	var result [][]byte
+	chunker := NewChunker(bytes.NewReader(data), testParams)
+	for {
+		chunk, err := chunker.Next()
+		if err == io.EOF {
+			return result
+		}
+		if err != nil {
+			t.Fatalf("Failed to chunk: %v", err)
+		}
+		result = append(result, chunk)
+	}
+}
+
+func TestChunkerBoundariesFollowContent(t *testing.T) {
+	data := make([]byte, 256<<10)
+	rand.New(rand.NewSource(1)).Read(data)
+
+	original := chunks(t, data)
+	if !bytes.Equal(bytes.Join(original, nil), data) {
+		t.Fatal("Chunks do not add up to the input")
+	}
+	for i, chunk := range original {
+		if len(chunk) > testParams.Max || (len(chunk) < testParams.Min && i != len(original)-1) {
+			t.Errorf("Chunk %d has size %d outside the bounds", i, len(chunk))
+		}
+	}
+	if len(original) < 16 {
+		t.Errorf("Expected about 64 chunks, got %d", len(original))
+	}
+
+	// Inserting bytes at the start only changes the chunks near it.
+	shifted := chunks(t, append([]byte("inserted"), data...))
+	known := make(map[string]bool)
+	for _, chunk := range original {
+		known[string(chunk)] = true
+	}
+	reused := 0
+	for _, chunk := range shifted {
+		if known[string(chunk)] {
+			reused++
+		}
+	}
+	if reused < len(original)-2 {
+		t.Errorf("Only %d of %d chunks reused after an insert", reused, len(original))
+	}
+}
@@ -0,0 +1,172 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/amankumarsingh77/automated_backup_tool/internal/storage"
+)
+
+// repackThreshold is the share of unused bytes from which Prune rewrites a
+// pack instead of keeping it as it is.
+const repackThreshold = 0.5
+
+// PruneStats summarizes a Prune call.
+type PruneStats struct {
+	Blobs    int   // unused blobs removed
+	Bytes    int64 // bytes of the unused blobs removed
+	Deleted  int   // packs deleted because none of their blobs is used
+	Repacked int   // packs rewritten with only their used blobs
+}
+
+// Prune removes the blobs none of the trees in keep references. Packs
+// without a used blob are deleted, packs mostly holding unused blobs are
+// rewritten with the used ones, and the index files are replaced by one
+// listing the remaining packs. Unused blobs in other packs stay until more
+// of their pack is unused. With dryRun set nothing is changed, and the
+// stats tell what would be removed. No backup may write to the repository
+// meanwhile.
+func (r *Repository) Prune(ctx context.Context, keep []string, dryRun bool) (PruneStats, error) {
+	var stats PruneStats
+	res, err := r.newRestore()
+	if err != nil {
+		return stats, err
+	}
+	defer os.RemoveAll(res.dir)
+
+	used := make(map[string]bool)
+	for _, tree := range keep {
+		if err := res.markTree(ctx, tree, used); err != nil {
+			return stats, err
+		}
+	}
+
+	var deleted, repack []string
+	for id, blobs := range r.packs {
+		var total, unused int64
+		for _, blob := range blobs {
+			total += blob.Length
+			if !used[blob.ID] {
+				unused += blob.Length
+			}
+		}
+		switch {
+		case unused == total:
+			deleted = append(deleted, id)
+		case float64(unused) >= repackThreshold*float64(total):
+			repack = append(repack, id)
+		default:
+			continue
+		}
+		for _, blob := range blobs {
+			if !used[blob.ID] {
+				stats.Blobs++
+				stats.Bytes += blob.Length
+			}
+		}
+	}
+	if dryRun {
+		stats.Deleted, stats.Repacked = len(deleted), len(repack)
+		return stats, nil
+	}
+	if len(deleted) == 0 && len(repack) == 0 {
+		return stats, nil
+	}
+
+	// The used blobs of the packs being rewritten go to new packs first,
+	// then an index of all remaining packs replaces the old index files,
+	// and only then are the old packs deleted. An interrupted prune leaves
+	// blobs stored twice, but none missing.
+	b := newBackup(r)
+	for _, id := range repack {
+		for _, blob := range r.packs[id] {
+			if !used[blob.ID] || b.pending[blob.ID] {
+				continue
+			}
+			data, err := res.loadBlob(ctx, blob.ID)
+			if err != nil {
+				return stats, err
+			}
+			if err := b.addBlob(ctx, blob.Type, blob.ID, data); err != nil {
+				return stats, err
+			}
+		}
+	}
+	if err := b.flush(ctx); err != nil {
+		return stats, err
+	}
+
+	for _, id := range append(deleted, repack...) {
+		delete(r.packs, id)
+	}
+	for id, location := range r.index {
+		if _, ok := r.packs[location.pack]; !ok {
+			delete(r.index, id)
+		}
+	}
+	packs := make([]packEntry, 0, len(r.packs))
+	for id, blobs := range r.packs {
+		packs = append(packs, packEntry{ID: id, Blobs: blobs})
+	}
+	index, err := r.writeIndex(ctx, packs)
+	if err != nil {
+		return stats, err
+	}
+	for _, name := range r.indexFiles {
+		if name == index {
+			continue
+		}
+		if err := r.remove(ctx, name); err != nil {
+			return stats, fmt.Errorf("failed to delete index %s: %w", name, err)
+		}
+	}
+	r.indexFiles = []string{index}
+
+	for _, id := range deleted {
+		if err := r.remove(ctx, r.packPath(id)); err != nil {
+			return stats, fmt.Errorf("failed to delete pack %s: %w", id[:8], err)
+		}
+		stats.Deleted++
+	}
+	for _, id := range repack {
+		if err := r.remove(ctx, r.packPath(id)); err != nil {
+			return stats, fmt.Errorf("failed to delete pack %s: %w", id[:8], err)
+		}
+		stats.Repacked++
+	}
+	return stats, nil
+}
+
+// markTree marks the tree with the given ID, its subtrees and the data of
+// its files as used.
+func (res *restore) markTree(ctx context.Context, id string, used map[string]bool) error {
+	if used[id] {
+		return nil
+	}
+	tree, err := res.loadTree(ctx, id)
+	if err != nil {
+		return err
+	}
+	used[id] = true
+	for _, node := range tree.Nodes {
+		for _, blob := range node.Content {
+			used[blob] = true
+		}
+		if node.Type == NodeDir {
+			if err := res.markTree(ctx, node.Subtree, used); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// remove deletes a file of the repository, which may already be gone.
+func (r *Repository) remove(ctx context.Context, remotePath string) error {
+	if err := r.provider.Delete(ctx, remotePath); err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return err
+	}
+	return nil
+}
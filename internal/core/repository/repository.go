@@ -0,0 +1,318 @@
+// Package repository stores backups deduplicated, in the style of restic
+// and borg. File data is cut into content defined chunks, each stored once
+// under its SHA-256 hash. Chunks are bundled into pack files, so a backup of
+// many small files does not turn into as many uploads, and an index maps
+// every chunk to its pack. Directory trees are stored like chunks and
+// reference the chunks of their files, so a backup only uploads what no
+// earlier backup stored.
+//
+// A repository lives in a folder of any storage provider:
+//
+//	config            format version, chunker parameters and key check
+//	data/<xx>/<pack>  pack files, named by the hash of their contents
+//	index/<index>     where the blobs of the packs one backup wrote are
+//
+// Pack and index files are encrypted when the repository has a key. Prune
+// removes the blobs no kept snapshot references and merges the index.
+package repository
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+
+	"github.com/amankumarsingh77/automated_backup_tool/internal/security/encryption"
+	"github.com/amankumarsingh77/automated_backup_tool/internal/storage"
+	"github.com/amankumarsingh77/automated_backup_tool/internal/utils/filesystem"
+)
+
+const (
+	configFile = "config"
+	dataDir    = "data"
+	indexDir   = "index"
+
+	// formatVersion is the version of the repository layout written by
+	// this package.
+	formatVersion = 1
+
+	// defaultPackSize is the size at which a pack file is closed and
+	// uploaded.
+	defaultPackSize = 16 << 20
+
+	// keyCheck is encrypted into the config, to tell a wrong key from
+	// corrupted data.
+	keyCheck = "backup repository"
+)
+
+// ErrNoRepository is returned by Open for a folder without a repository.
+var ErrNoRepository = errors.New("no repository")
+
+// BlobType tells file data from directory trees.
+type BlobType string
+
+const (
+	DataBlob BlobType = "data"
+	TreeBlob BlobType = "tree"
+)
+
+type repoConfig struct {
+	Version   int           `json:"version"`
+	Chunker   ChunkerParams `json:"chunker"`
+	Encrypted bool          `json:"encrypted"`
+	KeyCheck  string        `json:"key_check,omitempty"`
+}
+
+// blobLocation is where a blob is stored within its pack.
+type blobLocation struct {
+	pack   string
+	typ    BlobType
+	offset int64
+	length int64
+}
+
+// Repository is an open repository.
+type Repository struct {
+	provider storage.StorageProvider
+	dir      string
+	config   repoConfig
+	// crypto encrypts pack and index files; nil for an unencrypted
+	// repository.
+	crypto *encryption.EncryptionManager
+	index  map[string]blobLocation
+	// packs lists the blobs of every indexed pack.
+	packs map[string][]packBlob
+	// indexFiles are the paths of the index files read by Open or written
+	// since.
+	indexFiles []string
+	// packSize is the size at which a pack is uploaded.
+	packSize int
+}
+
+// Init creates a repository in dir. An empty key leaves it unencrypted.
+func Init(ctx context.Context, provider storage.StorageProvider, dir, key string, params ChunkerParams) (*Repository, error) {
+	if err := params.validate(); err != nil {
+		return nil, err
+	}
+	if _, err := provider.Stat(ctx, path.Join(dir, configFile)); err == nil {
+		return nil, fmt.Errorf("a repository already exists in %s", dir)
+	} else if !errors.Is(err, storage.ErrNotFound) {
+		return nil, fmt.Errorf("failed to check for a repository: %w", err)
+	}
+
+	r := newRepository(provider, dir)
+	r.config = repoConfig{Version: formatVersion, Chunker: params, Encrypted: key != ""}
+	if key != "" {
+		var err error
+		if r.crypto, err = encryption.NewEncryptionManager(key); err != nil {
+			return nil, err
+		}
+		check, err := r.crypto.Encrypt([]byte(keyCheck))
+		if err != nil {
+			return nil, err
+		}
+		r.config.KeyCheck = string(check)
+	}
+
+	data, err := json.MarshalIndent(r.config, "", "\t")
+	if err != nil {
+		return nil, err
+	}
+	if err := r.upload(ctx, path.Join(dir, configFile), data); err != nil {
+		return nil, fmt.Errorf("failed to write repository config: %w", err)
+	}
+	return r, nil
+}
+
+// Open opens the repository in dir and reads its index. key must be the
+// key the repository was created with, or empty for an unencrypted one.
+func Open(ctx context.Context, provider storage.StorageProvider, dir, key string) (*Repository, error) {
+	r := newRepository(provider, dir)
+
+	data, err := r.download(ctx, path.Join(dir, configFile))
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, fmt.Errorf("%w in %s", ErrNoRepository, dir)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read repository config: %w", err)
+	}
+	if err := json.Unmarshal(data, &r.config); err != nil {
+		return nil, fmt.Errorf("failed to read repository config: %w", err)
+	}
+	if r.config.Version != formatVersion {
+		return nil, fmt.Errorf("unsupported repository version %d", r.config.Version)
+	}
+	if err := r.config.Chunker.validate(); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case r.config.Encrypted && key == "":
+		return nil, errors.New("the repository is encrypted, an encryption key is required")
+	case !r.config.Encrypted && key != "":
+		return nil, errors.New("the repository is not encrypted, it cannot be used with an encryption key")
+	case key != "":
+		if r.crypto, err = encryption.NewEncryptionManager(key); err != nil {
+			return nil, err
+		}
+		check, err := r.crypto.Decrypt([]byte(r.config.KeyCheck))
+		if err != nil || string(check) != keyCheck {
+			return nil, errors.New("wrong encryption key for the repository")
+		}
+	}
+
+	if err := r.loadIndex(ctx); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func newRepository(provider storage.StorageProvider, dir string) *Repository {
+	return &Repository{
+		provider: provider,
+		dir:      storage.CleanPath(dir),
+		index:    make(map[string]blobLocation),
+		packs:    make(map[string][]packBlob),
+		packSize: defaultPackSize,
+	}
+}
+
+// indexFile lists a pack written by a backup, or all packs left after
+// Prune.
+type indexFile struct {
+	Packs []packEntry `json:"packs"`
+}
+
+type packEntry struct {
+	ID    string     `json:"id"`
+	Blobs []packBlob `json:"blobs"`
+}
+
+// packBlob describes a blob within a pack. The same list is stored at the
+// end of the pack itself, so a lost index can be rebuilt from the packs.
+type packBlob struct {
+	ID     string   `json:"id"`
+	Type   BlobType `json:"type"`
+	Offset int64    `json:"offset"`
+	Length int64    `json:"length"`
+}
+
+func (r *Repository) loadIndex(ctx context.Context) error {
+	objects, err := r.provider.ListFiles(ctx, path.Join(r.dir, indexDir))
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to list index files: %w", err)
+	}
+
+	for _, object := range objects {
+		if object.IsDir {
+			continue
+		}
+		data, err := r.download(ctx, object.Path)
+		if err != nil {
+			return fmt.Errorf("failed to read index %s: %w", path.Base(object.Path), err)
+		}
+		if data, err = r.decrypt(data); err != nil {
+			return fmt.Errorf("failed to read index %s: %w", path.Base(object.Path), err)
+		}
+		var index indexFile
+		if err := json.Unmarshal(data, &index); err != nil {
+			return fmt.Errorf("failed to read index %s: %w", path.Base(object.Path), err)
+		}
+		r.addToIndex(index.Packs)
+		r.indexFiles = append(r.indexFiles, object.Path)
+	}
+	return nil
+}
+
+func (r *Repository) addToIndex(packs []packEntry) {
+	for _, pack := range packs {
+		r.packs[pack.ID] = pack.Blobs
+		for _, blob := range pack.Blobs {
+			r.index[blob.ID] = blobLocation{pack: pack.ID, typ: blob.Type, offset: blob.Offset, length: blob.Length}
+		}
+	}
+}
+
+// writeIndex uploads an index file listing packs and returns its path.
+// The packs are not added to the in-memory index.
+func (r *Repository) writeIndex(ctx context.Context, packs []packEntry) (string, error) {
+	data, err := json.Marshal(indexFile{Packs: packs})
+	if err != nil {
+		return "", err
+	}
+	if data, err = r.encrypt(data); err != nil {
+		return "", fmt.Errorf("failed to encrypt index: %w", err)
+	}
+	name := path.Join(r.dir, indexDir, hash(data))
+	if err := r.upload(ctx, name, data); err != nil {
+		return "", fmt.Errorf("failed to upload index: %w", err)
+	}
+	r.indexFiles = append(r.indexFiles, name)
+	return name, nil
+}
+
+// Has reports whether the repository stores the blob with the given ID.
+func (r *Repository) Has(id string) bool {
+	_, ok := r.index[id]
+	return ok
+}
+
+func (r *Repository) packPath(id string) string {
+	return path.Join(r.dir, dataDir, id[:2], id)
+}
+
+func (r *Repository) encrypt(data []byte) ([]byte, error) {
+	if r.crypto == nil {
+		return data, nil
+	}
+	return r.crypto.Encrypt(data)
+}
+
+func (r *Repository) decrypt(data []byte) ([]byte, error) {
+	if r.crypto == nil {
+		return data, nil
+	}
+	return r.crypto.Decrypt(data)
+}
+
+func (r *Repository) upload(ctx context.Context, remotePath string, data []byte) error {
+	temp, err := os.CreateTemp(filesystem.TempDir(), "repository-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+	_, err = temp.Write(data)
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return r.provider.Upload(ctx, temp.Name(), remotePath)
+}
+
+func (r *Repository) download(ctx context.Context, remotePath string) ([]byte, error) {
+	temp, err := os.CreateTemp(filesystem.TempDir(), "repository-*")
+	if err != nil {
+		return nil, err
+	}
+	temp.Close()
+	defer os.Remove(temp.Name())
+
+	if err := r.provider.Download(ctx, temp.Name(), remotePath); err != nil {
+		return nil, err
+	}
+	return os.ReadFile(temp.Name())
+}
+
+func hash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,291 @@
+package repository
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math/rand"
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+
+	"github.com/amankumarsingh77/automated_backup_tool/internal/storage/local"
+)
+
+func writeFile(t *testing.T, name string, data []byte) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(name, data, 0640); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBackupDeduplicatesAndRestores(t *testing.T) {
+	ctx := context.Background()
+	provider := local.NewLocalProvider(t.TempDir())
+
+	source := t.TempDir()
+	big := make([]byte, 200<<10)
+	rand.New(rand.NewSource(2)).Read(big)
+	writeFile(t, filepath.Join(source, "big.bin"), big)
+	writeFile(t, filepath.Join(source, "docs", "a.txt"), []byte("alpha"))
+	writeFile(t, filepath.Join(source, "docs", "copy.txt"), []byte("alpha"))
+
+	if _, err := Open(ctx, provider, "repo", ""); !errors.Is(err, ErrNoRepository) {
+		t.Fatalf("Expected ErrNoRepository, got %v", err)
+	}
+	repo, err := Init(ctx, provider, "repo", "", testParams)
+	if err != nil {
+		t.Fatalf("Failed to init repository: %v", err)
+	}
+	repo.packSize = 64 << 10
+
+	first, stats, err := repo.Backup(ctx, source)
+	if err != nil {
+		t.Fatalf("Failed to back up: %v", err)
+	}
+	if stats.Files != 3 || stats.NewBytes != int64(len(big))+5 || stats.Packs < 2 {
+		t.Errorf("Unexpected first backup: %+v", stats)
+	}
+	var paths []string
+	for _, entry := range stats.Entries {
+		paths = append(paths, entry.Path)
+	}
+	sum := sha256.Sum256([]byte("alpha"))
+	if fmt.Sprint(paths) != "[big.bin docs docs/a.txt docs/copy.txt]" || stats.Entries[2].SHA256 != hex.EncodeToString(sum[:]) || stats.Entries[2].Size != 5 {
+		t.Errorf("Unexpected entries: %+v", stats.Entries)
+	}
+
+	// Change a little of the big file: only the chunks around the change
+	// are stored again.
+	copy(big[100<<10:], "changed")
+	writeFile(t, filepath.Join(source, "big.bin"), big)
+
+	repo, err = Open(ctx, provider, "repo", "")
+	if err != nil {
+		t.Fatalf("Failed to open repository: %v", err)
+	}
+	second, stats, err := repo.Backup(ctx, source)
+	if err != nil {
+		t.Fatalf("Failed to back up again: %v", err)
+	}
+	if stats.NewBytes == 0 || stats.NewBytes > int64(2*testParams.Max) {
+		t.Errorf("Expected only the changed chunk to be stored, stored %d bytes", stats.NewBytes)
+	}
+
+	repo, err = Open(ctx, provider, "repo", "")
+	if err != nil {
+		t.Fatalf("Failed to open repository: %v", err)
+	}
+	target := t.TempDir()
+	if err := repo.Restore(ctx, first, filepath.Join(target, "first")); err != nil {
+		t.Fatalf("Failed to restore first backup: %v", err)
+	}
+	if err := repo.Restore(ctx, second, filepath.Join(target, "second")); err != nil {
+		t.Fatalf("Failed to restore second backup: %v", err)
+	}
+
+	restored, _ := os.ReadFile(filepath.Join(target, "second", "big.bin"))
+	if string(restored) != string(big) {
+		t.Error("Restored file does not match the second backup")
+	}
+	restored, _ = os.ReadFile(filepath.Join(target, "first", "big.bin"))
+	if string(restored[100<<10:100<<10+7]) == "changed" {
+		t.Error("First backup restored with data of the second")
+	}
+	info, err := os.Stat(filepath.Join(target, "first", "docs", "copy.txt"))
+	if err != nil || info.Mode().Perm() != 0640 {
+		t.Errorf("Restored file lost its mode: %v", err)
+	}
+}
+
+func TestEncryptedRepository(t *testing.T) {
+	ctx := context.Background()
+	provider := local.NewLocalProvider(t.TempDir())
+	source := filepath.Join(t.TempDir(), "secret.txt")
+	writeFile(t, source, []byte("top secret"))
+
+	repo, err := Init(ctx, provider, "repo", "key", testParams)
+	if err != nil {
+		t.Fatalf("Failed to init repository: %v", err)
+	}
+	tree, _, err := repo.Backup(ctx, source)
+	if err != nil {
+		t.Fatalf("Failed to back up: %v", err)
+	}
+
+	if _, err := Open(ctx, provider, "repo", "wrong"); err == nil {
+		t.Error("Opened an encrypted repository with the wrong key")
+	}
+	if _, err := Open(ctx, provider, "repo", ""); err == nil {
+		t.Error("Opened an encrypted repository without a key")
+	}
+
+	repo, err = Open(ctx, provider, "repo", "key")
+	if err != nil {
+		t.Fatalf("Failed to open repository: %v", err)
+	}
+	target := t.TempDir()
+	if err := repo.Restore(ctx, tree, target); err != nil {
+		t.Fatalf("Failed to restore: %v", err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(target, "secret.txt")); string(data) != "top secret" {
+		t.Errorf("Unexpected restored content %q", data)
+	}
+}
+
+func TestPruneRemovesUnusedData(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	provider := local.NewLocalProvider(root)
+
+	source := t.TempDir()
+	random := rand.New(rand.NewSource(3))
+	old := make([]byte, 200<<10)
+	random.Read(old)
+	writeFile(t, filepath.Join(source, "big.bin"), old)
+	writeFile(t, filepath.Join(source, "small.txt"), []byte("kept"))
+
+	repo, err := Init(ctx, provider, "repo", "key", testParams)
+	if err != nil {
+		t.Fatalf("Failed to init repository: %v", err)
+	}
+	repo.packSize = 64 << 10
+	first, _, err := repo.Backup(ctx, source)
+	if err != nil {
+		t.Fatalf("Failed to back up: %v", err)
+	}
+
+	current := make([]byte, 200<<10)
+	random.Read(current)
+	writeFile(t, filepath.Join(source, "big.bin"), current)
+	second, _, err := repo.Backup(ctx, source)
+	if err != nil {
+		t.Fatalf("Failed to back up again: %v", err)
+	}
+
+	repo, err = Open(ctx, provider, "repo", "key")
+	if err != nil {
+		t.Fatalf("Failed to open repository: %v", err)
+	}
+	planned, err := repo.Prune(ctx, []string{second}, true)
+	if err != nil {
+		t.Fatalf("Failed to plan the prune: %v", err)
+	}
+	if err := repo.Restore(ctx, first, t.TempDir()); err != nil {
+		t.Fatalf("Expected a dry run to keep the data: %v", err)
+	}
+	stats, err := repo.Prune(ctx, []string{second}, false)
+	if err != nil {
+		t.Fatalf("Failed to prune: %v", err)
+	}
+	if stats != planned {
+		t.Errorf("Dry run planned %+v, prune removed %+v", planned, stats)
+	}
+	if stats.Deleted == 0 || stats.Bytes < int64(len(old)) {
+		t.Errorf("Expected the data of the first backup to be removed, got %+v", stats)
+	}
+	if indexes, _ := os.ReadDir(filepath.Join(root, "repo", indexDir)); len(indexes) != 1 {
+		t.Errorf("Expected a single index file after prune, got %d", len(indexes))
+	}
+
+	repo, err = Open(ctx, provider, "repo", "key")
+	if err != nil {
+		t.Fatalf("Failed to open repository: %v", err)
+	}
+	target := t.TempDir()
+	if err := repo.Restore(ctx, second, target); err != nil {
+		t.Fatalf("Failed to restore the kept backup: %v", err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(target, "big.bin")); string(data) != string(current) {
+		t.Error("Restored file does not match the kept backup")
+	}
+	if err := repo.Restore(ctx, first, t.TempDir()); err == nil {
+		t.Error("Expected the pruned backup to be gone")
+	}
+
+	if stats, err := repo.Prune(ctx, []string{second}, false); err != nil || stats.Blobs != 0 {
+		t.Errorf("Expected nothing left to prune, got %+v, %v", stats, err)
+	}
+}
+
+// failingProvider fails the upload of a pack once failAfter packs are
+// uploaded, like a backup losing its connection partway.
+type failingProvider struct {
+	*local.LocalProvider
+	failAfter, packs int
+}
+
+func (p *failingProvider) Upload(ctx context.Context, localPath, remotePath string) error {
+	if path.Base(path.Dir(path.Dir(remotePath))) == dataDir {
+		if p.packs == p.failAfter {
+			return errors.New("connection lost")
+		}
+		p.packs++
+	}
+	return p.LocalProvider.Upload(ctx, localPath, remotePath)
+}
+
+func TestFailedBackupIndexesUploadedPacks(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	provider := &failingProvider{LocalProvider: local.NewLocalProvider(root), failAfter: 2}
+
+	source := t.TempDir()
+	big := make([]byte, 300<<10)
+	rand.New(rand.NewSource(4)).Read(big)
+	writeFile(t, filepath.Join(source, "big.bin"), big)
+
+	repo, err := Init(ctx, provider, "repo", "", testParams)
+	if err != nil {
+		t.Fatalf("Failed to init repository: %v", err)
+	}
+	repo.packSize = 64 << 10
+	if _, _, err := repo.Backup(ctx, source); err == nil {
+		t.Fatal("Expected the backup to fail")
+	}
+
+	repo, err = Open(ctx, provider.LocalProvider, "repo", "")
+	if err != nil {
+		t.Fatalf("Failed to open repository: %v", err)
+	}
+	repo.packSize = 64 << 10
+	var packs int
+	err = filepath.WalkDir(filepath.Join(root, "repo", dataDir), func(name string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		packs++
+		if _, ok := repo.packs[entry.Name()]; !ok {
+			t.Errorf("Pack %s of the failed backup is not indexed", entry.Name())
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if packs != provider.failAfter {
+		t.Fatalf("Expected %d packs uploaded before the failure, got %d", provider.failAfter, packs)
+	}
+
+	tree, stats, err := repo.Backup(ctx, source)
+	if err != nil {
+		t.Fatalf("Failed to back up again: %v", err)
+	}
+	if stats.NewBytes >= int64(len(big)) {
+		t.Errorf("Expected the retry to reuse the uploaded data, stored %d new bytes", stats.NewBytes)
+	}
+	target := t.TempDir()
+	if err := repo.Restore(ctx, tree, target); err != nil {
+		t.Fatalf("Failed to restore: %v", err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(target, "big.bin")); string(data) != string(big) {
+		t.Error("Restored file does not match the source")
+	}
+}
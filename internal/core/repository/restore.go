@@ -0,0 +1,186 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/amankumarsingh77/automated_backup_tool/internal/utils/filesystem"
+)
+
+// restore holds the state of one Restore call. Packs are downloaded once,
+// decrypted into a temporary directory and read from there.
+type restore struct {
+	repo  *Repository
+	dir   string
+	packs map[string]string
+}
+
+// Restore writes the contents of the tree with the given ID into target,
+// creating it if necessary. Files keep their mode and modification time.
+func (r *Repository) Restore(ctx context.Context, tree, target string) error {
+	res, err := r.newRestore()
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(res.dir)
+
+	if err := os.MkdirAll(target, 0755); err != nil {
+		return fmt.Errorf("failed to create restore target: %w", err)
+	}
+	return res.restoreTree(ctx, tree, target)
+}
+
+// LoadTree reads the tree with the given ID.
+func (r *Repository) LoadTree(ctx context.Context, id string) (*Tree, error) {
+	res, err := r.newRestore()
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(res.dir)
+	return res.loadTree(ctx, id)
+}
+
+func (r *Repository) newRestore() (*restore, error) {
+	dir, err := os.MkdirTemp(filesystem.TempDir(), "restore-*")
+	if err != nil {
+		return nil, err
+	}
+	return &restore{repo: r, dir: dir, packs: make(map[string]string)}, nil
+}
+
+func (res *restore) loadTree(ctx context.Context, id string) (*Tree, error) {
+	data, err := res.loadBlob(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	tree := &Tree{}
+	if err := json.Unmarshal(data, tree); err != nil {
+		return nil, fmt.Errorf("failed to read tree %s: %w", id[:8], err)
+	}
+	return tree, nil
+}
+
+func (res *restore) restoreTree(ctx context.Context, id, dir string) error {
+	tree, err := res.loadTree(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	for _, node := range tree.Nodes {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if node.Name == "" || node.Name == "." || node.Name == ".." || strings.ContainsAny(node.Name, `/\`) {
+			return fmt.Errorf("tree %s holds an invalid name %q", id[:8], node.Name)
+		}
+		target := filepath.Join(dir, node.Name)
+
+		switch node.Type {
+		case NodeDir:
+			if err := os.MkdirAll(target, 0700); err != nil {
+				return err
+			}
+			if err := res.restoreTree(ctx, node.Subtree, target); err != nil {
+				return err
+			}
+			if err := os.Chmod(target, node.Mode.Perm()); err != nil {
+				return err
+			}
+		case NodeSymlink:
+			os.Remove(target)
+			if err := os.Symlink(node.LinkTarget, target); err != nil {
+				return err
+			}
+			continue
+		case NodeFile:
+			if err := res.restoreFile(ctx, node, target); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("tree %s holds %s of unknown type %q", id[:8], node.Name, node.Type)
+		}
+		if err := os.Chtimes(target, node.ModTime, node.ModTime); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (res *restore) restoreFile(ctx context.Context, node Node, target string) error {
+	file, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, node.Mode.Perm())
+	if err != nil {
+		return err
+	}
+	for _, id := range node.Content {
+		data, err := res.loadBlob(ctx, id)
+		if err != nil {
+			file.Close()
+			return fmt.Errorf("failed to restore %s: %w", target, err)
+		}
+		if _, err := file.Write(data); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Chmod(target, node.Mode.Perm())
+}
+
+// loadBlob reads a blob and checks it against its ID.
+func (res *restore) loadBlob(ctx context.Context, id string) ([]byte, error) {
+	location, ok := res.repo.index[id]
+	if !ok {
+		return nil, fmt.Errorf("blob %s is missing from the repository index", id)
+	}
+	pack, err := res.packFile(ctx, location.pack)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(pack)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	data := make([]byte, location.length)
+	if _, err := file.ReadAt(data, location.offset); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("failed to read blob %s: %w", id[:8], err)
+	}
+	if hash(data) != id {
+		return nil, fmt.Errorf("blob %s in pack %s is corrupted", id[:8], location.pack[:8])
+	}
+	return data, nil
+}
+
+// packFile returns the local, decrypted copy of a pack, downloading it on
+// first use.
+func (res *restore) packFile(ctx context.Context, id string) (string, error) {
+	if name, ok := res.packs[id]; ok {
+		return name, nil
+	}
+
+	data, err := res.repo.download(ctx, res.repo.packPath(id))
+	if err != nil {
+		return "", fmt.Errorf("failed to download pack %s: %w", id[:8], err)
+	}
+	if hash(data) != id {
+		return "", fmt.Errorf("pack %s is corrupted", id[:8])
+	}
+	if data, err = res.repo.decrypt(data); err != nil {
+		return "", fmt.Errorf("failed to decrypt pack %s: %w", id[:8], err)
+	}
+
+	name := filepath.Join(res.dir, id)
+	if err := os.WriteFile(name, data, 0600); err != nil {
+		return "", err
+	}
+	res.packs[id] = name
+	return name, nil
+}
@@ -0,0 +1,447 @@
+// Package snapshot records what each backup run stored. Every run produces
+// an immutable snapshot: who made it, when, from where, and a manifest of
+// the files it contains. The snapshot is written as JSON next to the data
+// it describes, so the remote alone tells what every backup holds. The
+// snapshots of encrypted backups are sealed: apart from IDs, the start time
+// and where the data is, they are stored encrypted with the backup's key.
+package snapshot
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/amankumarsingh77/automated_backup_tool/internal/storage"
+	"github.com/amankumarsingh77/automated_backup_tool/internal/utils/filesystem"
+)
+
+// Dir is the folder below a task's destination holding its snapshots.
+const Dir = "snapshots"
+
+// shortIDLength is how many characters of an ID are shown and usually
+// enough to name a snapshot.
+const shortIDLength = 8
+
+// Backup modes. A full backup archives the whole source. An incremental
+// backup archives what changed since the previous snapshot, a differential
+// backup what changed since the last full one.
+const (
+	ModeFull         = "full"
+	ModeIncremental  = "incremental"
+	ModeDifferential = "differential"
+)
+
+// Snapshot describes one backup run.
+type Snapshot struct {
+	ID       string    `json:"id"`
+	TaskID   string    `json:"task_id"`
+	TaskName string    `json:"task_name,omitempty"`
+	Host     string    `json:"host"`
+	Source   string    `json:"source"`
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished"`
+	// Data is the remote path of the uploaded archive.
+	Data string `json:"data,omitempty"`
+	// Tree is the root tree of a backup stored in a repository, see the
+	// repository package.
+	Tree string `json:"tree,omitempty"`
+	// Mode is the backup mode of an archive; empty for a full backup
+	// made before modes existed.
+	Mode string `json:"mode,omitempty"`
+	// Parent is the snapshot an incremental or differential archive
+	// builds on, and Deleted the files of the parent that are gone. Files
+	// always lists the complete source.
+	Parent  string   `json:"parent,omitempty"`
+	Deleted []string `json:"deleted,omitempty"`
+	Files   []File   `json:"files"`
+	// Sealed is the encrypted snapshot of an encrypted backup, see Open.
+	Sealed []byte `json:"sealed,omitempty"`
+}
+
+// Cipher encrypts the snapshots of encrypted backups.
+type Cipher interface {
+	Encrypt(data []byte) ([]byte, error)
+	Decrypt(data []byte) ([]byte, error)
+}
+
+// File is an entry of a snapshot manifest. Path is relative to the source
+// and uses forward slashes; a source that is a single file has its base
+// name as the only path.
+type File struct {
+	Path    string      `json:"path"`
+	Size    int64       `json:"size"`
+	Mode    fs.FileMode `json:"mode"`
+	ModTime time.Time   `json:"mtime"`
+	// SHA256 is the hex encoded hash of the contents of a regular file.
+	SHA256 string `json:"sha256,omitempty"`
+}
+
+// New starts the snapshot of a run of task taskID backing up source.
+func New(taskID, taskName, source string) (*Snapshot, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, fmt.Errorf("failed to generate snapshot ID: %w", err)
+	}
+	host, err := os.Hostname()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get host name: %w", err)
+	}
+	return &Snapshot{
+		ID:       hex.EncodeToString(id),
+		TaskID:   taskID,
+		TaskName: taskName,
+		Host:     host,
+		Source:   source,
+		Started:  time.Now(),
+	}, nil
+}
+
+// ShortID returns the abbreviated ID shown in listings.
+func (s *Snapshot) ShortID() string {
+	if len(s.ID) > shortIDLength {
+		return s.ID[:shortIDLength]
+	}
+	return s.ID
+}
+
+// Size returns the total size of the files in the snapshot.
+func (s *Snapshot) Size() int64 {
+	var size int64
+	for _, file := range s.Files {
+		size += file.Size
+	}
+	return size
+}
+
+// Full reports whether the snapshot's archive holds the whole source.
+func (s *Snapshot) Full() bool {
+	return s.Mode == "" || s.Mode == ModeFull
+}
+
+// Scan builds the manifest of the file or directory at source, hashing
+// every regular file. The entries of a directory source whose relative
+// path is in exclude are left out, along with their contents.
+func Scan(source string, exclude ...string) ([]File, error) {
+	info, err := os.Stat(source)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat source: %w", err)
+	}
+	if !info.IsDir() {
+		file, err := scanFile(source, filepath.Base(source), info)
+		if err != nil {
+			return nil, err
+		}
+		return []File{file}, nil
+	}
+
+	var files []File
+	err = filepath.WalkDir(source, func(name string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if name == source {
+			return nil
+		}
+		rel, err := filepath.Rel(source, name)
+		if err != nil {
+			return err
+		}
+		if slices.Contains(exclude, filepath.ToSlash(rel)) {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		file, err := scanFile(name, filepath.ToSlash(rel), info)
+		if err != nil {
+			return err
+		}
+		files = append(files, file)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan source: %w", err)
+	}
+	return files, nil
+}
+
+func scanFile(name, rel string, info fs.FileInfo) (File, error) {
+	file := File{
+		Path:    rel,
+		Mode:    info.Mode(),
+		ModTime: info.ModTime().UTC(),
+	}
+	if !info.Mode().IsRegular() {
+		return file, nil
+	}
+	file.Size = info.Size()
+
+	f, err := os.Open(name)
+	if err != nil {
+		return File{}, err
+	}
+	defer f.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return File{}, fmt.Errorf("failed to hash %s: %w", name, err)
+	}
+	file.SHA256 = hex.EncodeToString(hash.Sum(nil))
+	return file, nil
+}
+
+// Path returns the remote path of the snapshot with the given ID below the
+// destination dest.
+func Path(dest, id string) string {
+	return path.Join(dest, Dir, id+".json")
+}
+
+// Save uploads the snapshot below the destination dest. With a cipher the
+// snapshot is sealed: only its IDs, start time, data path and tree are
+// stored in plain text, the rest only encrypted.
+func Save(ctx context.Context, provider storage.StorageProvider, dest string, s *Snapshot, c Cipher) error {
+	stored := s
+	if c != nil {
+		data, err := json.Marshal(s)
+		if err != nil {
+			return err
+		}
+		sealed, err := c.Encrypt(data)
+		if err != nil {
+			return fmt.Errorf("failed to encrypt snapshot %s: %w", s.ShortID(), err)
+		}
+		stored = &Snapshot{ID: s.ID, TaskID: s.TaskID, Started: s.Started, Data: s.Data, Tree: s.Tree, Sealed: sealed}
+	}
+	data, err := json.MarshalIndent(stored, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	temp, err := os.CreateTemp(filesystem.TempDir(), "snapshot-*.json")
+	if err != nil {
+		return fmt.Errorf("failed to create snapshot file: %w", err)
+	}
+	defer os.Remove(temp.Name())
+	_, err = temp.Write(data)
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write snapshot file: %w", err)
+	}
+
+	if err := provider.Upload(ctx, temp.Name(), Path(dest, s.ID)); err != nil {
+		return fmt.Errorf("failed to upload snapshot %s: %w", s.ShortID(), err)
+	}
+	return nil
+}
+
+// Open decrypts a sealed snapshot in place. Snapshots that are not sealed
+// are left as they are.
+func (s *Snapshot) Open(c Cipher) error {
+	if len(s.Sealed) == 0 {
+		return nil
+	}
+	if c == nil {
+		return fmt.Errorf("snapshot %s is encrypted and no key is known", s.ShortID())
+	}
+	data, err := c.Decrypt(s.Sealed)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt snapshot %s: %w", s.ShortID(), err)
+	}
+	opened := Snapshot{}
+	if err := json.Unmarshal(data, &opened); err != nil {
+		return fmt.Errorf("failed to read snapshot %s: %w", s.ShortID(), err)
+	}
+	if opened.ID != s.ID || opened.TaskID != s.TaskID {
+		return fmt.Errorf("snapshot %s holds the encrypted snapshot %s", s.ShortID(), opened.ShortID())
+	}
+	*s = opened
+	return nil
+}
+
+// Delete removes the snapshot from below the destination dest. The data
+// it points to is left alone.
+func Delete(ctx context.Context, provider storage.StorageProvider, dest string, s *Snapshot) error {
+	if err := provider.Delete(ctx, Path(dest, s.ID)); err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return fmt.Errorf("failed to delete snapshot %s: %w", s.ShortID(), err)
+	}
+	return nil
+}
+
+// List reads the snapshots stored below the destination dest, oldest
+// first. Sealed snapshots are returned as stored, see Open.
+func List(ctx context.Context, provider storage.StorageProvider, dest string) ([]*Snapshot, error) {
+	objects, err := provider.ListFiles(ctx, path.Join(dest, Dir))
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list snapshots: %w", err)
+	}
+
+	var snapshots []*Snapshot
+	for _, object := range objects {
+		if object.IsDir || path.Ext(object.Path) != ".json" {
+			continue
+		}
+		s, err := load(ctx, provider, object.Path)
+		if err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, s)
+	}
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].Started.Before(snapshots[j].Started)
+	})
+	return snapshots, nil
+}
+
+func load(ctx context.Context, provider storage.StorageProvider, remotePath string) (*Snapshot, error) {
+	temp, err := os.CreateTemp(filesystem.TempDir(), "snapshot-*.json")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create snapshot file: %w", err)
+	}
+	temp.Close()
+	defer os.Remove(temp.Name())
+
+	if err := provider.Download(ctx, temp.Name(), remotePath); err != nil {
+		return nil, fmt.Errorf("failed to download snapshot %s: %w", remotePath, err)
+	}
+	data, err := os.ReadFile(temp.Name())
+	if err != nil {
+		return nil, err
+	}
+	s := &Snapshot{}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("failed to read snapshot %s: %w", remotePath, err)
+	}
+	return s, nil
+}
+
+// Find returns the snapshot whose ID starts with prefix.
+func Find(snapshots []*Snapshot, prefix string) (*Snapshot, error) {
+	if prefix == "" {
+		return nil, errors.New("no snapshot ID given")
+	}
+	var found *Snapshot
+	for _, s := range snapshots {
+		if !strings.HasPrefix(s.ID, prefix) {
+			continue
+		}
+		if found != nil {
+			return nil, fmt.Errorf("snapshot ID %s is ambiguous, give more characters", prefix)
+		}
+		found = s
+	}
+	if found == nil {
+		return nil, fmt.Errorf("%w: snapshot %s", storage.ErrNotFound, prefix)
+	}
+	return found, nil
+}
+
+// Diff compares the manifest files with the manifest base. It returns the
+// paths that are new or changed in files, and those of base that are gone.
+func Diff(base, files []File) (changed, deleted []string) {
+	old := make(map[string]File, len(base))
+	for _, file := range base {
+		old[file.Path] = file
+	}
+	for _, file := range files {
+		prev, ok := old[file.Path]
+		if !ok || prev.Size != file.Size || prev.Mode != file.Mode || prev.SHA256 != file.SHA256 {
+			changed = append(changed, file.Path)
+		}
+		delete(old, file.Path)
+	}
+	for _, file := range base {
+		if _, ok := old[file.Path]; ok {
+			deleted = append(deleted, file.Path)
+		}
+	}
+	return changed, deleted
+}
+
+// Parent returns the snapshot a backup in the given mode builds on, from
+// the archive snapshots of a task, oldest first: the latest snapshot for
+// an incremental backup, the latest full one for a differential backup.
+// It returns nil when the backup has to be full, because there is no full
+// snapshot yet or fullEvery backups were made since the last one.
+func Parent(snapshots []*Snapshot, mode string, fullEvery int) *Snapshot {
+	if mode != ModeIncremental && mode != ModeDifferential {
+		return nil
+	}
+	last := -1
+	for i, s := range snapshots {
+		if s.Full() {
+			last = i
+		}
+	}
+	if last < 0 || (fullEvery > 0 && len(snapshots)-last >= fullEvery) {
+		return nil
+	}
+	if mode == ModeDifferential {
+		return snapshots[last]
+	}
+	return snapshots[len(snapshots)-1]
+}
+
+// ReplacedBy returns the latest of snapshots whose archive was uploaded to
+// the path of the archive of s after it, or nil. Tasks without a name
+// template upload every run to the same path, so only the last snapshot of
+// a path still has its archive.
+func ReplacedBy(snapshots []*Snapshot, s *Snapshot) *Snapshot {
+	if s.Data == "" {
+		return nil
+	}
+	var by *Snapshot
+	for _, other := range snapshots {
+		if other.ID != s.ID && other.Data == s.Data && other.Started.After(s.Started) &&
+			(by == nil || other.Started.After(by.Started)) {
+			by = other
+		}
+	}
+	return by
+}
+
+// Chain returns the snapshots whose archives together restore s, oldest
+// first: the full snapshot it builds on, then each one up to s.
+func Chain(snapshots []*Snapshot, s *Snapshot) ([]*Snapshot, error) {
+	byID := make(map[string]*Snapshot, len(snapshots))
+	for _, snapshot := range snapshots {
+		byID[snapshot.ID] = snapshot
+	}
+
+	chain := []*Snapshot{s}
+	for !s.Full() {
+		parent, ok := byID[s.Parent]
+		if !ok {
+			return nil, fmt.Errorf("%w: snapshot %s builds on snapshot %s", storage.ErrNotFound, s.ShortID(), s.Parent)
+		}
+		if len(chain) > len(snapshots) {
+			return nil, fmt.Errorf("the snapshots before %s form a loop", chain[0].ShortID())
+		}
+		s = parent
+		chain = append(chain, s)
+	}
+	for i, j := 0, len(chain)-1; i < j; i, j = i+1, j-1 {
+		chain[i], chain[j] = chain[j], chain[i]
+	}
+	return chain, nil
+}
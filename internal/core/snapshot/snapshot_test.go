@@ -0,0 +1,223 @@
+package snapshot
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/amankumarsingh77/automated_backup_tool/internal/security/encryption"
+	"github.com/amankumarsingh77/automated_backup_tool/internal/storage"
+	"github.com/amankumarsingh77/automated_backup_tool/internal/storage/local"
+)
+
+func TestScan(t *testing.T) {
+	source := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(source, "docs"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(source, "docs", "a.txt"), []byte("alpha"), 0640); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := Scan(source)
+	if err != nil {
+		t.Fatalf("Failed to scan: %v", err)
+	}
+	if len(files) != 2 || files[0].Path != "docs" || !files[0].Mode.IsDir() {
+		t.Fatalf("Unexpected manifest: %+v", files)
+	}
+	sum := sha256.Sum256([]byte("alpha"))
+	file := files[1]
+	if file.Path != "docs/a.txt" || file.Size != 5 || file.SHA256 != hex.EncodeToString(sum[:]) || file.Mode.Perm() != 0640 {
+		t.Errorf("Unexpected file entry: %+v", file)
+	}
+
+	files, err = Scan(filepath.Join(source, "docs", "a.txt"))
+	if err != nil {
+		t.Fatalf("Failed to scan single file: %v", err)
+	}
+	if len(files) != 1 || files[0].Path != "a.txt" {
+		t.Errorf("Unexpected manifest of a single file: %+v", files)
+	}
+}
+
+func TestSaveAndList(t *testing.T) {
+	ctx := context.Background()
+	provider := local.NewLocalProvider(t.TempDir())
+
+	snapshots, err := List(ctx, provider, "backups")
+	if err != nil || len(snapshots) != 0 {
+		t.Fatalf("Expected no snapshots before the first run, got %v, %v", snapshots, err)
+	}
+
+	var saved []*Snapshot
+	for i := 0; i < 2; i++ {
+		s, err := New("task-1", "documents", "/home/user/documents")
+		if err != nil {
+			t.Fatalf("Failed to create snapshot: %v", err)
+		}
+		s.Started = time.Date(2024, 5, 1+i, 2, 0, 0, 0, time.UTC)
+		s.Finished = s.Started.Add(time.Minute)
+		s.Data = "backups/documents.gz"
+		s.Files = []File{{Path: "a.txt", Size: 5, SHA256: "abc"}}
+		if err := Save(ctx, provider, "backups", s, nil); err != nil {
+			t.Fatalf("Failed to save snapshot: %v", err)
+		}
+		saved = append(saved, s)
+	}
+
+	snapshots, err = List(ctx, provider, "backups")
+	if err != nil {
+		t.Fatalf("Failed to list snapshots: %v", err)
+	}
+	if len(snapshots) != 2 || snapshots[0].ID != saved[0].ID || snapshots[1].ID != saved[1].ID {
+		t.Fatalf("Snapshots not listed oldest first: %+v", snapshots)
+	}
+	if s := snapshots[1]; s.TaskID != "task-1" || s.Data != "backups/documents.gz" || len(s.Files) != 1 || !s.Finished.Equal(saved[1].Finished) {
+		t.Errorf("Snapshot did not round trip: %+v", s)
+	}
+
+	found, err := Find(snapshots, saved[1].ShortID())
+	if err != nil || found.ID != saved[1].ID {
+		t.Errorf("Failed to find snapshot by short ID: %v", err)
+	}
+	if _, err := Find(snapshots, "zz"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for an unknown ID, got %v", err)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	base := []File{
+		{Path: "docs", Mode: fs.ModeDir | 0755},
+		{Path: "docs/a.txt", Size: 5, Mode: 0644, SHA256: "aa"},
+		{Path: "docs/b.txt", Size: 5, Mode: 0644, SHA256: "bb"},
+		{Path: "old.txt", Size: 3, Mode: 0644, SHA256: "cc"},
+	}
+	files := []File{
+		{Path: "docs", Mode: fs.ModeDir | 0755},
+		{Path: "docs/a.txt", Size: 5, Mode: 0644, SHA256: "aa", ModTime: time.Now()},
+		{Path: "docs/b.txt", Size: 6, Mode: 0644, SHA256: "bd"},
+		{Path: "new.txt", Size: 1, Mode: 0600, SHA256: "dd"},
+	}
+
+	changed, deleted := Diff(base, files)
+	if !reflect.DeepEqual(changed, []string{"docs/b.txt", "new.txt"}) {
+		t.Errorf("Unexpected changed files %v", changed)
+	}
+	if !reflect.DeepEqual(deleted, []string{"old.txt"}) {
+		t.Errorf("Unexpected deleted files %v", deleted)
+	}
+}
+
+func TestReplacedBy(t *testing.T) {
+	now := time.Now()
+	first := &Snapshot{ID: "a", Started: now, Data: "backups/data.gz"}
+	second := &Snapshot{ID: "b", Started: now.Add(time.Hour), Data: "backups/data.gz"}
+	third := &Snapshot{ID: "c", Started: now.Add(2 * time.Hour), Data: "backups/data.gz"}
+	other := &Snapshot{ID: "d", Started: now.Add(3 * time.Hour), Data: "backups/other.gz"}
+	snapshots := []*Snapshot{first, second, third, other}
+
+	if by := ReplacedBy(snapshots, first); by != third {
+		t.Errorf("Expected the first archive to be replaced by the last run uploading to its path, got %v", by)
+	}
+	if by := ReplacedBy(snapshots, third); by != nil {
+		t.Errorf("Expected the latest archive of a path to be kept, got replaced by %s", by.ID)
+	}
+	if by := ReplacedBy(snapshots, other); by != nil {
+		t.Errorf("Expected an archive at its own path to be kept, got replaced by %s", by.ID)
+	}
+}
+
+func TestParentAndChain(t *testing.T) {
+	full := &Snapshot{ID: "f1", Mode: ModeFull}
+	inc1 := &Snapshot{ID: "i1", Mode: ModeIncremental, Parent: "f1"}
+	inc2 := &Snapshot{ID: "i2", Mode: ModeIncremental, Parent: "i1"}
+	snapshots := []*Snapshot{full, inc1, inc2}
+
+	if p := Parent(nil, ModeIncremental, 0); p != nil {
+		t.Errorf("Expected a full backup without snapshots, got parent %s", p.ID)
+	}
+	if p := Parent(snapshots, ModeIncremental, 0); p != inc2 {
+		t.Errorf("Expected incremental backup to build on i2, got %v", p)
+	}
+	if p := Parent(snapshots, ModeDifferential, 0); p != full {
+		t.Errorf("Expected differential backup to build on f1, got %v", p)
+	}
+	if p := Parent(snapshots, ModeIncremental, 4); p != inc2 {
+		t.Errorf("Expected the fourth backup to be incremental, got %v", p)
+	}
+	if p := Parent(snapshots, ModeIncremental, 3); p != nil {
+		t.Errorf("Expected a full backup every 3 runs, got parent %s", p.ID)
+	}
+
+	chain, err := Chain(snapshots, inc2)
+	if err != nil {
+		t.Fatalf("Failed to build chain: %v", err)
+	}
+	if len(chain) != 3 || chain[0] != full || chain[1] != inc1 || chain[2] != inc2 {
+		t.Errorf("Unexpected chain %v", chain)
+	}
+	if _, err := Chain([]*Snapshot{full, inc2}, inc2); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("Expected a missing parent to fail with ErrNotFound, got %v", err)
+	}
+}
+
+func TestSealedSnapshot(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	provider := local.NewLocalProvider(root)
+	key, err := encryption.NewEncryptionManager("task key")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := New("task-1", "documents", "/home/user/documents")
+	if err != nil {
+		t.Fatalf("Failed to create snapshot: %v", err)
+	}
+	s.Data = "backups/documents.gz.encrypted"
+	s.Files = []File{{Path: "payroll.xlsx", Size: 5, SHA256: "abc"}}
+	if err := Save(ctx, provider, "backups", s, key); err != nil {
+		t.Fatalf("Failed to save snapshot: %v", err)
+	}
+
+	stored, err := os.ReadFile(filepath.Join(root, "backups", Dir, s.ID+".json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, leak := range []string{"payroll", "documents\"", "/home/user"} {
+		if strings.Contains(string(stored), leak) {
+			t.Errorf("Sealed snapshot holds %q in plain text", leak)
+		}
+	}
+
+	snapshots, err := List(ctx, provider, "backups")
+	if err != nil || len(snapshots) != 1 {
+		t.Fatalf("Expected one snapshot, got %v, %v", snapshots, err)
+	}
+	sealed := snapshots[0]
+	if sealed.ID != s.ID || sealed.TaskID != "task-1" || sealed.Data != s.Data || len(sealed.Files) != 0 {
+		t.Errorf("Unexpected plain text of a sealed snapshot: %+v", sealed)
+	}
+	if err := sealed.Open(nil); err == nil {
+		t.Error("Expected a sealed snapshot not to open without a key")
+	}
+	wrong, _ := encryption.NewEncryptionManager("wrong key")
+	if err := sealed.Open(wrong); err == nil {
+		t.Error("Expected a sealed snapshot not to open with the wrong key")
+	}
+	if err := sealed.Open(key); err != nil {
+		t.Fatalf("Failed to open snapshot: %v", err)
+	}
+	if sealed.Source != s.Source || !reflect.DeepEqual(sealed.Files, s.Files) || len(sealed.Sealed) != 0 {
+		t.Errorf("Sealed snapshot did not round trip: %+v", sealed)
+	}
+}
@@ -0,0 +1,37 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWebhook(t *testing.T) {
+	var got Event
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&got)
+	}))
+	defer server.Close()
+
+	event := Event{TaskID: "1", TaskName: "documents", Status: "failed", Error: "quota exceeded", Finished: time.Now()}
+	if err := Webhook(context.Background(), server.URL, event); err != nil {
+		t.Fatalf("Failed to send webhook: %v", err)
+	}
+	if got.TaskName != "documents" || got.Error != "quota exceeded" {
+		t.Errorf("Unexpected event received: %+v", got)
+	}
+
+	server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	if err := Webhook(context.Background(), server.URL, event); err == nil {
+		t.Error("Expected an error for a failing webhook")
+	}
+}
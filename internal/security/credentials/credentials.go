@@ -1,22 +1,86 @@
 package credentials
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
 	"sync"
 
 	"github.com/amankumarsingh77/automated_backup_tool/internal/security/encryption"
+	"github.com/amankumarsingh77/automated_backup_tool/internal/utils/filesystem"
+	"golang.org/x/oauth2"
 )
 
+var ErrCredentialNotFound = errors.New("no credentials found")
+
+var ErrTokenNotFound = errors.New("no token saved")
+
+// remoteNamePattern keeps remote names usable as file names, since
+// providers store per-remote state such as OAuth tokens under them.
+var remoteNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// ValidateRemoteName checks that name can be used for a remote.
+func ValidateRemoteName(name string) error {
+	if !remoteNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid remote name %q: use letters, digits, '.', '-' and '_'", name)
+	}
+	return nil
+}
+
+// Credential configures one remote: an account at a storage provider. Name
+// identifies the remote, so several accounts of the same provider can be
+// configured side by side.
 type Credential struct {
-	Provider    string `json:"provider"`
-	Key         string `json:"key"`
-	Secret      string `json:"secret"`
-	RedirectURL string `json:"redirect_url"`
+	Name        string            `json:"name,omitempty"`
+	Provider    string            `json:"provider"`
+	Key         string            `json:"key"`
+	Secret      string            `json:"secret"`
+	RedirectURL string            `json:"redirect_url"`
+	Options     map[string]string `json:"options,omitempty"`
+	// Token is the OAuth token of the account, kept encrypted with the
+	// rest of the credential.
+	Token *oauth2.Token `json:"token,omitempty"`
+}
+
+// RemoteName returns the name of the remote. Credentials stored before
+// remotes had names are the default remote of their provider.
+func (c Credential) RemoteName() string {
+	if c.Name != "" {
+		return c.Name
+	}
+	return c.Provider
+}
+
+// sensitiveOptions are the provider options that hold secrets.
+var sensitiveOptions = []string{"private_key"}
+
+// Masked returns a copy of c that is safe to print: secrets are replaced
+// by a placeholder and the token is left out.
+func (c Credential) Masked() Credential {
+	masked := c
+	masked.Token = nil
+	if masked.Secret != "" {
+		masked.Secret = maskedValue
+	}
+	if len(c.Options) > 0 {
+		masked.Options = make(map[string]string, len(c.Options))
+		for key, value := range c.Options {
+			masked.Options[key] = value
+		}
+		for _, key := range sensitiveOptions {
+			if masked.Options[key] != "" {
+				masked.Options[key] = maskedValue
+			}
+		}
+	}
+	return masked
 }
 
+const maskedValue = "********"
+
 type CredentialManager struct {
 	encryptionManager *encryption.EncryptionManager
 	credentialsFile   string
@@ -29,129 +93,171 @@ func NewCredentialManager(masterPassword string) (*CredentialManager, error) {
 		return nil, fmt.Errorf("failed to create encryption manager: %w", err)
 	}
 
-	homeDir, err := os.UserHomeDir()
+	credentialsDir, err := filesystem.AppDataDir()
 	if err != nil {
-		return nil, fmt.Errorf("failed to get home directory: %w", err)
-	}
-
-	credentialsDir := filepath.Join(homeDir, ".backup")
-	if err := os.MkdirAll(credentialsDir, 0700); err != nil {
 		return nil, fmt.Errorf("failed to create credentials directory: %w", err)
 	}
 
-	return &CredentialManager{
+	cm := &CredentialManager{
 		encryptionManager: encManager,
 		credentialsFile:   filepath.Join(credentialsDir, "credentials.enc"),
-	}, nil
+	}
+	// Checking the password up front reports a typo before any work is
+	// done.
+	if _, err := cm.load(); err != nil {
+		return nil, err
+	}
+	return cm, nil
 }
 
-func (cm *CredentialManager) StoreCredential(cred Credential) error {
+// ChangeMasterPassword re-encrypts all credentials with newPassword. The
+// backup copy still encrypted with the old password is removed.
+func (cm *CredentialManager) ChangeMasterPassword(newPassword string) error {
+	if newPassword == "" {
+		return errors.New("the new master password must not be empty")
+	}
+	encManager, err := encryption.NewEncryptionManager(newPassword)
+	if err != nil {
+		return fmt.Errorf("failed to create encryption manager: %w", err)
+	}
+
 	cm.mutex.Lock()
 	defer cm.mutex.Unlock()
 
-	
-	creds := make(map[string]Credential)
-	if _, err := os.Stat(cm.credentialsFile); err == nil {
-		data, err := cm.encryptionManager.Decrypt(readFileBytes(cm.credentialsFile))
-		if err == nil {
-			if err := json.Unmarshal(data, &creds); err != nil {
-				return fmt.Errorf("failed to parse existing credentials: %w", err)
-			}
-		}
+	creds, err := cm.load()
+	if err != nil {
+		return err
 	}
 
-	
-	creds[cred.Provider] = cred
+	previous := cm.encryptionManager
+	cm.encryptionManager = encManager
+	if err := cm.save(creds); err != nil {
+		cm.encryptionManager = previous
+		return err
+	}
+	if err := os.Remove(cm.backupFile()); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove old credentials backup: %w", err)
+	}
+	return nil
+}
 
-	
-	data, err := json.Marshal(creds)
-	if err != nil {
-		return fmt.Errorf("failed to marshal credentials: %w", err)
+// StoreCredential adds or replaces the remote described by cred.
+func (cm *CredentialManager) StoreCredential(cred Credential) error {
+	if err := ValidateRemoteName(cred.RemoteName()); err != nil {
+		return err
 	}
 
-	
-	encrypted, err := cm.encryptionManager.Encrypt(data)
+	cm.mutex.Lock()
+	defer cm.mutex.Unlock()
+
+	// A file that cannot be read must never be replaced by a fresh one.
+	creds, err := cm.load()
 	if err != nil {
-		return fmt.Errorf("failed to encrypt credentials: %w", err)
+		return err
 	}
 
-	if err := os.WriteFile(cm.credentialsFile, encrypted, 0600); err != nil {
-		return fmt.Errorf("failed to write credentials file: %w", err)
+	cred.Name = cred.RemoteName()
+	// Reconfiguring a remote with the same client keeps its login.
+	if old, ok := creds[cred.Name]; ok && cred.Token == nil &&
+		old.Provider == cred.Provider && old.Key == cred.Key {
+		cred.Token = old.Token
 	}
-
-	return nil
+	creds[cred.Name] = cred
+	return cm.save(creds)
 }
 
-func (cm *CredentialManager) GetCredential(provider string) (*Credential, error) {
+// ListCredentials returns all configured remotes, sorted by name.
+func (cm *CredentialManager) ListCredentials() ([]Credential, error) {
 	cm.mutex.RLock()
 	defer cm.mutex.RUnlock()
 
-	if _, err := os.Stat(cm.credentialsFile); os.IsNotExist(err) {
-		return nil, fmt.Errorf("no credentials found")
+	creds, err := cm.load()
+	if err != nil {
+		return nil, err
 	}
 
-	data, err := cm.encryptionManager.Decrypt(readFileBytes(cm.credentialsFile))
-	if err != nil {
-		return nil, fmt.Errorf("failed to decrypt credentials: %w", err)
+	list := make([]Credential, 0, len(creds))
+	for name, cred := range creds {
+		cred.Name = name
+		list = append(list, cred)
 	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list, nil
+}
 
-	var creds map[string]Credential
-	if err := json.Unmarshal(data, &creds); err != nil {
-		return nil, fmt.Errorf("failed to parse credentials: %w", err)
+// GetCredential returns the credential of the remote called name.
+func (cm *CredentialManager) GetCredential(name string) (*Credential, error) {
+	cm.mutex.RLock()
+	defer cm.mutex.RUnlock()
+
+	creds, err := cm.load()
+	if err != nil {
+		return nil, err
 	}
 
-	cred, exists := creds[provider]
+	cred, exists := creds[name]
 	if !exists {
-		return nil, fmt.Errorf("no credentials found for provider: %s", provider)
+		return nil, fmt.Errorf("%w for remote: %s", ErrCredentialNotFound, name)
 	}
+	cred.Name = name
 
 	return &cred, nil
 }
 
-func readFileBytes(path string) []byte {
-	data, err := os.ReadFile(path)
+func (cm *CredentialManager) DeleteCredential(name string) error {
+	cm.mutex.Lock()
+	defer cm.mutex.Unlock()
+
+	creds, err := cm.load()
 	if err != nil {
+		return err
+	}
+	if len(creds) == 0 {
 		return nil
 	}
-	return data
-}
 
+	delete(creds, name)
+	return cm.save(creds)
+}
 
-func (cm *CredentialManager) DeleteCredential(provider string) error {
-	cm.mutex.Lock()
-	defer cm.mutex.Unlock()
+// TokenStore returns the store for the OAuth token of the remote called
+// name.
+func (cm *CredentialManager) TokenStore(name string) *TokenStore {
+	return &TokenStore{manager: cm, name: name}
+}
 
-	if _, err := os.Stat(cm.credentialsFile); os.IsNotExist(err) {
-		return nil 
-	}
+// TokenStore keeps the OAuth token of one remote inside the encrypted
+// credentials file.
+type TokenStore struct {
+	manager *CredentialManager
+	name    string
+}
 
-	data, err := cm.encryptionManager.Decrypt(readFileBytes(cm.credentialsFile))
+func (s *TokenStore) LoadToken() (*oauth2.Token, error) {
+	cred, err := s.manager.GetCredential(s.name)
 	if err != nil {
-		return fmt.Errorf("failed to decrypt credentials: %w", err)
+		return nil, err
 	}
-
-	var creds map[string]Credential
-	if err := json.Unmarshal(data, &creds); err != nil {
-		return fmt.Errorf("failed to parse credentials: %w", err)
+	if cred.Token == nil {
+		return nil, fmt.Errorf("%w for remote: %s", ErrTokenNotFound, s.name)
 	}
+	return cred.Token, nil
+}
 
-	delete(creds, provider)
-
-	
-	data, err = json.Marshal(creds)
-	if err != nil {
-		return fmt.Errorf("failed to marshal credentials: %w", err)
-	}
+func (s *TokenStore) SaveToken(token *oauth2.Token) error {
+	cm := s.manager
+	cm.mutex.Lock()
+	defer cm.mutex.Unlock()
 
-	
-	encrypted, err := cm.encryptionManager.Encrypt(data)
+	creds, err := cm.load()
 	if err != nil {
-		return fmt.Errorf("failed to encrypt credentials: %w", err)
+		return err
 	}
-
-	if err := os.WriteFile(cm.credentialsFile, encrypted, 0600); err != nil {
-		return fmt.Errorf("failed to write credentials file: %w", err)
+	cred, exists := creds[s.name]
+	if !exists {
+		return fmt.Errorf("%w for remote: %s", ErrCredentialNotFound, s.name)
 	}
-
-	return nil
+	cred.Token = token
+	creds[s.name] = cred
+	return cm.save(creds)
 }
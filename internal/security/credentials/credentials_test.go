@@ -0,0 +1,200 @@
+package credentials
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/amankumarsingh77/automated_backup_tool/internal/security/encryption"
+	"golang.org/x/oauth2"
+)
+
+func TestTokenStore(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	cm, err := NewCredentialManager("test-password")
+	if err != nil {
+		t.Fatalf("Failed to create credential manager: %v", err)
+	}
+
+	store := cm.TokenStore("work-gdrive")
+	if err := store.SaveToken(&oauth2.Token{RefreshToken: "refresh"}); !errors.Is(err, ErrCredentialNotFound) {
+		t.Errorf("Expected ErrCredentialNotFound for an unknown remote, got %v", err)
+	}
+
+	cred := Credential{Name: "work-gdrive", Provider: "gdrive", Key: "client", Secret: "secret"}
+	if err := cm.StoreCredential(cred); err != nil {
+		t.Fatalf("Failed to store credential: %v", err)
+	}
+	if _, err := store.LoadToken(); !errors.Is(err, ErrTokenNotFound) {
+		t.Errorf("Expected ErrTokenNotFound before login, got %v", err)
+	}
+	if err := store.SaveToken(&oauth2.Token{RefreshToken: "refresh"}); err != nil {
+		t.Fatalf("Failed to save token: %v", err)
+	}
+
+	// Reconfiguring with the same client keeps the token, a new client
+	// needs a new login.
+	if err := cm.StoreCredential(cred); err != nil {
+		t.Fatalf("Failed to store credential: %v", err)
+	}
+	if token, err := store.LoadToken(); err != nil || token.RefreshToken != "refresh" {
+		t.Errorf("Token lost when reconfiguring the remote: %v %+v", err, token)
+	}
+	cred.Key = "other-client"
+	if err := cm.StoreCredential(cred); err != nil {
+		t.Fatalf("Failed to store credential: %v", err)
+	}
+	if _, err := store.LoadToken(); !errors.Is(err, ErrTokenNotFound) {
+		t.Errorf("Expected the token to be dropped for a new client, got %v", err)
+	}
+}
+
+func TestStoreCredentialRejectsInvalidName(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	cm, err := NewCredentialManager("test-password")
+	if err != nil {
+		t.Fatalf("Failed to create credential manager: %v", err)
+	}
+	if err := cm.StoreCredential(Credential{Name: "../work", Provider: "gdrive"}); err == nil {
+		t.Error("Expected an error for a remote name with a path separator")
+	}
+}
+
+func TestWrongMasterPassword(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	cm, err := NewCredentialManager("right")
+	if err != nil {
+		t.Fatalf("Failed to create credential manager: %v", err)
+	}
+	if err := cm.StoreCredential(Credential{Provider: "local", Options: map[string]string{"root": "/mnt"}}); err != nil {
+		t.Fatalf("Failed to store credential: %v", err)
+	}
+
+	if _, err := NewCredentialManager("wrong"); !errors.Is(err, ErrWrongPassword) {
+		t.Errorf("Expected ErrWrongPassword, got %v", err)
+	}
+
+	// A manager created before the password changed must not overwrite the
+	// store either.
+	if err := cm.ChangeMasterPassword("new"); err != nil {
+		t.Fatalf("Failed to change master password: %v", err)
+	}
+	stale := &CredentialManager{credentialsFile: cm.credentialsFile}
+	stale.encryptionManager, _ = encryption.NewEncryptionManager("right")
+	if err := stale.StoreCredential(Credential{Provider: "s3"}); !errors.Is(err, ErrWrongPassword) {
+		t.Errorf("Expected ErrWrongPassword when storing, got %v", err)
+	}
+
+	cm, err = NewCredentialManager("new")
+	if err != nil {
+		t.Fatalf("Failed to open store with the new password: %v", err)
+	}
+	if cred, err := cm.GetCredential("local"); err != nil || cred.Options["root"] != "/mnt" {
+		t.Errorf("Credential lost when changing the password: %v %+v", err, cred)
+	}
+	if _, err := os.Stat(cm.backupFile()); !os.IsNotExist(err) {
+		t.Error("Backup encrypted with the old password was kept")
+	}
+}
+
+func TestUpgradeVersion1File(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	em, _ := encryption.NewEncryptionManager("secret")
+	legacy, err := em.Encrypt([]byte(`{"gdrive": {"provider": "gdrive", "key": "client", "secret": "s"}}`))
+	if err != nil {
+		t.Fatalf("Failed to encrypt: %v", err)
+	}
+	file := filepath.Join(home, ".backup", "credentials.enc")
+	if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(file, legacy, 0600); err != nil {
+		t.Fatalf("Failed to write credentials: %v", err)
+	}
+
+	cm, err := NewCredentialManager("secret")
+	if err != nil {
+		t.Fatalf("Failed to open version 1 file: %v", err)
+	}
+	if err := cm.StoreCredential(Credential{Provider: "local"}); err != nil {
+		t.Fatalf("Failed to store credential: %v", err)
+	}
+	if cred, err := cm.GetCredential("gdrive"); err != nil || cred.Key != "client" {
+		t.Errorf("Version 1 credential lost: %v %+v", err, cred)
+	}
+	if backup, _ := os.ReadFile(cm.backupFile()); string(backup) != string(legacy) {
+		t.Error("Previous file was not kept as a backup copy")
+	}
+}
+
+func TestExportImport(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	source, err := NewCredentialManager("source")
+	if err != nil {
+		t.Fatalf("Failed to create credential manager: %v", err)
+	}
+	for _, cred := range []Credential{
+		{Name: "work-gdrive", Provider: "gdrive", Key: "client", Secret: "secret", Token: &oauth2.Token{RefreshToken: "refresh"}},
+		{Provider: "local", Options: map[string]string{"root": "/mnt/nas"}},
+	} {
+		if err := source.StoreCredential(cred); err != nil {
+			t.Fatalf("Failed to store credential: %v", err)
+		}
+	}
+
+	data, err := source.Export("transfer", "work-gdrive")
+	if err != nil {
+		t.Fatalf("Failed to export: %v", err)
+	}
+
+	t.Setenv("HOME", t.TempDir())
+	target, err := NewCredentialManager("target")
+	if err != nil {
+		t.Fatalf("Failed to create credential manager: %v", err)
+	}
+	if _, _, err := target.Import(data, "wrong", false); err == nil {
+		t.Error("Expected an error for a wrong export password")
+	}
+	imported, skipped, err := target.Import(data, "transfer", false)
+	if err != nil {
+		t.Fatalf("Failed to import: %v", err)
+	}
+	if len(imported) != 1 || imported[0] != "work-gdrive" || len(skipped) != 0 {
+		t.Errorf("Unexpected import result: imported %v, skipped %v", imported, skipped)
+	}
+	if token, err := target.TokenStore("work-gdrive").LoadToken(); err != nil || token.RefreshToken != "refresh" {
+		t.Errorf("Token not imported: %v %+v", err, token)
+	}
+
+	if _, skipped, _ := target.Import(data, "transfer", false); len(skipped) != 1 {
+		t.Errorf("Expected a configured remote to be skipped, got %v", skipped)
+	}
+}
+
+func TestMasked(t *testing.T) {
+	cred := Credential{
+		Provider: "sftp",
+		Key:      "backup",
+		Secret:   "password",
+		Options:  map[string]string{"host": "nas", "private_key": "-----BEGIN"},
+		Token:    &oauth2.Token{AccessToken: "access"},
+	}
+
+	masked := cred.Masked()
+	if masked.Secret == cred.Secret || masked.Options["private_key"] == cred.Options["private_key"] || masked.Token != nil {
+		t.Errorf("Secrets not masked: %+v", masked)
+	}
+	if masked.Key != "backup" || masked.Options["host"] != "nas" {
+		t.Errorf("Non-secret fields changed: %+v", masked)
+	}
+	if cred.Options["private_key"] != "-----BEGIN" {
+		t.Error("Masking modified the original credential")
+	}
+}
@@ -0,0 +1,86 @@
+package credentials
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/amankumarsingh77/automated_backup_tool/internal/security/encryption"
+)
+
+// Export encrypts the named remotes, or all of them when names is empty,
+// with password, so they can be imported on another machine. OAuth tokens
+// are included, so the new machine does not need to log in again.
+func (cm *CredentialManager) Export(password string, names ...string) ([]byte, error) {
+	if password == "" {
+		return nil, errors.New("the export password must not be empty")
+	}
+	em, err := encryption.NewEncryptionManager(password)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create encryption manager: %w", err)
+	}
+
+	cm.mutex.RLock()
+	creds, err := cm.load()
+	cm.mutex.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(names) > 0 {
+		selected := make(map[string]Credential, len(names))
+		for _, name := range names {
+			cred, ok := creds[name]
+			if !ok {
+				return nil, fmt.Errorf("%w for remote: %s", ErrCredentialNotFound, name)
+			}
+			selected[name] = cred
+		}
+		creds = selected
+	}
+	return encodeFile(em, creds)
+}
+
+// Import adds the remotes of an export made with Export. Remotes that are
+// already configured are skipped unless overwrite is set. It returns the
+// names of the imported and of the skipped remotes.
+func (cm *CredentialManager) Import(data []byte, password string, overwrite bool) (imported, skipped []string, err error) {
+	em, err := encryption.NewEncryptionManager(password)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create encryption manager: %w", err)
+	}
+	incoming, err := decodeFile(em, data)
+	if errors.Is(err, ErrWrongPassword) {
+		return nil, nil, errors.New("wrong export password")
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cm.mutex.Lock()
+	defer cm.mutex.Unlock()
+
+	creds, err := cm.load()
+	if err != nil {
+		return nil, nil, err
+	}
+	for name, cred := range incoming {
+		if err := ValidateRemoteName(name); err != nil {
+			return nil, nil, fmt.Errorf("export contains an %w", err)
+		}
+		if _, exists := creds[name]; exists && !overwrite {
+			skipped = append(skipped, name)
+			continue
+		}
+		cred.Name = name
+		creds[name] = cred
+		imported = append(imported, name)
+	}
+	sort.Strings(imported)
+	sort.Strings(skipped)
+
+	if len(imported) == 0 {
+		return imported, skipped, nil
+	}
+	return imported, skipped, cm.save(creds)
+}
@@ -0,0 +1,169 @@
+package credentials
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/amankumarsingh77/automated_backup_tool/internal/security/encryption"
+)
+
+var ErrWrongPassword = errors.New("wrong master password")
+
+// fileVersion is the current layout of the credentials file. Version 1 was
+// the bare encrypted credential map, without a password check.
+const fileVersion = 2
+
+// passwordCheck is encrypted into every credentials file. Decrypting it
+// tells a wrong master password apart from a damaged file.
+const passwordCheck = "automated_backup_tool credentials"
+
+// credentialFile is the layout of the credentials file on disk. Check and
+// Data are encrypted with the master password.
+type credentialFile struct {
+	Version int    `json:"version"`
+	Check   string `json:"check"`
+	Data    string `json:"data"`
+}
+
+// load decrypts the credentials file. A missing file holds no credentials.
+func (cm *CredentialManager) load() (map[string]Credential, error) {
+	raw, err := os.ReadFile(cm.credentialsFile)
+	if os.IsNotExist(err) {
+		return make(map[string]Credential), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read credentials file: %w", err)
+	}
+
+	creds, err := decodeFile(cm.encryptionManager, raw)
+	if errors.Is(err, errDamaged) {
+		return nil, fmt.Errorf("%w, the previous version is kept in %s", err, cm.backupFile())
+	}
+	return creds, err
+}
+
+var errDamaged = errors.New("credentials file is damaged")
+
+// decodeFile decrypts a credentials file, or an export, with em.
+func decodeFile(em *encryption.EncryptionManager, raw []byte) (map[string]Credential, error) {
+	data, err := decryptFile(em, raw)
+	if err != nil {
+		return nil, err
+	}
+
+	creds := make(map[string]Credential)
+	if err := json.Unmarshal(data, &creds); err != nil {
+		return nil, fmt.Errorf("failed to parse credentials: %w", err)
+	}
+	return creds, nil
+}
+
+func decryptFile(em *encryption.EncryptionManager, raw []byte) ([]byte, error) {
+	if !bytes.HasPrefix(bytes.TrimSpace(raw), []byte("{")) {
+		// A version 1 file cannot tell a wrong password from damage. It
+		// is rewritten in the current layout on the next save.
+		data, err := em.Decrypt(bytes.TrimSpace(raw))
+		if err != nil {
+			return nil, ErrWrongPassword
+		}
+		return data, nil
+	}
+
+	var file credentialFile
+	if err := json.Unmarshal(raw, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse credentials file: %w", err)
+	}
+	if file.Version > fileVersion {
+		return nil, fmt.Errorf("credentials file version %d is newer than this release supports", file.Version)
+	}
+
+	check, err := em.Decrypt([]byte(file.Check))
+	if err != nil || string(check) != passwordCheck {
+		return nil, ErrWrongPassword
+	}
+	data, err := em.Decrypt([]byte(file.Data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errDamaged, err)
+	}
+	return data, nil
+}
+
+// encodeFile encrypts creds with em in the current file layout.
+func encodeFile(em *encryption.EncryptionManager, creds map[string]Credential) ([]byte, error) {
+	data, err := json.Marshal(creds)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal credentials: %w", err)
+	}
+
+	check, err := em.Encrypt([]byte(passwordCheck))
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt credentials: %w", err)
+	}
+	encrypted, err := em.Encrypt(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt credentials: %w", err)
+	}
+	file, err := json.Marshal(credentialFile{
+		Version: fileVersion,
+		Check:   string(check),
+		Data:    string(encrypted),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal credentials: %w", err)
+	}
+	return file, nil
+}
+
+// save encrypts creds into the credentials file. The file is replaced
+// atomically, and the version it replaces is kept as a backup copy.
+func (cm *CredentialManager) save(creds map[string]Credential) error {
+	file, err := encodeFile(cm.encryptionManager, creds)
+	if err != nil {
+		return err
+	}
+
+	if previous, err := os.ReadFile(cm.credentialsFile); err == nil {
+		if err := writeFileAtomic(cm.backupFile(), previous); err != nil {
+			return fmt.Errorf("failed to back up credentials file: %w", err)
+		}
+	}
+	if err := writeFileAtomic(cm.credentialsFile, file); err != nil {
+		return fmt.Errorf("failed to write credentials file: %w", err)
+	}
+	return nil
+}
+
+func (cm *CredentialManager) backupFile() string {
+	return cm.credentialsFile + ".bak"
+}
+
+// writeFileAtomic writes data to a temporary file next to path and renames
+// it into place, so a crash never leaves a truncated file behind.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,155 @@
+// Package secret reads passwords and keys from places other than the
+// command line, where they would end up in the shell history and in ps.
+package secret
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// Source is where a secret comes from:
+//
+//	env:NAME     the environment variable NAME
+//	file:PATH    the contents of the file at PATH
+//	fd:N         everything read from the open file descriptor N
+//	cmd:COMMAND  the output of COMMAND, run by the shell
+//	prompt       typed on the terminal without echo
+//
+// A single trailing newline is dropped from files, descriptors and
+// commands.
+type Source string
+
+// Prompt asks for the secret on the terminal.
+const Prompt Source = "prompt"
+
+// Validate checks that s names a known kind of source.
+func (s Source) Validate() error {
+	if s == Prompt {
+		return nil
+	}
+	kind, value, ok := strings.Cut(string(s), ":")
+	if !ok || value == "" {
+		return fmt.Errorf("invalid secret source %q, expected env:, file:, fd:, cmd: or prompt", string(s))
+	}
+	switch kind {
+	case "env", "file", "cmd":
+		return nil
+	case "fd":
+		if fd, err := strconv.Atoi(value); err != nil || fd < 0 {
+			return fmt.Errorf("invalid file descriptor in secret source %q", string(s))
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown secret source %q, expected env:, file:, fd:, cmd: or prompt", kind)
+}
+
+// ValidateRepeatable checks that s can be read again on every use, by any
+// later process, as the key of a task must be: env:, file: or cmd:. A
+// descriptor is used up by the first read and only exists in the process
+// that inherited it, and a scheduled run has nobody to answer a prompt.
+func (s Source) ValidateRepeatable() error {
+	if err := s.Validate(); err != nil {
+		return err
+	}
+	if kind, _, _ := strings.Cut(string(s), ":"); s == Prompt || kind == "fd" {
+		return fmt.Errorf("secret source %q can only be read once, use env:, file: or cmd:", string(s))
+	}
+	return nil
+}
+
+// Read returns the secret. label names it when prompting.
+func (s Source) Read(label string) (string, error) {
+	if err := s.Validate(); err != nil {
+		return "", err
+	}
+	if s == Prompt {
+		return ReadPrompt(label)
+	}
+
+	kind, value, _ := strings.Cut(string(s), ":")
+	var secret string
+	switch kind {
+	case "env":
+		v, ok := os.LookupEnv(value)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set", value)
+		}
+		return v, nil
+	case "file":
+		data, err := os.ReadFile(value)
+		if err != nil {
+			return "", fmt.Errorf("failed to read secret file: %w", err)
+		}
+		secret = string(data)
+	case "fd":
+		fd, _ := strconv.Atoi(value)
+		f := os.NewFile(uintptr(fd), "fd"+value)
+		data, err := io.ReadAll(f)
+		f.Close()
+		if err != nil {
+			return "", fmt.Errorf("failed to read secret from file descriptor %d: %w", fd, err)
+		}
+		secret = string(data)
+	case "cmd":
+		out, err := shellCommand(value).Output()
+		if err != nil {
+			return "", fmt.Errorf("secret command failed: %w", err)
+		}
+		secret = string(out)
+	}
+
+	secret = strings.TrimSuffix(secret, "\n")
+	secret = strings.TrimSuffix(secret, "\r")
+	if secret == "" {
+		return "", fmt.Errorf("secret from %s is empty", kind)
+	}
+	return secret, nil
+}
+
+// shellCommand runs command the way a user would type it. Its stdin and
+// stderr stay attached, so helpers such as pass can ask for a passphrase.
+func shellCommand(command string) *exec.Cmd {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", command)
+	} else {
+		cmd = exec.Command("sh", "-c", command)
+	}
+	cmd.Stdin = os.Stdin
+	cmd.Stderr = os.Stderr
+	return cmd
+}
+
+// ErrNoTerminal is returned when a prompt is needed but nobody is there to
+// answer it, as under cron or systemd.
+var ErrNoTerminal = errors.New("cannot prompt for a secret: stdin is not a terminal")
+
+// CanPrompt reports whether stdin is an interactive terminal.
+func CanPrompt() bool {
+	return term.IsTerminal(int(os.Stdin.Fd()))
+}
+
+// ReadPrompt asks for a secret on the terminal without echoing it.
+func ReadPrompt(label string) (string, error) {
+	if !CanPrompt() {
+		return "", ErrNoTerminal
+	}
+	fmt.Fprintf(os.Stderr, "%s: ", label)
+	data, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", strings.ToLower(label), err)
+	}
+	if len(data) == 0 {
+		return "", fmt.Errorf("%s must not be empty", strings.ToLower(label))
+	}
+	return string(data), nil
+}
@@ -0,0 +1,56 @@
+package secret
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSourceRead(t *testing.T) {
+	t.Setenv("BACKUP_TEST_SECRET", "from-env")
+
+	file := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(file, []byte("from-file\n"), 0600); err != nil {
+		t.Fatalf("Failed to write secret file: %v", err)
+	}
+
+	tests := []struct {
+		source Source
+		want   string
+	}{
+		{"env:BACKUP_TEST_SECRET", "from-env"},
+		{Source("file:" + file), "from-file"},
+		{"cmd:echo from-cmd", "from-cmd"},
+	}
+	for _, tt := range tests {
+		got, err := tt.source.Read("Secret")
+		if err != nil {
+			t.Errorf("%s: %v", tt.source, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.source, got, tt.want)
+		}
+	}
+}
+
+func TestSourceValidateRepeatable(t *testing.T) {
+	for _, source := range []Source{"env:KEY", "file:/etc/key", "cmd:pass show backup"} {
+		if err := source.ValidateRepeatable(); err != nil {
+			t.Errorf("%s: %v", source, err)
+		}
+	}
+	for _, source := range []Source{"fd:3", Prompt, "vault:backup"} {
+		if err := source.ValidateRepeatable(); err == nil {
+			t.Errorf("%s: expected an error", source)
+		}
+	}
+}
+
+func TestSourceErrors(t *testing.T) {
+	for _, source := range []Source{"hunter2", "env:", "fd:x", "fd:-1", "vault:backup", "env:BACKUP_TEST_UNSET", "cmd:exit 1", "cmd:true"} {
+		if _, err := source.Read("Secret"); err == nil {
+			t.Errorf("%s: expected an error", source)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+//go:build unix
+
+package secret
+
+import (
+	"os"
+	"strconv"
+	"syscall"
+	"testing"
+)
+
+func TestSourceReadFileDescriptor(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("Failed to create pipe: %v", err)
+	}
+	defer r.Close()
+	w.WriteString("from-fd\r\n")
+	w.Close()
+
+	// Read closes the descriptor it is given, so hand it a copy.
+	fd, err := syscall.Dup(int(r.Fd()))
+	if err != nil {
+		t.Fatalf("Failed to duplicate descriptor: %v", err)
+	}
+	got, err := Source("fd:" + strconv.Itoa(fd)).Read("Secret")
+	if err != nil {
+		t.Fatalf("Failed to read secret: %v", err)
+	}
+	if got != "from-fd" {
+		t.Errorf("got %q, want %q", got, "from-fd")
+	}
+}
@@ -0,0 +1,66 @@
+package gdrive
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/amankumarsingh77/automated_backup_tool/internal/storage"
+)
+
+// Changes reads the Drive changes feed. Drive reports the changes of the
+// whole account, or of the whole Shared Drive when one is configured;
+// remotePath does not narrow them down.
+func (p *GoogleDriveProvider) Changes(ctx context.Context, remotePath, cursor string) ([]storage.Change, string, error) {
+	if p.service == nil {
+		err := p.Authenticate(ctx)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	if cursor == "" {
+		call := p.service.Changes.GetStartPageToken().SupportsAllDrives(true)
+		if p.driveId != "" {
+			call = call.DriveId(p.driveId)
+		}
+		start, err := call.Context(ctx).Do()
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to get start page token: %w", err)
+		}
+		return nil, start.StartPageToken, nil
+	}
+
+	var changes []storage.Change
+	pageToken := cursor
+	for {
+		call := p.service.Changes.List(pageToken).IncludeRemoved(true).Spaces("drive").PageSize(1000).
+			SupportsAllDrives(true)
+		if p.driveId != "" {
+			call = call.IncludeItemsFromAllDrives(true).DriveId(p.driveId)
+		}
+		list, err := call.
+			Fields("nextPageToken, newStartPageToken, changes(fileId, removed, file(" + fileFields + ", parents, trashed))").
+			Context(ctx).Do()
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to list changes: %w", err)
+		}
+
+		for _, change := range list.Changes {
+			c := storage.Change{ID: change.FileId}
+			if change.Removed || change.File == nil || change.File.Trashed {
+				c.Removed = true
+			} else {
+				c.Object = p.fileObject(change.File.Name, change.File)
+				if len(change.File.Parents) > 0 {
+					c.ParentID = change.File.Parents[0]
+				}
+			}
+			changes = append(changes, c)
+		}
+
+		if list.NewStartPageToken != "" {
+			return changes, list.NewStartPageToken, nil
+		}
+		pageToken = list.NextPageToken
+	}
+}
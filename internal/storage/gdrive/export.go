@@ -0,0 +1,86 @@
+package gdrive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/amankumarsingh77/automated_backup_tool/internal/storage"
+	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/googleapi"
+)
+
+// googleAppsPrefix starts the MIME type of documents that live only in
+// Drive and have no file content of their own.
+const googleAppsPrefix = "application/vnd.google-apps."
+
+type exportFormat struct {
+	mimeType  string
+	extension string
+}
+
+// exportFormats maps the types of Google documents to the file formats
+// they are downloaded as, by the export_format option. Types missing here,
+// such as Forms and Sites, cannot be exported.
+var exportFormats = map[string]map[string]exportFormat{
+	"office": {
+		googleAppsPrefix + "document":     {"application/vnd.openxmlformats-officedocument.wordprocessingml.document", ".docx"},
+		googleAppsPrefix + "spreadsheet":  {"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", ".xlsx"},
+		googleAppsPrefix + "presentation": {"application/vnd.openxmlformats-officedocument.presentationml.presentation", ".pptx"},
+		googleAppsPrefix + "drawing":      {"image/svg+xml", ".svg"},
+		googleAppsPrefix + "script":       {"application/vnd.google-apps.script+json", ".json"},
+	},
+	"pdf": {
+		googleAppsPrefix + "document":     {"application/pdf", ".pdf"},
+		googleAppsPrefix + "spreadsheet":  {"application/pdf", ".pdf"},
+		googleAppsPrefix + "presentation": {"application/pdf", ".pdf"},
+		googleAppsPrefix + "drawing":      {"application/pdf", ".pdf"},
+		googleAppsPrefix + "script":       {"application/vnd.google-apps.script+json", ".json"},
+	},
+}
+
+// isGoogleDocument reports whether mimeType is a Google document, which
+// has to be exported instead of downloaded.
+func isGoogleDocument(mimeType string) bool {
+	return strings.HasPrefix(mimeType, googleAppsPrefix) && mimeType != folderMimeType
+}
+
+// export converts a Google document to the configured export format. The
+// export endpoint refuses documents larger than 10 MB, those are fetched
+// through the export link Drive offers for the format instead.
+func (p *GoogleDriveProvider) export(ctx context.Context, file *drive.File) (*http.Response, error) {
+	format, ok := exportFormats[p.exportFormat][file.MimeType]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s cannot be exported", storage.ErrUnsupported, file.MimeType)
+	}
+
+	resp, err := p.service.Files.Export(file.Id, format.mimeType).Context(ctx).Download()
+	var apiErr *googleapi.Error
+	if err == nil || !errors.As(err, &apiErr) || apiErr.Code != http.StatusForbidden {
+		return resp, err
+	}
+
+	links, err := p.service.Files.Get(file.Id).SupportsAllDrives(true).Fields("exportLinks").Context(ctx).Do()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get export links: %w", err)
+	}
+	link, ok := links.ExportLinks[format.mimeType]
+	if !ok {
+		return nil, fmt.Errorf("%w: no export link for %s", storage.ErrUnsupported, format.mimeType)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, link, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err = p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("export link returned %s", resp.Status)
+	}
+	return resp, nil
+}
@@ -2,18 +2,20 @@ package gdrive
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
-	"log"
 	"net/http"
 	"os"
-	"os/exec"
+	"path"
 	"path/filepath"
-	"runtime"
+	"strconv"
 	"strings"
 	"time"
 
-	"github.com/amankumarsingh77/automated_backup_tool/internal/utils/filesystem"
+	"github.com/amankumarsingh77/automated_backup_tool/internal/storage"
+	"github.com/amankumarsingh77/automated_backup_tool/internal/storage/oauthutil"
+	"github.com/amankumarsingh77/automated_backup_tool/internal/utils"
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
 	"google.golang.org/api/drive/v3"
@@ -22,12 +24,82 @@ import (
 
 type GoogleDriveProvider struct {
 	config  *oauth2.Config
-	token   *oauth2.Token
+	tokens  oauthutil.TokenStore
 	service *drive.Service
+	// loginMode is one of the oauthutil login modes and decides how a new
+	// token is obtained when there is no usable one.
+	loginMode string
+	// client is the authorized HTTP client used for resumable uploads,
+	// which the Drive client library does not expose.
+	client *http.Client
+	// folderIds caches the IDs of folders already resolved from a path, so
+	// repeated uploads into the same folder skip the lookup chain.
+	folderIds map[string]string
+	// chunkSize is the size of each resumable upload request. Files no
+	// larger than one chunk are sent in a single request.
+	chunkSize  int64
+	uploadURL  string
+	sessionDir string
+	// name is the remote the provider is instantiated for. Its upload
+	// sessions belong to its account, so they are saved per remote.
+	name string
+	// exportFormat names the entry of exportFormats used to download
+	// Google Docs, Sheets and Slides.
+	exportFormat string
+	// sharedDrive is the name or ID of the Shared Drive backups are stored
+	// in, driveId its ID once resolved. Without one paths start at My
+	// Drive.
+	sharedDrive string
+	driveId     string
+}
+
+func init() {
+	storage.Register("gdrive", func(cfg storage.Config) (storage.StorageProvider, error) {
+		if cfg.Credential == nil || cfg.Credential.Key == "" || cfg.Credential.Secret == "" {
+			return nil, fmt.Errorf("gdrive requires an OAuth client ID and secret, run configure first")
+		}
+		if cfg.Tokens == nil {
+			return nil, fmt.Errorf("gdrive requires a token store")
+		}
+		p := NewGoogleDriveProvider()
+		p.name = cfg.Name
+		p.SetCredentials(cfg.Credential.Key, cfg.Credential.Secret, cfg.Credential.RedirectURL)
+		// Older releases kept the token of the default remote in
+		// google-drive-token.json.
+		legacyName := "google-drive"
+		if cfg.Name != "" && cfg.Name != "gdrive" {
+			legacyName = cfg.Name
+		}
+		p.tokens = oauthutil.MigrateTokenFile(cfg.Tokens, legacyName)
+		p.loginMode = cfg.Credential.Options["login"]
+		if err := oauthutil.ValidateLoginMode(p.loginMode); err != nil {
+			return nil, err
+		}
+		if chunkSize := cfg.Credential.Options["chunk_size"]; chunkSize != "" {
+			mb, err := strconv.ParseInt(chunkSize, 10, 64)
+			if err != nil || mb <= 0 {
+				return nil, fmt.Errorf("invalid chunk_size %q, expected a size in MB", chunkSize)
+			}
+			p.chunkSize = mb << 20
+		}
+		if format := cfg.Credential.Options["export_format"]; format != "" {
+			if _, ok := exportFormats[format]; !ok {
+				return nil, fmt.Errorf("invalid export_format %q, expected office or pdf", format)
+			}
+			p.exportFormat = format
+		}
+		p.sharedDrive = cfg.Credential.Options["shared_drive"]
+		return p, nil
+	})
 }
 
 func NewGoogleDriveProvider() *GoogleDriveProvider {
-	return &GoogleDriveProvider{}
+	return &GoogleDriveProvider{
+		folderIds:    make(map[string]string),
+		chunkSize:    defaultChunkSize,
+		uploadURL:    driveUploadURL,
+		exportFormat: "office",
+	}
 }
 
 func (p *GoogleDriveProvider) SetCredentials(clientID, clientSecret, redirectURL string) {
@@ -42,175 +114,140 @@ func (p *GoogleDriveProvider) SetCredentials(clientID, clientSecret, redirectURL
 	}
 }
 
-func (p *GoogleDriveProvider) Authenticate() error {
-	token, err := filesystem.GetToken("google-drive")
-	if err == nil && token.Valid() {
-		p.token = token
-		client := p.config.Client(context.Background(), p.token)
-		if p.service, err = drive.NewService(context.Background(), option.WithHTTPClient(client)); err != nil {
-			return fmt.Errorf("failed to create drive service: %v", err)
+func (p *GoogleDriveProvider) Authenticate(ctx context.Context) error {
+	token, err := p.tokens.LoadToken()
+	if err == nil && (token.Valid() || token.RefreshToken != "") {
+		ts := oauthutil.TokenSource(p.config, token, p.tokens)
+		// Refresh right away, so a revoked grant leads to a new login
+		// instead of failing the first request.
+		if _, err := ts.Token(); err == nil {
+			return p.useTokenSource(ctx, ts)
 		}
-		return nil
+		utils.GetLogger().Warning("Saved Google Drive token of %s could not be refreshed, logging in again: %v", p.name, err)
 	}
 
-	codeChan := make(chan string, 1)
-	errChan := make(chan error, 1)
-
-	server := &http.Server{Addr: ":8080"}
-
-	http.HandleFunc("/callback", func(w http.ResponseWriter, r *http.Request) {
-		code := r.URL.Query().Get("code")
-		if code == "" {
-			errChan <- fmt.Errorf("no code in callback")
-			w.Write([]byte("Authentication failed. You can close this window."))
-			return
-		}
-
-		codeChan <- code
-		w.Write([]byte("Authentication successful! You can close this window."))
-
-		go func() {
-			time.Sleep(time.Second)
-			server.Shutdown(context.Background())
-		}()
-	})
-
-	go func() {
-		if err := server.ListenAndServe(); err != http.ErrServerClosed {
-			errChan <- fmt.Errorf("failed to start server: %v", err)
-		}
-	}()
-
-	authURL := p.config.AuthCodeURL("state-token", oauth2.AccessTypeOffline)
-	log.Println(authURL)
-
-	if err := openBrowser(authURL); err != nil {
-		return fmt.Errorf("failed to open browser: %v", err)
+	config := p.config
+	if p.loginMode == oauthutil.LoginDevice {
+		config = p.deviceConfig()
+	}
+	token, err = oauthutil.Login(ctx, config, p.loginMode)
+	if err != nil {
+		return err
 	}
 
-	select {
-	case code := <-codeChan:
-
-		token, err := p.config.Exchange(context.Background(), code)
-		if err != nil {
-			return fmt.Errorf("failed to exchange token: %v", err)
-		}
-		p.token = token
-
-		err = filesystem.SaveTokenLocally("google-drive", p.token)
-		if err != nil {
-			return fmt.Errorf("failed to save token locally : %v", err)
-		}
-
-		client := p.config.Client(context.Background(), p.token)
-		p.service, err = drive.NewService(context.Background(), option.WithHTTPClient(client))
-		if err != nil {
-			return fmt.Errorf("failed to create drive service: %v", err)
-		}
+	err = p.tokens.SaveToken(token)
+	if err != nil {
+		return fmt.Errorf("failed to save token: %v", err)
+	}
 
-		return nil
+	return p.useTokenSource(ctx, oauthutil.TokenSource(p.config, token, p.tokens))
+}
 
-	case err := <-errChan:
-		return err
+// deviceConfig returns the OAuth configuration for the device flow. Google
+// only grants the per-file Drive scope to devices, which still covers every
+// file and folder the tool creates itself, but not existing folders to back
+// up, see CheckSource.
+func (p *GoogleDriveProvider) deviceConfig() *oauth2.Config {
+	config := *p.config
+	config.Scopes = []string{drive.DriveFileScope}
+	return &config
+}
 
-	case <-time.After(2 * time.Minute):
-		return fmt.Errorf("authentication timed out")
+// CheckSource rejects remotes signed in with device login, which cannot
+// list or download the Drive folders the tool did not create.
+func (p *GoogleDriveProvider) CheckSource() error {
+	if p.loginMode == oauthutil.LoginDevice {
+		return errors.New("device login only reaches the files this tool uploads to Google Drive, so it cannot back up existing Drive folders; configure the remote with browser or manual login")
 	}
+	return nil
 }
 
-func openBrowser(url string) error {
-	var err error
-	switch runtime.GOOS {
-	case "windows":
-		err = exec.Command("cmd", "/c", "start", url).Start()
-	case "darwin":
-		err = exec.Command("open", url).Start()
-	case "linux":
-		err = exec.Command("xdg-open", url).Start()
-	default:
-		err = fmt.Errorf("unsupported platform")
-	}
-	return err
+func (p *GoogleDriveProvider) useTokenSource(ctx context.Context, ts oauth2.TokenSource) error {
+	p.client = oauth2.NewClient(context.Background(), ts)
+	service, err := drive.NewService(ctx, option.WithHTTPClient(p.client))
+	if err != nil {
+		return fmt.Errorf("failed to create drive service: %v", err)
+	}
+	p.service = service
+	return p.resolveSharedDrive(ctx)
 }
 
-func (p *GoogleDriveProvider) Upload(isSingle bool, localPath, remotePath string) error {
+func (p *GoogleDriveProvider) Upload(ctx context.Context, localPath, remotePath string) error {
 	if p.service == nil {
-		err := p.Authenticate()
+		err := p.Authenticate(ctx)
 		if err != nil {
 			return err
 		}
 	}
-	done := make(chan error)
 
-	remotePath = strings.ReplaceAll(filepath.Dir(filepath.Clean(remotePath)), "\\", "/")
+	remotePath = storage.CleanPath(remotePath)
 
-	go func() {
-		file, err := os.Open(localPath)
-		if err != nil {
-			done <- fmt.Errorf("failed to open file: %w", err)
-			return
-		}
-		defer file.Close()
+	file, err := os.Open(localPath)
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
 
-		folderId, err := p.getOrCreateFolder(remotePath)
-		if err != nil {
-			done <- fmt.Errorf("failed to create/get folder: %w", err)
-			return
-		}
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat file: %w", err)
+	}
+	if info.Size() > p.chunkSize {
+		return p.uploadResumable(ctx, file, info.Size(), remotePath)
+	}
 
-		fileName := filepath.Base(localPath)
+	folderId, err := p.getOrCreateFolder(ctx, path.Dir(remotePath))
+	if err != nil {
+		return fmt.Errorf("failed to create/get folder: %w", err)
+	}
 
-		if existingFileId, exists := p.isFileExist(fileName, folderId); exists {
-			fileMeta := &drive.File{}
-			_, err = p.service.Files.Update(existingFileId, fileMeta).Media(file).Do()
-			if err != nil {
-				done <- fmt.Errorf("failed to update existing file: %w", err)
-				return
-			}
-		} else {
-			fileMeta := &drive.File{
-				Name:    fileName,
-				Parents: []string{folderId},
-			}
+	fileName := path.Base(remotePath)
 
-			_, err = p.service.Files.Create(fileMeta).Media(file).Do()
-			if err != nil {
-				done <- fmt.Errorf("failed to upload file: %w", err)
-				return
-			}
+	if existingFileId, exists := p.isFileExist(ctx, fileName, folderId); exists {
+		fileMeta := &drive.File{}
+		_, err = p.service.Files.Update(existingFileId, fileMeta).SupportsAllDrives(true).Media(file).Context(ctx).Do()
+		if err != nil {
+			return fmt.Errorf("failed to update existing file: %w", err)
 		}
+		return nil
+	}
 
-		done <- nil
-	}()
+	fileMeta := &drive.File{
+		Name:    fileName,
+		Parents: []string{folderId},
+	}
 
-	select {
-	case err := <-done:
-		return err
-	case <-time.After(2 * time.Hour):
-		return fmt.Errorf("upload timed out after 2 hours")
+	_, err = p.service.Files.Create(fileMeta).SupportsAllDrives(true).Media(file).Context(ctx).Do()
+	if err != nil {
+		return fmt.Errorf("failed to upload file: %w", err)
 	}
+	return nil
 }
 
-func (p *GoogleDriveProvider) Download(localPath, fileId string) error {
+func (p *GoogleDriveProvider) Download(ctx context.Context, localPath, remotePath string) error {
 	if p.service == nil {
-		err := p.Authenticate()
+		err := p.Authenticate(ctx)
 		if err != nil {
 			return err
 		}
 	}
 
+	file, err := p.findFile(ctx, remotePath)
+	if err != nil {
+		return fmt.Errorf("failed to get file metadata: %w", err)
+	}
+
 	dir := filepath.Dir(localPath)
 	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
 		return fmt.Errorf("failed to create directory: %w", err)
 	}
 
-	file, err := p.service.Files.Get(fileId).Fields("name").Do()
-	if err != nil {
-		return fmt.Errorf("failed to get file metadata: %w", err)
+	var resp *http.Response
+	if isGoogleDocument(file.MimeType) {
+		resp, err = p.export(ctx, file)
+	} else {
+		resp, err = p.service.Files.Get(file.Id).SupportsAllDrives(true).Context(ctx).Download()
 	}
-
-	localPath = filepath.Join(localPath, file.Name)
-	resp, err := p.service.Files.Get(fileId).Download()
 	if err != nil {
 		return fmt.Errorf("failed to download file: %w", err)
 	}
@@ -229,95 +266,249 @@ func (p *GoogleDriveProvider) Download(localPath, fileId string) error {
 	return nil
 }
 
-func (p *GoogleDriveProvider) Delete(fileId string) error {
+func (p *GoogleDriveProvider) Delete(ctx context.Context, remotePath string) error {
 	if p.service == nil {
-		err := p.Authenticate()
+		err := p.Authenticate(ctx)
 		if err != nil {
 			return err
 		}
 	}
 
-	if err := p.service.Files.Delete(fileId).Do(); err != nil {
+	file, err := p.findFile(ctx, remotePath)
+	if err != nil {
 		return fmt.Errorf("failed to delete file: %w", err)
 	}
+	if err := p.service.Files.Delete(file.Id).SupportsAllDrives(true).Context(ctx).Do(); err != nil {
+		return fmt.Errorf("failed to delete file: %w", err)
+	}
+	if file.MimeType == folderMimeType {
+		p.forgetFolders(storage.CleanPath(remotePath))
+	}
 	return nil
 }
 
-func (p *GoogleDriveProvider) ListFiles(folderId string) ([]*drive.File, error) {
+func (p *GoogleDriveProvider) Stat(ctx context.Context, remotePath string) (storage.RemoteObject, error) {
 	if p.service == nil {
-		err := p.Authenticate()
+		err := p.Authenticate(ctx)
 		if err != nil {
-			return nil, err
+			return storage.RemoteObject{}, err
 		}
 	}
 
-	var files []*drive.File
-	query := fmt.Sprintf("'%s' in parents", folderId)
-	pageToken := ""
+	file, err := p.findFile(ctx, remotePath)
+	if err != nil {
+		return storage.RemoteObject{}, fmt.Errorf("failed to stat file: %w", err)
+	}
+	return p.fileObject(storage.CleanPath(remotePath), file), nil
+}
 
-	for {
-		fileList, err := p.service.Files.List().Q(query).PageToken(pageToken).Do()
+const folderMimeType = "application/vnd.google-apps.folder"
+
+// ListFiles walks the folder tree below remotePath breadth first. Drive has
+// no recursive listing, so every folder costs at least one request.
+func (p *GoogleDriveProvider) ListFiles(ctx context.Context, remotePath string) ([]storage.RemoteObject, error) {
+	if p.service == nil {
+		err := p.Authenticate(ctx)
 		if err != nil {
-			return nil, fmt.Errorf("failed to list files: %w", err)
+			return nil, err
 		}
+	}
 
-		files = append(files, fileList.Files...)
+	remotePath = storage.CleanPath(remotePath)
+	folderId, err := p.findFolder(ctx, remotePath)
+	if err != nil {
+		return nil, err
+	}
 
-		if fileList.NextPageToken == "" {
-			break
+	type folder struct{ id, path string }
+	var objects []storage.RemoteObject
+	pending := []folder{{folderId, remotePath}}
+
+	for len(pending) > 0 {
+		current := pending[0]
+		pending = pending[1:]
+
+		query := fmt.Sprintf("'%s' in parents and trashed = false", current.id)
+		pageToken := ""
+		for {
+			fileList, err := p.listFiles(query).
+				Fields("nextPageToken, files(" + fileFields + ")").
+				PageToken(pageToken).Context(ctx).Do()
+			if err != nil {
+				return nil, fmt.Errorf("failed to list files: %w", err)
+			}
+
+			for _, file := range fileList.Files {
+				object := p.fileObject(path.Join(current.path, file.Name), file)
+				if object.IsDir {
+					pending = append(pending, folder{file.Id, object.Path})
+				}
+				objects = append(objects, object)
+			}
+
+			if fileList.NextPageToken == "" {
+				break
+			}
+			pageToken = fileList.NextPageToken
 		}
-		pageToken = fileList.NextPageToken
 	}
 
-	return files, nil
+	return objects, nil
+}
+
+// fileFields are the file attributes needed to build a RemoteObject.
+const fileFields = "id, name, mimeType, size, modifiedTime, md5Checksum"
+
+func (p *GoogleDriveProvider) fileObject(remotePath string, file *drive.File) storage.RemoteObject {
+	object := storage.RemoteObject{
+		Path:     remotePath,
+		ID:       file.Id,
+		Size:     file.Size,
+		IsDir:    file.MimeType == folderMimeType,
+		Metadata: map[string]string{"mime_type": file.MimeType},
+	}
+	if modTime, err := time.Parse(time.RFC3339, file.ModifiedTime); err == nil {
+		object.ModTime = modTime
+	}
+	if file.Md5Checksum != "" {
+		object.Hash = "md5:" + file.Md5Checksum
+	}
+	if format, ok := exportFormats[p.exportFormat][file.MimeType]; ok {
+		object.Metadata[storage.MetaExportExtension] = format.extension
+	}
+	return object
+}
+
+// findFile resolves remotePath to the file or folder stored there. Drive
+// allows several files with the same name in one folder; the most recently
+// modified one wins.
+func (p *GoogleDriveProvider) findFile(ctx context.Context, remotePath string) (*drive.File, error) {
+	remotePath = storage.CleanPath(remotePath)
+	if remotePath == "." {
+		return p.service.Files.Get(p.rootId()).SupportsAllDrives(true).Fields(fileFields).Context(ctx).Do()
+	}
+
+	folderId, err := p.findFolder(ctx, path.Dir(remotePath))
+	if err != nil {
+		return nil, err
+	}
+
+	query := fmt.Sprintf("name = '%s' and '%s' in parents and trashed = false",
+		strings.Replace(path.Base(remotePath), "'", "\\'", -1), folderId)
+	r, err := p.listFiles(query).Fields("files(" + fileFields + ")").
+		OrderBy("modifiedTime desc").Context(ctx).Do()
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up %s: %w", remotePath, err)
+	}
+	if len(r.Files) == 0 {
+		return nil, fmt.Errorf("%w: %s", storage.ErrNotFound, remotePath)
+	}
+	return r.Files[0], nil
+}
+
+func (p *GoogleDriveProvider) lookupFolder(ctx context.Context, name, parentId string) (string, bool, error) {
+	escapedName := strings.Replace(name, "'", "\\'", -1)
+	query := fmt.Sprintf("name = '%s' and mimeType = '%s' and '%s' in parents and trashed = false",
+		escapedName, folderMimeType, parentId)
+
+	r, err := p.listFiles(query).Fields("files(id, name)").Context(ctx).Do()
+	if err != nil {
+		return "", false, fmt.Errorf("failed to list folders: %w", err)
+	}
+
+	if len(r.Files) == 0 {
+		return "", false, nil
+	}
+	return r.Files[0].Id, true, nil
 }
 
-func (p *GoogleDriveProvider) getOrCreateFolder(path string) (string, error) {
-	parts := strings.Split(strings.Trim(path, "/"), "/")
-	parentId := "root"
+func (p *GoogleDriveProvider) findFolder(ctx context.Context, folderPath string) (string, error) {
+	parentId := p.rootId()
+	current := ""
 
-	for _, part := range parts {
-		if part == "" {
+	for _, part := range strings.Split(folderPath, "/") {
+		if part == "" || part == "." {
+			continue
+		}
+		current = path.Join(current, part)
+		if folderId, ok := p.folderIds[current]; ok {
+			parentId = folderId
 			continue
 		}
 
-		escapedName := strings.Replace(part, "'", "\\'", -1)
-		query := fmt.Sprintf("name = '%s' and mimeType = 'application/vnd.google-apps.folder' and '%s' in parents and trashed = false",
-			escapedName, parentId)
+		folderId, found, err := p.lookupFolder(ctx, part, parentId)
+		if err != nil {
+			return "", err
+		}
+		if !found {
+			return "", fmt.Errorf("%w: folder %s", storage.ErrNotFound, folderPath)
+		}
+		p.folderIds[current] = folderId
+		parentId = folderId
+	}
 
-		r, err := p.service.Files.List().Q(query).Fields("files(id, name)").Do()
+	return parentId, nil
+}
+
+func (p *GoogleDriveProvider) getOrCreateFolder(ctx context.Context, folderPath string) (string, error) {
+	parentId := p.rootId()
+	current := ""
+
+	for _, part := range strings.Split(folderPath, "/") {
+		if part == "" || part == "." {
+			continue
+		}
+		current = path.Join(current, part)
+		if folderId, ok := p.folderIds[current]; ok {
+			parentId = folderId
+			continue
+		}
+
+		folderId, found, err := p.lookupFolder(ctx, part, parentId)
 		if err != nil {
-			return "", fmt.Errorf("failed to list folders: %w", err)
+			return "", err
 		}
 
-		if len(r.Files) > 0 {
-			parentId = r.Files[0].Id
+		if found {
+			p.folderIds[current] = folderId
+			parentId = folderId
 			continue
 		}
 
 		folderMeta := &drive.File{
-			Name:     escapedName,
-			MimeType: "application/vnd.google-apps.folder",
+			Name:     part,
+			MimeType: folderMimeType,
 
 			Parents: []string{parentId},
 		}
 
-		folder, err := p.service.Files.Create(folderMeta).Do()
+		folder, err := p.service.Files.Create(folderMeta).SupportsAllDrives(true).Context(ctx).Do()
 		if err != nil {
 			return "", fmt.Errorf("failed to create folder: %w", err)
 		}
+		p.folderIds[current] = folder.Id
 		parentId = folder.Id
 	}
 
 	return parentId, nil
 }
 
-func (p *GoogleDriveProvider) isFileExist(path, folderId string) (string, bool) {
+// forgetFolders drops folderPath and everything below it from the folder
+// cache after the folder has been deleted.
+func (p *GoogleDriveProvider) forgetFolders(folderPath string) {
+	for cached := range p.folderIds {
+		if cached == folderPath || strings.HasPrefix(cached, folderPath+"/") {
+			delete(p.folderIds, cached)
+		}
+	}
+}
+
+func (p *GoogleDriveProvider) isFileExist(ctx context.Context, path, folderId string) (string, bool) {
 	query := fmt.Sprintf("name = '%s' and '%s' in parents and trashed = false",
 		strings.Replace(path, "'", "\\'", -1),
 		folderId)
 
-	r, err := p.service.Files.List().Q(query).Fields("files(id, name)").Do()
+	r, err := p.listFiles(query).Fields("files(id, name)").Context(ctx).Do()
 	if err != nil || len(r.Files) == 0 {
 		return "", false
 	}
@@ -0,0 +1,332 @@
+package gdrive
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/amankumarsingh77/automated_backup_tool/internal/storage"
+	"github.com/amankumarsingh77/automated_backup_tool/internal/utils/filesystem"
+	"github.com/amankumarsingh77/automated_backup_tool/internal/utils/retry"
+)
+
+const (
+	driveUploadURL = "https://www.googleapis.com/upload/drive/v3/files"
+	// defaultChunkSize is the size of each resumable upload request. Drive
+	// requires a multiple of 256 KiB.
+	defaultChunkSize = 8 * 1024 * 1024
+	// sessionLifetime is how long a saved session is trusted. Drive expires
+	// resumable sessions after a week.
+	sessionLifetime = 6 * 24 * time.Hour
+)
+
+// errSessionGone is returned when Drive no longer knows an upload session
+// and the upload has to start over.
+var errSessionGone = errors.New("upload session no longer exists")
+
+var errChecksumMismatch = errors.New("uploaded file does not match the local checksum")
+
+// uploadSession is the state saved to disk while a resumable upload is in
+// progress.
+type uploadSession struct {
+	URI        string    `json:"uri"`
+	RemotePath string    `json:"remote_path"`
+	Size       int64     `json:"size"`
+	MD5        string    `json:"md5"`
+	Created    time.Time `json:"created"`
+}
+
+// uploadResumable uploads file with Drive's resumable protocol. The session
+// URI is saved before the first byte is sent, so an upload interrupted by a
+// crash or restart continues from the last byte Drive acknowledged. Saved
+// sessions are found by the upload ID of ctx, or else by remote path and
+// content hash, and only resumed for the same remote path, size and hash,
+// which means the file is read once up front.
+func (p *GoogleDriveProvider) uploadResumable(ctx context.Context, file *os.File, size int64, remotePath string) error {
+	sum, err := fileMD5(file)
+	if err != nil {
+		return fmt.Errorf("failed to hash file: %w", err)
+	}
+	sessionFile, err := p.sessionFile(storage.UploadID(ctx), remotePath, sum)
+	if err != nil {
+		return err
+	}
+
+	var offset int64
+	session := loadSession(sessionFile, remotePath, size, sum)
+	if session != nil {
+		offset, err = p.queryOffset(ctx, session.URI, size)
+		if errors.Is(err, errSessionGone) {
+			session = nil
+		} else if err != nil {
+			return fmt.Errorf("failed to resume upload: %w", err)
+		} else if offset == size {
+			os.Remove(sessionFile)
+			return nil
+		}
+	}
+
+	if session == nil {
+		uri, err := p.startSession(ctx, remotePath, size)
+		if err != nil {
+			return fmt.Errorf("failed to start resumable upload: %w", err)
+		}
+		session = &uploadSession{URI: uri, RemotePath: remotePath, Size: size, MD5: sum, Created: time.Now()}
+		if err := saveSession(sessionFile, session); err != nil {
+			return err
+		}
+		offset = 0
+	}
+
+	for offset < size {
+		backoff := retry.NewExponentialBackoff().WithInitialDelay(time.Second)
+		err := backoff.RetryWithBackoff(ctx, func() error {
+			next, err := p.uploadChunk(ctx, session.URI, file, offset, size, sum)
+			if err == nil {
+				offset = next
+				return nil
+			}
+			var statusErr *uploadStatusError
+			if errors.Is(err, errSessionGone) || errors.Is(err, errChecksumMismatch) ||
+				(errors.As(err, &statusErr) && !statusErr.retryable()) {
+				return retry.NewRetryableError(err, false)
+			}
+			if resumed, queryErr := p.queryOffset(ctx, session.URI, size); queryErr == nil {
+				offset = resumed
+			}
+			return retry.NewRetryableError(err, true)
+		})
+		if err != nil {
+			if errors.Is(err, errSessionGone) {
+				os.Remove(sessionFile)
+			}
+			return fmt.Errorf("failed to upload file: %w", err)
+		}
+	}
+
+	os.Remove(sessionFile)
+	return nil
+}
+
+// startSession creates a resumable upload session for remotePath, updating
+// the existing file in place like a simple upload does.
+func (p *GoogleDriveProvider) startSession(ctx context.Context, remotePath string, size int64) (string, error) {
+	folderId, err := p.getOrCreateFolder(ctx, path.Dir(remotePath))
+	if err != nil {
+		return "", fmt.Errorf("failed to create/get folder: %w", err)
+	}
+	fileName := path.Base(remotePath)
+
+	method := http.MethodPost
+	target := p.uploadURL + "?uploadType=resumable&supportsAllDrives=true&fields=id,md5Checksum"
+	metadata := map[string]interface{}{
+		"name":    fileName,
+		"parents": []string{folderId},
+	}
+	if existingFileId, exists := p.isFileExist(ctx, fileName, folderId); exists {
+		method = http.MethodPatch
+		target = p.uploadURL + "/" + existingFileId + "?uploadType=resumable&supportsAllDrives=true&fields=id,md5Checksum"
+		metadata = map[string]interface{}{}
+	}
+
+	body, err := json.Marshal(metadata)
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=UTF-8")
+	req.Header.Set("X-Upload-Content-Type", "application/octet-stream")
+	req.Header.Set("X-Upload-Content-Length", strconv.FormatInt(size, 10))
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", newUploadStatusError(resp)
+	}
+
+	uri := resp.Header.Get("Location")
+	if uri == "" {
+		return "", errors.New("no session URI in response")
+	}
+	return uri, nil
+}
+
+// uploadChunk sends the chunk starting at offset and returns the offset
+// Drive expects next. When the last chunk completes the upload, the MD5
+// Drive computed is checked against the local file.
+func (p *GoogleDriveProvider) uploadChunk(ctx context.Context, uri string, file io.ReaderAt, offset, size int64, sum string) (int64, error) {
+	length := p.chunkSize
+	if offset+length > size {
+		length = size - offset
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, uri, io.NewSectionReader(file, offset, length))
+	if err != nil {
+		return 0, err
+	}
+	req.ContentLength = length
+	req.Header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", offset, offset+length-1, size))
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	next, err := uploadProgress(resp, size)
+	if err != nil {
+		return 0, err
+	}
+	if next == size {
+		var uploaded struct {
+			Md5Checksum string `json:"md5Checksum"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&uploaded); err == nil &&
+			uploaded.Md5Checksum != "" && uploaded.Md5Checksum != sum {
+			return 0, fmt.Errorf("%w: drive reports %s, local file is %s", errChecksumMismatch, uploaded.Md5Checksum, sum)
+		}
+	}
+	return next, nil
+}
+
+// queryOffset asks Drive how many bytes of the session it has received.
+func (p *GoogleDriveProvider) queryOffset(ctx context.Context, uri string, size int64) (int64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, uri, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	return uploadProgress(resp, size)
+}
+
+// uploadProgress interprets the response to a chunk or status request.
+// 308 Resume Incomplete carries the received bytes in its Range header.
+func uploadProgress(resp *http.Response, size int64) (int64, error) {
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusCreated:
+		return size, nil
+	case http.StatusPermanentRedirect:
+		received := resp.Header.Get("Range")
+		if received == "" {
+			return 0, nil
+		}
+		_, end, found := strings.Cut(strings.TrimPrefix(received, "bytes="), "-")
+		last, err := strconv.ParseInt(end, 10, 64)
+		if !found || err != nil {
+			return 0, fmt.Errorf("invalid range header %q", received)
+		}
+		return last + 1, nil
+	case http.StatusNotFound, http.StatusGone:
+		return 0, errSessionGone
+	default:
+		return 0, newUploadStatusError(resp)
+	}
+}
+
+type uploadStatusError struct {
+	status int
+	body   string
+}
+
+func newUploadStatusError(resp *http.Response) *uploadStatusError {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	return &uploadStatusError{status: resp.StatusCode, body: strings.TrimSpace(string(body))}
+}
+
+func (e *uploadStatusError) Error() string {
+	return fmt.Sprintf("unexpected status %d: %s", e.status, e.body)
+}
+
+// retryable reports whether the request may succeed when sent again: rate
+// limiting and server errors are, other client errors are not.
+func (e *uploadStatusError) retryable() bool {
+	return e.status == http.StatusTooManyRequests || e.status >= http.StatusInternalServerError
+}
+
+// sessionFile returns where the session of the upload with the given ID to
+// the provider's remote is saved, or without an ID, the session for
+// remotePath with content sum. Sessions belong to the account of a remote,
+// so the same upload to another remote has its own.
+func (p *GoogleDriveProvider) sessionFile(id, remotePath, sum string) (string, error) {
+	dir := p.sessionDir
+	if dir == "" {
+		appDir, err := filesystem.AppDataDir()
+		if err != nil {
+			return "", err
+		}
+		dir = filepath.Join(appDir, "uploads")
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create upload session directory: %w", err)
+	}
+
+	key := sha256.Sum256([]byte(p.name + "\x00id\x00" + id))
+	if id == "" {
+		key = sha256.Sum256([]byte(p.name + "\x00" + storage.CleanPath(remotePath) + "\x00" + sum))
+	}
+	return filepath.Join(dir, "gdrive-"+hex.EncodeToString(key[:16])+".json"), nil
+}
+
+// loadSession returns the saved session for the upload, or nil if there is
+// none that can still be resumed.
+func loadSession(sessionFile, remotePath string, size int64, sum string) *uploadSession {
+	data, err := os.ReadFile(sessionFile)
+	if err != nil {
+		return nil
+	}
+	var session uploadSession
+	if err := json.Unmarshal(data, &session); err != nil {
+		return nil
+	}
+	if session.RemotePath != remotePath || session.Size != size || session.MD5 != sum ||
+		time.Since(session.Created) > sessionLifetime {
+		os.Remove(sessionFile)
+		return nil
+	}
+	return &session
+}
+
+func saveSession(sessionFile string, session *uploadSession) error {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+	// The session URI authorizes uploads on its own.
+	if err := os.WriteFile(sessionFile, data, 0600); err != nil {
+		return fmt.Errorf("failed to save upload session: %w", err)
+	}
+	return nil
+}
+
+func fileMD5(file *os.File) (string, error) {
+	hash := md5.New()
+	if _, err := io.Copy(hash, io.NewSectionReader(file, 0, 1<<62)); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
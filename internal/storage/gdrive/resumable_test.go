@@ -0,0 +1,150 @@
+package gdrive
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeResumableSession implements the receiving side of a Drive resumable
+// upload session.
+type fakeResumableSession struct {
+	mu       sync.Mutex
+	received []byte
+	chunks   int
+}
+
+func (f *fakeResumableSession) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if r.Method != http.MethodPut || r.URL.Path != "/session/1" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	var start, end, total int
+	if _, err := fmt.Sscanf(r.Header.Get("Content-Range"), "bytes %d-%d/%d", &start, &end, &total); err != nil {
+		// Status query: "bytes */<total>".
+		fmt.Sscanf(r.Header.Get("Content-Range"), "bytes */%d", &total)
+	} else {
+		if start != len(f.received) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		f.received = append(f.received, body...)
+		f.chunks++
+	}
+
+	if len(f.received) == total {
+		sum := md5.Sum(f.received)
+		fmt.Fprintf(w, `{"id": "file-1", "md5Checksum": "%s"}`, hex.EncodeToString(sum[:]))
+		return
+	}
+	if len(f.received) > 0 {
+		w.Header().Set("Range", fmt.Sprintf("bytes=0-%d", len(f.received)-1))
+	}
+	w.WriteHeader(http.StatusPermanentRedirect)
+}
+
+func TestResumableUploadContinuesSavedSession(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789abcdef"), 4096)
+	source := filepath.Join(t.TempDir(), "archive.gz")
+	if err := os.WriteFile(source, content, 0600); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	// A previous run uploaded the first two chunks before it was killed.
+	fake := &fakeResumableSession{received: append([]byte(nil), content[:2*16384]...)}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	p := NewGoogleDriveProvider()
+	p.client = server.Client()
+	p.chunkSize = 16384
+	p.sessionDir = t.TempDir()
+
+	sum := md5.Sum(content)
+	sessionFile, err := p.sessionFile("", "backups/archive.gz", hex.EncodeToString(sum[:]))
+	if err != nil {
+		t.Fatalf("Failed to get session file: %v", err)
+	}
+	if err := saveSession(sessionFile, &uploadSession{
+		URI:        server.URL + "/session/1",
+		RemotePath: "backups/archive.gz",
+		Size:       int64(len(content)),
+		MD5:        hex.EncodeToString(sum[:]),
+		Created:    time.Now(),
+	}); err != nil {
+		t.Fatalf("Failed to save session: %v", err)
+	}
+
+	file, err := os.Open(source)
+	if err != nil {
+		t.Fatalf("Failed to open test file: %v", err)
+	}
+	defer file.Close()
+
+	if err := p.uploadResumable(context.Background(), file, int64(len(content)), "backups/archive.gz"); err != nil {
+		t.Fatalf("Failed to resume upload: %v", err)
+	}
+	if !bytes.Equal(fake.received, content) {
+		t.Fatal("Uploaded content does not match the source")
+	}
+	if fake.chunks != 2 {
+		t.Errorf("Expected only the two missing chunks to be sent, got %d", fake.chunks)
+	}
+	if _, err := os.Stat(sessionFile); !os.IsNotExist(err) {
+		t.Error("Session file should be removed after the upload completes")
+	}
+}
+
+func TestLoadSessionIgnoresStaleSessions(t *testing.T) {
+	sessionFile := filepath.Join(t.TempDir(), "session.json")
+	saveSession(sessionFile, &uploadSession{
+		URI:        "https://example.com/session",
+		RemotePath: "backups/archive.gz",
+		Size:       10,
+		MD5:        "abc",
+		Created:    time.Now().Add(-8 * 24 * time.Hour),
+	})
+
+	if session := loadSession(sessionFile, "backups/archive.gz", 10, "abc"); session != nil {
+		t.Error("Expected an expired session to be ignored")
+	}
+	if _, err := os.Stat(sessionFile); !os.IsNotExist(err) {
+		t.Error("Expected the expired session file to be removed")
+	}
+}
+
+func TestSessionFilePerRemote(t *testing.T) {
+	dir := t.TempDir()
+	personal, work := NewGoogleDriveProvider(), NewGoogleDriveProvider()
+	personal.name, work.name = "personal", "work"
+	personal.sessionDir, work.sessionDir = dir, dir
+
+	for _, id := range []string{"", "task-snapshot"} {
+		a, err := personal.sessionFile(id, "backups/archive.gz", "abc")
+		if err != nil {
+			t.Fatalf("Failed to get session file: %v", err)
+		}
+		b, err := work.sessionFile(id, "backups/archive.gz", "abc")
+		if err != nil {
+			t.Fatalf("Failed to get session file: %v", err)
+		}
+		if a == b {
+			t.Errorf("Expected the remotes to save the upload %q in different session files, both use %s", id, a)
+		}
+	}
+}
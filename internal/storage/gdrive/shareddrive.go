@@ -0,0 +1,67 @@
+package gdrive
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"google.golang.org/api/drive/v3"
+)
+
+// resolveSharedDrive looks up the Shared Drive named by the shared_drive
+// option, which holds either its ID or its name. Names are not unique in
+// Drive, so a name matching more than one Shared Drive is refused.
+func (p *GoogleDriveProvider) resolveSharedDrive(ctx context.Context) error {
+	if p.sharedDrive == "" || p.driveId != "" {
+		return nil
+	}
+
+	if d, err := p.service.Drives.Get(p.sharedDrive).Context(ctx).Do(); err == nil {
+		p.driveId = d.Id
+		return nil
+	}
+
+	query := fmt.Sprintf("name = '%s'", strings.Replace(p.sharedDrive, "'", "\\'", -1))
+	var matches []*drive.Drive
+	pageToken := ""
+	for {
+		list, err := p.service.Drives.List().Q(query).PageToken(pageToken).Context(ctx).Do()
+		if err != nil {
+			return fmt.Errorf("failed to list shared drives: %w", err)
+		}
+		matches = append(matches, list.Drives...)
+		if list.NextPageToken == "" {
+			break
+		}
+		pageToken = list.NextPageToken
+	}
+
+	switch len(matches) {
+	case 0:
+		return fmt.Errorf("shared drive %q not found or not accessible", p.sharedDrive)
+	case 1:
+		p.driveId = matches[0].Id
+		return nil
+	default:
+		return fmt.Errorf("%d shared drives are named %q, set shared_drive to the ID of one", len(matches), p.sharedDrive)
+	}
+}
+
+// rootId returns the folder paths are resolved from: the configured Shared
+// Drive, or the user's My Drive.
+func (p *GoogleDriveProvider) rootId() string {
+	if p.driveId != "" {
+		return p.driveId
+	}
+	return "root"
+}
+
+// listFiles starts a files.list request. Items of a Shared Drive are only
+// returned when the request names the drive.
+func (p *GoogleDriveProvider) listFiles(query string) *drive.FilesListCall {
+	call := p.service.Files.List().Q(query).SupportsAllDrives(true)
+	if p.driveId != "" {
+		call = call.IncludeItemsFromAllDrives(true).Corpora("drive").DriveId(p.driveId)
+	}
+	return call
+}
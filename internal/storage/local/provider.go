@@ -0,0 +1,201 @@
+package local
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/amankumarsingh77/automated_backup_tool/internal/storage"
+)
+
+// LocalProvider stores backups in a directory on a locally mounted
+// filesystem, such as an external disk or a NAS share.
+type LocalProvider struct {
+	root string
+}
+
+func init() {
+	storage.Register("local", func(cfg storage.Config) (storage.StorageProvider, error) {
+		// Without a configured root the destination path of a task is
+		// taken as an absolute path on the local machine.
+		root := string(filepath.Separator)
+		if cfg.Credential != nil && cfg.Credential.Options["root"] != "" {
+			root = cfg.Credential.Options["root"]
+		}
+		return NewLocalProvider(root), nil
+	})
+}
+
+func NewLocalProvider(root string) *LocalProvider {
+	return &LocalProvider{root: filepath.Clean(root)}
+}
+
+// Authenticate makes sure the root directory is present. It is never created
+// here, so that an unmounted NAS share is not silently replaced by a local
+// directory.
+func (p *LocalProvider) Authenticate(ctx context.Context) error {
+	info, err := os.Stat(p.root)
+	if err != nil {
+		return fmt.Errorf("backup root is not accessible: %w", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("backup root %s is not a directory", p.root)
+	}
+	return nil
+}
+
+func (p *LocalProvider) Upload(ctx context.Context, localPath, remotePath string) error {
+	if err := p.Authenticate(ctx); err != nil {
+		return err
+	}
+
+	src, err := os.Open(localPath)
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+	defer src.Close()
+
+	if err := writeFileAtomic(ctx, p.resolve(remotePath), src); err != nil {
+		return fmt.Errorf("failed to upload file: %w", err)
+	}
+	return nil
+}
+
+func (p *LocalProvider) Download(ctx context.Context, localPath, remotePath string) error {
+	src, err := os.Open(p.resolve(remotePath))
+	if err != nil {
+		return fmt.Errorf("failed to open remote file: %w", notFound(err, remotePath))
+	}
+	defer src.Close()
+
+	if err := writeFileAtomic(ctx, localPath, src); err != nil {
+		return fmt.Errorf("failed to download file: %w", err)
+	}
+	return nil
+}
+
+func (p *LocalProvider) Delete(ctx context.Context, remotePath string) error {
+	if err := os.Remove(p.resolve(remotePath)); err != nil {
+		return fmt.Errorf("failed to delete file: %w", notFound(err, remotePath))
+	}
+	return nil
+}
+
+func (p *LocalProvider) Stat(ctx context.Context, remotePath string) (storage.RemoteObject, error) {
+	info, err := os.Stat(p.resolve(remotePath))
+	if err != nil {
+		return storage.RemoteObject{}, fmt.Errorf("failed to stat file: %w", notFound(err, remotePath))
+	}
+
+	object := storage.RemoteObject{
+		Path:    storage.CleanPath(remotePath),
+		ModTime: info.ModTime(),
+		IsDir:   info.IsDir(),
+	}
+	if !info.IsDir() {
+		object.Size = info.Size()
+	}
+	return object, nil
+}
+
+func (p *LocalProvider) ListFiles(ctx context.Context, remotePath string) ([]storage.RemoteObject, error) {
+	remotePath = storage.CleanPath(remotePath)
+	dir := p.resolve(remotePath)
+
+	var objects []storage.RemoteObject
+	err := filepath.WalkDir(dir, func(name string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if name == dir {
+			return nil
+		}
+		// Uploads in progress, or left behind by a crash, are not
+		// backups yet.
+		if !entry.IsDir() && storage.IsTempName(entry.Name()) {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, name)
+		if err != nil {
+			return err
+		}
+
+		object := storage.RemoteObject{
+			Path:    path.Join(remotePath, filepath.ToSlash(rel)),
+			ModTime: info.ModTime(),
+			IsDir:   entry.IsDir(),
+		}
+		if !entry.IsDir() {
+			object.Size = info.Size()
+		}
+		objects = append(objects, object)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list files: %w", notFound(err, remotePath))
+	}
+	return objects, nil
+}
+
+// resolve maps a remote path onto the filesystem below the root. Cleaning the
+// path first keeps ".." elements from escaping the root.
+func (p *LocalProvider) resolve(remotePath string) string {
+	return filepath.Join(p.root, filepath.FromSlash(storage.CleanPath(remotePath)))
+}
+
+// notFound translates a missing file into storage.ErrNotFound.
+func notFound(err error, remotePath string) error {
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("%w: %s", storage.ErrNotFound, storage.CleanPath(remotePath))
+	}
+	return err
+}
+
+// writeFileAtomic writes r to a temporary file next to target and renames it
+// into place once the data has been flushed to disk, so readers never observe
+// a partially written backup.
+func writeFileAtomic(ctx context.Context, target string, r io.Reader) error {
+	dir := filepath.Dir(target)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(target)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), target)
+}
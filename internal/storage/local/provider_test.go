@@ -0,0 +1,92 @@
+package local
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/amankumarsingh77/automated_backup_tool/internal/storage"
+)
+
+func TestLocalProvider(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	work := t.TempDir()
+
+	content := []byte("backup archive contents")
+	source := filepath.Join(work, "archive.gz")
+	if err := os.WriteFile(source, content, 0600); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	p := NewLocalProvider(root)
+	if err := p.Upload(ctx, source, "/backups/nightly/archive.gz"); err != nil {
+		t.Fatalf("Failed to upload file: %v", err)
+	}
+
+	// A temporary file left by an interrupted upload is not listed.
+	stray := filepath.Join(root, "backups", "nightly", ".archive.gz.123456.tmp")
+	if err := os.WriteFile(stray, content[:4], 0600); err != nil {
+		t.Fatalf("Failed to create temporary file: %v", err)
+	}
+
+	files, err := p.ListFiles(ctx, "backups")
+	if err != nil {
+		t.Fatalf("Failed to list files: %v", err)
+	}
+	if len(files) != 2 || !files[0].IsDir || files[1].Path != "backups/nightly/archive.gz" {
+		t.Fatalf("Unexpected listing after upload: %+v", files)
+	}
+	if files[1].Size != int64(len(content)) || files[1].ModTime.IsZero() {
+		t.Errorf("Listing is missing size or modification time: %+v", files[1])
+	}
+
+	object, err := p.Stat(ctx, "backups/nightly/archive.gz")
+	if err != nil {
+		t.Fatalf("Failed to stat file: %v", err)
+	}
+	if object.Path != "backups/nightly/archive.gz" || object.Size != int64(len(content)) || object.IsDir {
+		t.Errorf("Unexpected stat result: %+v", object)
+	}
+
+	restored := filepath.Join(work, "restored", "archive.gz")
+	if err := p.Download(ctx, restored, "backups/nightly/archive.gz"); err != nil {
+		t.Fatalf("Failed to download file: %v", err)
+	}
+	data, err := os.ReadFile(restored)
+	if err != nil {
+		t.Fatalf("Failed to read downloaded file: %v", err)
+	}
+	if string(data) != string(content) {
+		t.Error("Downloaded content does not match uploaded content")
+	}
+
+	if err := p.Delete(ctx, "backups/nightly/archive.gz"); err != nil {
+		t.Fatalf("Failed to delete file: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "backups", "nightly", "archive.gz")); !os.IsNotExist(err) {
+		t.Error("File should not exist after delete")
+	}
+	if err := p.Delete(ctx, "backups/nightly/archive.gz"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound from a second delete, got %v", err)
+	}
+}
+
+func TestLocalProviderStaysBelowRoot(t *testing.T) {
+	root := t.TempDir()
+	p := NewLocalProvider(root)
+
+	if got, want := p.resolve("../../etc/passwd"), filepath.Join(root, "etc", "passwd"); got != want {
+		t.Errorf("resolve escaped the root: got %s, want %s", got, want)
+	}
+}
+
+func TestLocalProviderMissingRoot(t *testing.T) {
+	p := NewLocalProvider(filepath.Join(t.TempDir(), "unmounted"))
+
+	if err := p.Authenticate(context.Background()); err == nil {
+		t.Error("Expected an error for a missing backup root")
+	}
+}
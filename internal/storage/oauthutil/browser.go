@@ -0,0 +1,152 @@
+package oauthutil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"runtime"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// browserLoginTimeout bounds how long BrowserLogin waits for the redirect.
+const browserLoginTimeout = 5 * time.Minute
+
+// ErrLoginRequired is returned by Login in a context made by WithoutLogin.
+var ErrLoginRequired = errors.New("the saved token is missing or no longer valid, run configure to log in again")
+
+type withoutLoginKey struct{}
+
+// WithoutLogin returns a context in which Login fails with ErrLoginRequired
+// instead of asking the user to sign in.
+func WithoutLogin(ctx context.Context) context.Context {
+	return context.WithValue(ctx, withoutLoginKey{}, true)
+}
+
+// Login obtains a new token with the given login mode, talking to the user
+// on the terminal.
+func Login(ctx context.Context, config *oauth2.Config, mode string) (*oauth2.Token, error) {
+	if ctx.Value(withoutLoginKey{}) != nil {
+		return nil, ErrLoginRequired
+	}
+	switch mode {
+	case LoginDevice:
+		return DeviceLogin(ctx, config, os.Stdout)
+	case LoginManual:
+		return ManualLogin(ctx, config, os.Stdin, os.Stdout)
+	default:
+		return BrowserLogin(ctx, config, os.Stdout)
+	}
+}
+
+// BrowserLogin runs the authorization code flow with PKCE. It listens on the
+// loopback address and port of config.RedirectURL, opens the authorization
+// URL in a browser and exchanges the code the browser is redirected back
+// with. A redirect URL without a port gets a free one, which providers that
+// follow RFC 8252, Microsoft among them, accept for loopback redirects.
+func BrowserLogin(ctx context.Context, config *oauth2.Config, out io.Writer) (*oauth2.Token, error) {
+	redirect, err := url.Parse(config.RedirectURL)
+	if err != nil || redirect.Scheme != "http" || !isLoopback(redirect.Hostname()) {
+		return nil, fmt.Errorf("redirect URL %q must be an http URL on localhost for browser login", config.RedirectURL)
+	}
+
+	listener, err := net.Listen("tcp", net.JoinHostPort(redirect.Hostname(), redirect.Port()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen for the login redirect: %w", err)
+	}
+	defer listener.Close()
+
+	if redirect.Port() == "" {
+		_, port, _ := net.SplitHostPort(listener.Addr().String())
+		redirect.Host = net.JoinHostPort(redirect.Hostname(), port)
+		c := *config
+		c.RedirectURL = redirect.String()
+		config = &c
+	}
+
+	state, err := NewState()
+	if err != nil {
+		return nil, err
+	}
+	verifier := oauth2.GenerateVerifier()
+
+	codeChan := make(chan string, 1)
+	errChan := make(chan error, 1)
+
+	callbackPath := redirect.Path
+	if callbackPath == "" {
+		callbackPath = "/"
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc(callbackPath, func(w http.ResponseWriter, r *http.Request) {
+		code, err := parseCode(redirect.ResolveReference(r.URL).String(), state)
+		if err != nil {
+			w.Write([]byte("Authentication failed. You can close this window."))
+			select {
+			case errChan <- err:
+			default:
+			}
+			return
+		}
+		w.Write([]byte("Authentication successful! You can close this window."))
+		select {
+		case codeChan <- code:
+		default:
+		}
+	})
+	server := &http.Server{Handler: mux}
+	go server.Serve(listener)
+	defer server.Close()
+
+	authURL := config.AuthCodeURL(state, oauth2.AccessTypeOffline, oauth2.ApprovalForce, oauth2.S256ChallengeOption(verifier))
+	fmt.Fprintf(out, "Opening the login page in your browser. If it does not open, visit:\n\n%s\n\n", authURL)
+	if err := openBrowser(authURL); err != nil {
+		fmt.Fprintf(out, "Could not open a browser (%v). Without one, configure -login device or -login manual.\n", err)
+	}
+
+	select {
+	case code := <-codeChan:
+		token, err := config.Exchange(ctx, code, oauth2.VerifierOption(verifier))
+		if err != nil {
+			return nil, fmt.Errorf("failed to exchange token: %w", err)
+		}
+		return token, nil
+	case err := <-errChan:
+		return nil, err
+	case <-ctx.Done():
+		return nil, fmt.Errorf("authentication cancelled: %w", ctx.Err())
+	case <-time.After(browserLoginTimeout):
+		return nil, errors.New("authentication timed out")
+	}
+}
+
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// openBrowser is a variable so tests can stand in for the browser.
+var openBrowser = func(url string) error {
+	var err error
+	switch runtime.GOOS {
+	case "windows":
+		err = exec.Command("cmd", "/c", "start", url).Start()
+	case "darwin":
+		err = exec.Command("open", url).Start()
+	case "linux":
+		err = exec.Command("xdg-open", url).Start()
+	default:
+		err = fmt.Errorf("unsupported platform")
+	}
+	return err
+}
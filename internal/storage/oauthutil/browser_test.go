@@ -0,0 +1,71 @@
+package oauthutil
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"golang.org/x/oauth2"
+)
+
+func TestBrowserLoginUsesPKCE(t *testing.T) {
+	var challenge string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		sum := sha256.Sum256([]byte(r.Form.Get("code_verifier")))
+		if r.Form.Get("code") != "browser-code" || base64.RawURLEncoding.EncodeToString(sum[:]) != challenge {
+			http.Error(w, `{"error": "invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"access_token": "access", "refresh_token": "refresh", "token_type": "Bearer", "expires_in": 3600}`)
+	}))
+	defer server.Close()
+
+	// Stand in for the browser: approve the login and follow the redirect.
+	defer func(original func(string) error) { openBrowser = original }(openBrowser)
+	openBrowser = func(authURL string) error {
+		u, err := url.Parse(authURL)
+		if err != nil {
+			return err
+		}
+		query := u.Query()
+		if query.Get("code_challenge_method") != "S256" {
+			return fmt.Errorf("no PKCE challenge in %s", authURL)
+		}
+		challenge = query.Get("code_challenge")
+		go func() {
+			resp, err := http.Get(query.Get("redirect_uri") + "?code=browser-code&state=" + url.QueryEscape(query.Get("state")))
+			if err == nil {
+				resp.Body.Close()
+			}
+		}()
+		return nil
+	}
+
+	config := &oauth2.Config{
+		ClientID:    "client",
+		RedirectURL: "http://127.0.0.1/callback",
+		Endpoint:    oauth2.Endpoint{AuthURL: "https://login.example.com/authorize", TokenURL: server.URL},
+	}
+	token, err := BrowserLogin(context.Background(), config, io.Discard)
+	if err != nil {
+		t.Fatalf("Browser login failed: %v", err)
+	}
+	if token.RefreshToken != "refresh" {
+		t.Errorf("Unexpected token: %+v", token)
+	}
+}
+
+func TestBrowserLoginRejectsRemoteRedirect(t *testing.T) {
+	config := &oauth2.Config{RedirectURL: "https://example.com/callback"}
+	if _, err := BrowserLogin(context.Background(), config, io.Discard); err == nil {
+		t.Error("Expected a non-loopback redirect URL to be rejected")
+	}
+}
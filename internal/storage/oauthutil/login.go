@@ -0,0 +1,122 @@
+package oauthutil
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+
+	"golang.org/x/oauth2"
+)
+
+// Login modes select how the initial OAuth token is obtained.
+const (
+	// LoginBrowser opens a browser and receives the redirect locally.
+	LoginBrowser = "browser"
+	// LoginDevice uses the device authorization flow: the user enters a
+	// short code on any other device.
+	LoginDevice = "device"
+	// LoginManual prints the authorization URL and reads the redirect URL
+	// or the bare code pasted back from another machine.
+	LoginManual = "manual"
+)
+
+// ValidateLoginMode checks a login mode from the configuration. The empty
+// mode means LoginBrowser.
+func ValidateLoginMode(mode string) error {
+	switch mode {
+	case "", LoginBrowser, LoginDevice, LoginManual:
+		return nil
+	}
+	return fmt.Errorf("unknown login mode %q, expected %s, %s or %s", mode, LoginBrowser, LoginDevice, LoginManual)
+}
+
+// DeviceLogin runs the device authorization flow, printing the code the user
+// has to enter to out, and waits until the login is approved or ctx ends.
+func DeviceLogin(ctx context.Context, config *oauth2.Config, out io.Writer) (*oauth2.Token, error) {
+	auth, err := config.DeviceAuth(ctx, oauth2.AccessTypeOffline)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start device login: %w", err)
+	}
+
+	fmt.Fprintf(out, "To sign in, open %s on any device and enter the code %s\n", auth.VerificationURI, auth.UserCode)
+	if auth.VerificationURIComplete != "" {
+		fmt.Fprintf(out, "or open %s\n", auth.VerificationURIComplete)
+	}
+
+	token, err := config.DeviceAccessToken(ctx, auth)
+	if err != nil {
+		return nil, fmt.Errorf("device login failed: %w", err)
+	}
+	return token, nil
+}
+
+// ManualLogin prints the authorization URL to out and exchanges the code
+// read from in. The user may paste either the code or the whole URL the
+// browser was redirected to, which need not be reachable from this machine.
+func ManualLogin(ctx context.Context, config *oauth2.Config, in io.Reader, out io.Writer) (*oauth2.Token, error) {
+	state, err := NewState()
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Fprintf(out, "Open this URL in a browser on any machine and approve access:\n\n%s\n\n", config.AuthCodeURL(state, oauth2.AccessTypeOffline, oauth2.ApprovalForce))
+	fmt.Fprint(out, "Then paste the URL the browser was redirected to (or just the code): ")
+
+	line, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && line == "" {
+		return nil, fmt.Errorf("failed to read authorization code: %w", err)
+	}
+	code, err := parseCode(strings.TrimSpace(line), state)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := config.Exchange(ctx, code)
+	if err != nil {
+		return nil, fmt.Errorf("failed to exchange token: %w", err)
+	}
+	return token, nil
+}
+
+// parseCode extracts the authorization code from a pasted redirect URL, or
+// returns the input unchanged if it is a bare code.
+func parseCode(input, state string) (string, error) {
+	if input == "" {
+		return "", errors.New("no authorization code entered")
+	}
+	if !strings.Contains(input, "://") {
+		return input, nil
+	}
+
+	u, err := url.Parse(input)
+	if err != nil {
+		return "", fmt.Errorf("invalid redirect URL: %w", err)
+	}
+	query := u.Query()
+	if msg := query.Get("error"); msg != "" {
+		return "", fmt.Errorf("authorization denied: %s", msg)
+	}
+	if query.Get("state") != state {
+		return "", errors.New("redirect URL belongs to a different login attempt")
+	}
+	code := query.Get("code")
+	if code == "" {
+		return "", errors.New("no code in redirect URL")
+	}
+	return code, nil
+}
+
+// NewState returns a random OAuth state value.
+func NewState() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate state: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,100 @@
+package oauthutil
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"golang.org/x/oauth2"
+)
+
+func TestParseCode(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{input: "4/0AbCd", want: "4/0AbCd"},
+		{input: "http://localhost:8080/callback?state=s1&code=4%2F0AbCd", want: "4/0AbCd"},
+		{input: "http://localhost:8080/callback?state=other&code=4%2F0AbCd", wantErr: true},
+		{input: "http://localhost:8080/callback?state=s1&error=access_denied", wantErr: true},
+		{input: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseCode(tt.input, "s1")
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseCode(%q) = %q, %v, want %q (error: %v)", tt.input, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestManualLogin(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.Form.Get("code") != "pasted-code" {
+			http.Error(w, `{"error": "invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"access_token": "access", "refresh_token": "refresh", "token_type": "Bearer", "expires_in": 3600}`)
+	}))
+	defer server.Close()
+
+	config := &oauth2.Config{
+		ClientID:    "client",
+		RedirectURL: "http://localhost:8080/callback",
+		Endpoint:    oauth2.Endpoint{AuthURL: "https://accounts.example.com/auth", TokenURL: server.URL},
+	}
+
+	// The pasted redirect URL has to carry the state from the printed URL,
+	// so answer once the URL has been written.
+	in, out := &pastedInput{}, &bytes.Buffer{}
+	in.prompt = out
+
+	token, err := ManualLogin(context.Background(), config, in, out)
+	if err != nil {
+		t.Fatalf("Manual login failed: %v", err)
+	}
+	if token.RefreshToken != "refresh" {
+		t.Errorf("Unexpected token: %+v", token)
+	}
+}
+
+// pastedInput answers the login prompt with the redirect URL for the state
+// found in the printed authorization URL.
+type pastedInput struct {
+	prompt *bytes.Buffer
+	done   bool
+}
+
+func (p *pastedInput) Read(b []byte) (int, error) {
+	if p.done {
+		return 0, fmt.Errorf("unexpected read")
+	}
+	p.done = true
+
+	var state string
+	for _, field := range strings.Fields(p.prompt.String()) {
+		if u, err := url.Parse(field); err == nil && u.Query().Get("state") != "" {
+			state = u.Query().Get("state")
+		}
+	}
+	answer := "http://localhost:8080/callback?code=pasted-code&state=" + state + "\n"
+	return copy(b, answer), nil
+}
+
+func TestWithoutLogin(t *testing.T) {
+	ctx := WithoutLogin(context.Background())
+	config := &oauth2.Config{ClientID: "client", RedirectURL: "http://localhost:0/callback"}
+
+	for _, mode := range []string{LoginBrowser, LoginDevice, LoginManual} {
+		if _, err := Login(ctx, config, mode); err != ErrLoginRequired {
+			t.Errorf("%s: expected ErrLoginRequired, got %v", mode, err)
+		}
+	}
+}
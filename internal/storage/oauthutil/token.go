@@ -0,0 +1,92 @@
+// Package oauthutil holds the OAuth token handling shared by the providers
+// that authenticate against a cloud account.
+package oauthutil
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/amankumarsingh77/automated_backup_tool/internal/utils/filesystem"
+	"golang.org/x/oauth2"
+)
+
+// TokenStore persists the OAuth token of one account between runs.
+type TokenStore interface {
+	LoadToken() (*oauth2.Token, error)
+	SaveToken(token *oauth2.Token) error
+}
+
+// MigrateTokenFile wraps store so that a token still kept in the plaintext
+// token file of an older release is moved into store when it is first
+// needed. legacyName is the name the token file was saved under.
+func MigrateTokenFile(store TokenStore, legacyName string) TokenStore {
+	return &migratingTokenStore{TokenStore: store, legacyName: legacyName}
+}
+
+type migratingTokenStore struct {
+	TokenStore
+	legacyName string
+}
+
+func (s *migratingTokenStore) LoadToken() (*oauth2.Token, error) {
+	token, err := s.TokenStore.LoadToken()
+	if err == nil && token != nil {
+		return token, nil
+	}
+
+	legacy, legacyErr := filesystem.GetToken(s.legacyName)
+	if legacyErr != nil {
+		return token, err
+	}
+	if err := s.TokenStore.SaveToken(legacy); err != nil {
+		return nil, fmt.Errorf("failed to migrate token file: %w", err)
+	}
+	if err := filesystem.RemoveToken(s.legacyName); err != nil {
+		log.Printf("Failed to remove migrated token file: %v", err)
+	}
+	log.Printf("Moved the %s token file into the encrypted credential store", s.legacyName)
+	return legacy, nil
+}
+
+// TokenSource returns a token source that starts from token, refreshes it
+// through config once it expires and writes every new token back to store.
+// Saving matters because some providers, Microsoft among them, rotate the
+// refresh token on every refresh and invalidate the old one.
+func TokenSource(config *oauth2.Config, token *oauth2.Token, store TokenStore) oauth2.TokenSource {
+	// The refresh runs long after the context of the current call is gone.
+	base := config.TokenSource(context.Background(), token)
+	return &persistingTokenSource{
+		base:  base,
+		store: store,
+		last:  token.AccessToken,
+	}
+}
+
+type persistingTokenSource struct {
+	mu    sync.Mutex
+	base  oauth2.TokenSource
+	store TokenStore
+	last  string
+}
+
+func (s *persistingTokenSource) Token() (*oauth2.Token, error) {
+	token, err := s.base.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if token.AccessToken != s.last {
+		// The refreshed token is still good for this run, so a failed save
+		// is reported rather than failing the backup.
+		if err := s.store.SaveToken(token); err != nil {
+			log.Printf("Failed to save refreshed token: %v", err)
+		} else {
+			s.last = token.AccessToken
+		}
+	}
+	return token, nil
+}
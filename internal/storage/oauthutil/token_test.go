@@ -0,0 +1,103 @@
+package oauthutil
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+type memoryStore struct {
+	token *oauth2.Token
+	saves int
+}
+
+func (s *memoryStore) LoadToken() (*oauth2.Token, error) { return s.token, nil }
+
+func (s *memoryStore) SaveToken(token *oauth2.Token) error {
+	s.token = token
+	s.saves++
+	return nil
+}
+
+func TestTokenSourceSavesRefreshedTokens(t *testing.T) {
+	refreshes := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.Form.Get("grant_type") != "refresh_token" || r.Form.Get("refresh_token") != fmt.Sprintf("refresh-%d", refreshes) {
+			http.Error(w, `{"error": "invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		refreshes++
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"access_token": "access-%d", "refresh_token": "refresh-%d", "token_type": "Bearer", "expires_in": 3600}`, refreshes, refreshes)
+	}))
+	defer server.Close()
+
+	config := &oauth2.Config{
+		ClientID: "client",
+		Endpoint: oauth2.Endpoint{TokenURL: server.URL, AuthStyle: oauth2.AuthStyleInParams},
+	}
+	store := &memoryStore{}
+	expired := &oauth2.Token{AccessToken: "access-0", RefreshToken: "refresh-0", Expiry: time.Now().Add(-time.Hour)}
+
+	ts := TokenSource(config, expired, store)
+	for i := 0; i < 3; i++ {
+		token, err := ts.Token()
+		if err != nil {
+			t.Fatalf("Failed to get token: %v", err)
+		}
+		if token.AccessToken != "access-1" {
+			t.Fatalf("Unexpected access token %q", token.AccessToken)
+		}
+	}
+
+	if refreshes != 1 || store.saves != 1 {
+		t.Errorf("Expected one refresh and one save, got %d refreshes and %d saves", refreshes, store.saves)
+	}
+	if store.token.RefreshToken != "refresh-1" {
+		t.Errorf("Rotated refresh token was not saved: %+v", store.token)
+	}
+}
+
+func TestMigrateTokenFile(t *testing.T) {
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get working directory: %v", err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatalf("Failed to change directory: %v", err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+	t.Setenv("APP_NAME", "")
+
+	legacyFile := filepath.Join(dir, "google-drive-token.json")
+	if err := os.WriteFile(legacyFile, []byte(`{"access_token": "old", "refresh_token": "refresh"}`), 0600); err != nil {
+		t.Fatalf("Failed to write token file: %v", err)
+	}
+
+	inner := &memoryStore{}
+	store := MigrateTokenFile(inner, "google-drive")
+	for i := 0; i < 2; i++ {
+		token, err := store.LoadToken()
+		if err != nil {
+			t.Fatalf("Failed to load token: %v", err)
+		}
+		if token.RefreshToken != "refresh" {
+			t.Fatalf("Unexpected token %+v", token)
+		}
+	}
+
+	if inner.saves != 1 {
+		t.Errorf("Expected the token to be migrated once, got %d saves", inner.saves)
+	}
+	if _, err := os.Stat(legacyFile); !os.IsNotExist(err) {
+		t.Error("Plaintext token file was not removed after migration")
+	}
+}
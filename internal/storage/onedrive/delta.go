@@ -0,0 +1,57 @@
+package onedrive
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/amankumarsingh77/automated_backup_tool/internal/storage"
+)
+
+// Changes reads the delta feed of the folder at remotePath. The cursor is
+// the @odata.deltaLink of the previous call.
+func (p *OneDriveProvider) Changes(ctx context.Context, remotePath, cursor string) ([]storage.Change, string, error) {
+	if !p.isAuthenticated {
+		err := p.Authenticate(ctx)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	next := cursor
+	if next == "" {
+		// token=latest skips the full enumeration and only returns the
+		// delta link for the current state.
+		next = itemURL(remotePath, "delta") + "?token=latest"
+	}
+
+	var changes []storage.Change
+	for {
+		var result struct {
+			Value     []*DriveItem `json:"value"`
+			NextLink  string       `json:"@odata.nextLink"`
+			DeltaLink string       `json:"@odata.deltaLink"`
+		}
+		if err := p.getJSON(ctx, next, &result); err != nil {
+			return nil, "", fmt.Errorf("could not read changes: %w", err)
+		}
+
+		for _, item := range result.Value {
+			change := storage.Change{ID: item.ID}
+			if item.Deleted != nil {
+				change.Removed = true
+			} else {
+				change.Object = itemObject(item.Name, item)
+				change.ParentID = item.ParentReference.ID
+			}
+			changes = append(changes, change)
+		}
+
+		if result.DeltaLink != "" {
+			return changes, result.DeltaLink, nil
+		}
+		if result.NextLink == "" {
+			return nil, "", fmt.Errorf("could not read changes: response has neither a next nor a delta link")
+		}
+		next = result.NextLink
+	}
+}
@@ -0,0 +1,60 @@
+package onedrive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/amankumarsingh77/automated_backup_tool/internal/storage"
+	"golang.org/x/oauth2"
+)
+
+func TestChanges(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/items/root:/Shared:/delta" && r.URL.Query().Get("token") == "latest":
+			fmt.Fprintf(w, `{"value": [], "@odata.deltaLink": "%s/delta/1"}`, server.URL)
+		case r.URL.Path == "/delta/1":
+			fmt.Fprintf(w, `{"value": [{"id": "a", "name": "report.xlsx", "size": 12, "parentReference": {"id": "shared"}, "file": {"mimeType": "application/vnd.ms-excel"}}], "@odata.nextLink": "%s/delta/1/page/2"}`, server.URL)
+		case r.URL.Path == "/delta/1/page/2":
+			fmt.Fprintf(w, `{"value": [{"id": "b", "deleted": {}}], "@odata.deltaLink": "%s/delta/2"}`, server.URL)
+		case r.URL.Path == "/delta/old":
+			w.WriteHeader(http.StatusGone)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	p := NewOneDriveProvider()
+	p.baseURL = server.URL + "/"
+	p.useTokenSource(oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "test-token"}))
+	ctx := context.Background()
+
+	changes, cursor, err := p.Changes(ctx, "Shared", "")
+	if err != nil || len(changes) != 0 || cursor != server.URL+"/delta/1" {
+		t.Fatalf("Unexpected initial delta: %v, %q, %v", changes, cursor, err)
+	}
+
+	changes, cursor, err = p.Changes(ctx, "Shared", cursor)
+	if err != nil {
+		t.Fatalf("Failed to read changes: %v", err)
+	}
+	if cursor != server.URL+"/delta/2" || len(changes) != 2 {
+		t.Fatalf("Unexpected changes: %+v, cursor %q", changes, cursor)
+	}
+	if changes[0].ID != "a" || changes[0].ParentID != "shared" || changes[0].Object.Path != "report.xlsx" || changes[0].Object.Size != 12 {
+		t.Errorf("Unexpected change: %+v", changes[0])
+	}
+	if changes[1].ID != "b" || !changes[1].Removed {
+		t.Errorf("Expected a removal, got %+v", changes[1])
+	}
+
+	if _, _, err := p.Changes(ctx, "Shared", server.URL+"/delta/old"); !errors.Is(err, storage.ErrCursorExpired) {
+		t.Errorf("Expected ErrCursorExpired for an old delta link, got %v", err)
+	}
+}
@@ -1,23 +1,70 @@
 package onedrive
 
 import (
+	"context"
+	"fmt"
 	"io"
 	"net/http"
+	neturl "net/url"
+	"strings"
 
-	"golang.org/x/oauth2"
+	"github.com/amankumarsingh77/automated_backup_tool/internal/storage"
 )
 
 const ONEDRIVE_BASE_URL = "https://graph.microsoft.com/v1.0/me/drive/"
 
-func makeRequest(method, url string, token *oauth2.Token, body io.Reader) (*http.Response, error) {
-	req, err := http.NewRequest(method, ONEDRIVE_BASE_URL+url, body)
+// makeRequest sends a Graph request through the authorized client. url is
+// relative to the drive unless it is already absolute, as @odata.nextLink
+// values are.
+func (p *OneDriveProvider) makeRequest(ctx context.Context, method, url string, body io.Reader) (*http.Response, error) {
+	if !strings.HasPrefix(url, "https://") && !strings.HasPrefix(url, "http://") {
+		url = p.baseURL + url
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
 	if err != nil {
 		return nil, err
 	}
-	req.Header.Add("Authorization", "Bearer "+token.AccessToken)
-	if method == http.MethodPut {
+	switch method {
+	case http.MethodPut:
 		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	case http.MethodPost:
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return p.client.Do(req)
+}
+
+// itemURL addresses the drive item at remotePath, optionally followed by a
+// relationship such as "content" or "children".
+func itemURL(remotePath, relationship string) string {
+	remotePath = storage.CleanPath(remotePath)
+
+	url := "items/root"
+	if remotePath != "." {
+		segments := strings.Split(remotePath, "/")
+		for i, segment := range segments {
+			segments[i] = neturl.PathEscape(segment)
+		}
+		url += ":/" + strings.Join(segments, "/") + ":"
+	}
+	if relationship != "" {
+		url += "/" + relationship
+	}
+	return url
+}
+
+// checkStatus turns an unexpected response status into an error, wrapping
+// storage.ErrNotFound for 404 responses.
+func checkStatus(resp *http.Response, remotePath string, want int) error {
+	if resp.StatusCode == want {
+		return nil
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("%w: %s", storage.ErrNotFound, remotePath)
+	}
+	// Graph answers a delta link it no longer accepts with 410 Gone.
+	if resp.StatusCode == http.StatusGone {
+		return fmt.Errorf("%w: %s", storage.ErrCursorExpired, remotePath)
 	}
-	client := &http.Client{}
-	return client.Do(req)
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	return fmt.Errorf("unexpected status %s: %s", resp.Status, strings.TrimSpace(string(body)))
 }
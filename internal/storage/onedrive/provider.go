@@ -5,14 +5,16 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"mime"
 	"net/http"
 	"os"
+	"path"
 	"path/filepath"
+	"strings"
 	"time"
 
-	"github.com/amankumarsingh77/automated_backup_tool/internal/config"
-	"github.com/amankumarsingh77/automated_backup_tool/internal/utils/filesystem"
+	"github.com/amankumarsingh77/automated_backup_tool/internal/storage"
+	"github.com/amankumarsingh77/automated_backup_tool/internal/storage/oauthutil"
+	"github.com/amankumarsingh77/automated_backup_tool/internal/utils"
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/microsoft"
 )
@@ -20,19 +22,26 @@ import (
 type OneDriveProvider struct {
 	client          *http.Client
 	config          *oauth2.Config
-	token           *oauth2.Token
+	tokens          oauthutil.TokenStore
+	loginMode       string
 	isAuthenticated bool
+	baseURL         string
+	chunkSize       int64
 }
 
 type DriveItem struct {
-	DownloadUrl     string    `json:"@microsoft.graph.downloadUrl"`
-	CreatedDateTime time.Time `json:"createdDateTime"`
-	ID              string    `json:"id"`
-	Name            string    `json:"name"`
-	ParentReference ParentRef `json:"parentReference"`
-	WebUrl          string    `json:"webUrl"`
-	File            FileInfo  `json:"file"`
-	Size            int64     `json:"size"`
+	DownloadUrl          string      `json:"@microsoft.graph.downloadUrl"`
+	CreatedDateTime      time.Time   `json:"createdDateTime"`
+	LastModifiedDateTime time.Time   `json:"lastModifiedDateTime"`
+	ID                   string      `json:"id"`
+	Name                 string      `json:"name"`
+	ParentReference      ParentRef   `json:"parentReference"`
+	WebUrl               string      `json:"webUrl"`
+	File                 FileInfo    `json:"file"`
+	Folder               *FolderInfo `json:"folder"`
+	Size                 int64       `json:"size"`
+	// Deleted is only set in delta responses, for removed items.
+	Deleted *struct{} `json:"deleted"`
 }
 
 type User struct {
@@ -50,55 +59,101 @@ type ParentRef struct {
 
 type FileInfo struct {
 	MimeType string `json:"mimeType"`
+	Hashes   struct {
+		SHA256Hash   string `json:"sha256Hash"`
+		SHA1Hash     string `json:"sha1Hash"`
+		QuickXorHash string `json:"quickXorHash"`
+	} `json:"hashes"`
+}
+
+type FolderInfo struct {
+	ChildCount int `json:"childCount"`
+}
+
+func init() {
+	storage.Register("onedrive", func(cfg storage.Config) (storage.StorageProvider, error) {
+		if cfg.Credential == nil || cfg.Credential.Key == "" {
+			return nil, fmt.Errorf("onedrive requires an application (client) ID, run configure first")
+		}
+		if cfg.Tokens == nil {
+			return nil, fmt.Errorf("onedrive requires a token store")
+		}
+		p := NewOneDriveProvider()
+		p.SetCredentials(cfg.Credential.Key, cfg.Credential.Secret, cfg.Credential.RedirectURL, cfg.Credential.Options["tenant"])
+		// Older releases kept the token of the default remote in
+		// one-drive-token.json.
+		legacyName := "one-drive"
+		if cfg.Name != "" && cfg.Name != "onedrive" {
+			legacyName = cfg.Name
+		}
+		p.tokens = oauthutil.MigrateTokenFile(cfg.Tokens, legacyName)
+		p.loginMode = cfg.Credential.Options["login"]
+		if err := oauthutil.ValidateLoginMode(p.loginMode); err != nil {
+			return nil, err
+		}
+		return p, nil
+	})
 }
 
 func NewOneDriveProvider() *OneDriveProvider {
-	return &OneDriveProvider{}
+	return &OneDriveProvider{
+		baseURL:   ONEDRIVE_BASE_URL,
+		chunkSize: uploadChunkSize,
+	}
 }
 
-func (p *OneDriveProvider) Authenticate() error {
-	envConfig := config.LoadConfig()
-	
-	oneDriveConfig := &oauth2.Config{
-		ClientID: envConfig.Providers.OneDrive.ClientID,
-		
-		Endpoint:    microsoft.AzureADEndpoint("common"),
-		RedirectURL: envConfig.Providers.OneDrive.ONEDRIVE_CLIENT_REDIRECT_URL,
-		Scopes:      []string{"offline_access", "Files.ReadWrite"},
+// SetCredentials configures the Azure app registration to sign in with.
+// The secret is only needed for confidential clients; desktop registrations
+// rely on PKCE instead. tenant defaults to "common", which accepts both
+// personal and work accounts.
+func (p *OneDriveProvider) SetCredentials(clientID, clientSecret, redirectURL, tenant string) {
+	if tenant == "" {
+		tenant = "common"
 	}
+	p.config = &oauth2.Config{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		Endpoint:     microsoft.AzureADEndpoint(tenant),
+		RedirectURL:  redirectURL,
+		Scopes:       []string{"offline_access", "Files.ReadWrite"},
+	}
+}
 
-	token, err := filesystem.GetToken("one-drive")
-	if err == nil {
-		p.token = token
-		ts := oauth2.StaticTokenSource(p.token)
-		p.client = oauth2.NewClient(context.Background(), ts)
-		return nil
+func (p *OneDriveProvider) Authenticate(ctx context.Context) error {
+	token, err := p.tokens.LoadToken()
+	if err == nil && (token.Valid() || token.RefreshToken != "") {
+		ts := oauthutil.TokenSource(p.config, token, p.tokens)
+		// Refresh right away, so a revoked grant leads to a new login
+		// instead of failing the first request.
+		if _, err := ts.Token(); err == nil {
+			p.useTokenSource(ts)
+			return nil
+		}
+		utils.GetLogger().Warning("Saved OneDrive token could not be refreshed, logging in again: %v", err)
 	}
 
-	authUrl := oneDriveConfig.AuthCodeURL("state-token", oauth2.AccessTypeOffline, oauth2.ApprovalForce)
-	fmt.Printf("Visit the URL for the auth dialog: %v", authUrl)
-	var code string
-	fmt.Println("Enter the code below:")
-	fmt.Scanln(&code)
-	token, err = oneDriveConfig.Exchange(context.Background(), code)
+	token, err = oauthutil.Login(ctx, p.config, p.loginMode)
 	if err != nil {
-		return fmt.Errorf("error occured while generating token : %v\n", err.Error())
+		return err
 	}
-	err = filesystem.SaveTokenLocally("one-drive", token)
+	err = p.tokens.SaveToken(token)
 	if err != nil {
 		return fmt.Errorf("error saving token: %v\n", err)
 	}
-	p.token = token
-	ts := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: p.token.AccessToken})
+	p.useTokenSource(oauthutil.TokenSource(p.config, token, p.tokens))
+	utils.GetLogger().Info("Signed in to OneDrive, token saved")
+	return nil
+}
+
+// useTokenSource authorizes all further Graph requests with tokens from ts.
+func (p *OneDriveProvider) useTokenSource(ts oauth2.TokenSource) {
 	p.client = oauth2.NewClient(context.Background(), ts)
 	p.isAuthenticated = true
-	fmt.Println("Authentication successful and token saved")
-	return nil
 }
 
-func (p *OneDriveProvider) Upload(localPath, remotePath string) error {
+func (p *OneDriveProvider) Upload(ctx context.Context, localPath, remotePath string) error {
 	if !p.isAuthenticated {
-		err := p.Authenticate()
+		err := p.Authenticate(ctx)
 		if err != nil {
 			return err
 		}
@@ -107,46 +162,48 @@ func (p *OneDriveProvider) Upload(localPath, remotePath string) error {
 	if err != nil {
 		return fmt.Errorf("could not open file: %v", err.Error())
 	}
-	filename := filepath.Base(localPath)
 	defer file.Close()
-	url := fmt.Sprintf("items/root:/%s/%s:/content", remotePath, filename)
-	resp, err := makeRequest("PUT", url, p.token, file)
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("could not stat file: %v", err.Error())
+	}
+	if info.Size() > simpleUploadLimit {
+		if err := p.uploadSession(ctx, file, info.Size(), remotePath); err != nil {
+			return fmt.Errorf("could not upload file: %w", err)
+		}
+		return nil
+	}
+	resp, err := p.makeRequest(ctx, "PUT", itemURL(remotePath, "content"), file)
 	if err != nil {
 		return fmt.Errorf("could not upload file: %v", err.Error())
 	}
 	defer resp.Body.Close()
 	if !(resp.StatusCode >= http.StatusOK && resp.StatusCode < http.StatusBadRequest) {
 		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("could not upload file: %v", body)
+		return fmt.Errorf("could not upload file: %s", body)
 	}
-	fmt.Println("File Uploaded successfully!")
 	return nil
 }
 
-func (p *OneDriveProvider) Download(localPath, fileId string) error {
-	dir, _ := os.Getwd()
-	if err := os.Mkdir(dir, os.ModePerm); err != nil && !os.IsExist(err) {
-		return fmt.Errorf("could not create directory: %v", err.Error())
+func (p *OneDriveProvider) Download(ctx context.Context, localPath, remotePath string) error {
+	if !p.isAuthenticated {
+		err := p.Authenticate(ctx)
+		if err != nil {
+			return err
+		}
 	}
-	url := fmt.Sprintf("items/%s/content", fileId)
-	resp, err := makeRequest(http.MethodGet, url, p.token, nil)
+	resp, err := p.makeRequest(ctx, http.MethodGet, itemURL(remotePath, "content"), nil)
 	if err != nil {
 		return fmt.Errorf("could not download file: %v", err.Error())
 	}
 	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("could not download file: %v", resp.Status)
+	if err := checkStatus(resp, remotePath, http.StatusOK); err != nil {
+		return fmt.Errorf("could not download file: %w", err)
 	}
-	_, params, err := mime.ParseMediaType(resp.Header.Get("Content-Disposition"))
 
-	var filename string
-	if err == nil {
-		filename = filepath.Base(params["filename"])
-	} else {
-		filename = fileId
+	if err := os.MkdirAll(filepath.Dir(localPath), os.ModePerm); err != nil {
+		return fmt.Errorf("could not create directory: %v", err.Error())
 	}
-
-	localPath = filepath.Join(dir, filename)
 	file, err := os.Create(localPath)
 	if err != nil {
 		return fmt.Errorf("could not create file: %v", err.Error())
@@ -156,29 +213,127 @@ func (p *OneDriveProvider) Download(localPath, fileId string) error {
 	if err != nil {
 		return fmt.Errorf("could not download file: %v", err.Error())
 	}
-	fmt.Println("File Downloaded successfully!")
 	return nil
 }
 
-func (p *OneDriveProvider) ListFiles(folderId string) ([]*DriveItem, error) {
-	var result struct {
-		Value []*DriveItem `json:"value"`
+func (p *OneDriveProvider) Delete(ctx context.Context, remotePath string) error {
+	if !p.isAuthenticated {
+		err := p.Authenticate(ctx)
+		if err != nil {
+			return err
+		}
 	}
+	resp, err := p.makeRequest(ctx, http.MethodDelete, itemURL(remotePath, ""), nil)
+	if err != nil {
+		return fmt.Errorf("could not delete file: %w", err)
+	}
+	defer resp.Body.Close()
+	if err := checkStatus(resp, remotePath, http.StatusNoContent); err != nil {
+		return fmt.Errorf("could not delete file: %w", err)
+	}
+	return nil
+}
+
+func (p *OneDriveProvider) Stat(ctx context.Context, remotePath string) (storage.RemoteObject, error) {
+	if !p.isAuthenticated {
+		err := p.Authenticate(ctx)
+		if err != nil {
+			return storage.RemoteObject{}, err
+		}
+	}
+	var item DriveItem
+	if err := p.getJSON(ctx, itemURL(remotePath, ""), &item); err != nil {
+		return storage.RemoteObject{}, fmt.Errorf("could not stat file: %w", err)
+	}
+	return itemObject(storage.CleanPath(remotePath), &item), nil
+}
+
+// ListFiles walks the folder tree below remotePath, following
+// @odata.nextLink until every page of every folder has been read.
+func (p *OneDriveProvider) ListFiles(ctx context.Context, remotePath string) ([]storage.RemoteObject, error) {
+	if !p.isAuthenticated {
+		err := p.Authenticate(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var objects []storage.RemoteObject
+	pending := []string{storage.CleanPath(remotePath)}
+
+	for len(pending) > 0 {
+		folder := pending[0]
+		pending = pending[1:]
+
+		next := itemURL(folder, "children")
+		for next != "" {
+			var result struct {
+				Value    []*DriveItem `json:"value"`
+				NextLink string       `json:"@odata.nextLink"`
+			}
+			if err := p.getJSON(ctx, next, &result); err != nil {
+				return nil, fmt.Errorf("could not list files: %w", err)
+			}
+
+			for _, item := range result.Value {
+				object := itemObject(path.Join(folder, item.Name), item)
+				if object.IsDir {
+					pending = append(pending, object.Path)
+				}
+				objects = append(objects, object)
+			}
+			next = result.NextLink
+		}
+	}
+	return objects, nil
+}
 
-	query := fmt.Sprintf("items/%s/children", folderId)
-	resp, err := makeRequest(http.MethodGet, query, p.token, nil)
+func (p *OneDriveProvider) getJSON(ctx context.Context, url string, v interface{}) error {
+	resp, err := p.makeRequest(ctx, http.MethodGet, url, nil)
 	if err != nil {
-		return nil, fmt.Errorf("could not list files: %w", err)
+		return err
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	if err := checkStatus(resp, url, http.StatusOK); err != nil {
+		return err
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("could not decode response: %w", err)
 	}
+	return nil
+}
 
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return nil, fmt.Errorf("could not decode files: %w", err)
+func itemObject(remotePath string, item *DriveItem) storage.RemoteObject {
+	object := storage.RemoteObject{
+		Path:    remotePath,
+		ID:      item.ID,
+		Size:    item.Size,
+		ModTime: item.LastModifiedDateTime,
+		IsDir:   item.Folder != nil,
+		Hash:    itemHash(item),
 	}
+	if item.File.MimeType != "" {
+		object.Metadata = map[string]string{"mime_type": item.File.MimeType}
+	}
+	// Graph reports the total size of a folder's contents.
+	if object.IsDir {
+		object.Size = 0
+	}
+	return object
+}
 
-	return result.Value, nil
+// itemHash picks the strongest hash Graph reported. Personal accounts only
+// get sha1 and quickXor, business accounts only quickXor.
+func itemHash(item *DriveItem) string {
+	hashes := item.File.Hashes
+	switch {
+	case hashes.SHA256Hash != "":
+		return "sha256:" + strings.ToLower(hashes.SHA256Hash)
+	case hashes.SHA1Hash != "":
+		return "sha1:" + strings.ToLower(hashes.SHA1Hash)
+	case hashes.QuickXorHash != "":
+		return "quickxor:" + hashes.QuickXorHash
+	}
+	return ""
 }
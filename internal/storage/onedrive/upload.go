@@ -0,0 +1,183 @@
+package onedrive
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/amankumarsingh77/automated_backup_tool/internal/utils/retry"
+)
+
+const (
+	// simpleUploadLimit is the largest file Graph accepts in a single PUT.
+	simpleUploadLimit = 4 * 1024 * 1024
+	// uploadChunkSize is the size of each upload session range. Graph
+	// requires a multiple of 320 KiB.
+	uploadChunkSize = 32 * 320 * 1024
+)
+
+type uploadSessionInfo struct {
+	UploadURL          string   `json:"uploadUrl"`
+	NextExpectedRanges []string `json:"nextExpectedRanges"`
+}
+
+// uploadSession uploads large files through a Graph upload session, one
+// byte range at a time. A failed range is retried from the first byte the
+// session reports as missing, so a dropped connection only costs the data
+// that was in flight.
+func (p *OneDriveProvider) uploadSession(ctx context.Context, file io.ReaderAt, size int64, remotePath string) error {
+	uploadURL, err := p.createUploadSession(ctx, remotePath)
+	if err != nil {
+		return fmt.Errorf("could not create upload session: %w", err)
+	}
+
+	var offset int64
+	for offset < size {
+		backoff := retry.NewExponentialBackoff().WithInitialDelay(time.Second)
+		err := backoff.RetryWithBackoff(ctx, func() error {
+			next, err := p.uploadRange(ctx, uploadURL, file, offset, size)
+			if err == nil {
+				offset = next
+				return nil
+			}
+			var statusErr *sessionStatusError
+			if errors.As(err, &statusErr) && statusErr.status == http.StatusNotFound {
+				// The session expired or was cancelled server side.
+				return retry.NewRetryableError(err, false)
+			}
+			if resumed, resumeErr := p.sessionOffset(ctx, uploadURL); resumeErr == nil {
+				offset = resumed
+			}
+			return retry.NewRetryableError(err, true)
+		})
+		if err != nil {
+			p.cancelUploadSession(uploadURL)
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *OneDriveProvider) createUploadSession(ctx context.Context, remotePath string) (string, error) {
+	body := strings.NewReader(`{"item":{"@microsoft.graph.conflictBehavior":"replace"}}`)
+	resp, err := p.makeRequest(ctx, http.MethodPost, itemURL(remotePath, "createUploadSession"), body)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if err := checkStatus(resp, remotePath, http.StatusOK); err != nil {
+		return "", err
+	}
+
+	var session uploadSessionInfo
+	if err := json.NewDecoder(resp.Body).Decode(&session); err != nil {
+		return "", fmt.Errorf("could not decode upload session: %w", err)
+	}
+	if session.UploadURL == "" {
+		return "", errors.New("upload session has no upload URL")
+	}
+	return session.UploadURL, nil
+}
+
+// uploadRange sends the next chunk starting at offset and returns the offset
+// the session expects next. The upload URL is pre-authenticated and must be
+// sent without the Authorization header.
+func (p *OneDriveProvider) uploadRange(ctx context.Context, uploadURL string, file io.ReaderAt, offset, size int64) (int64, error) {
+	length := p.chunkSize
+	if offset+length > size {
+		length = size - offset
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, uploadURL, io.NewSectionReader(file, offset, length))
+	if err != nil {
+		return 0, err
+	}
+	req.ContentLength = length
+	req.Header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", offset, offset+length-1, size))
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusCreated:
+		return size, nil
+	case http.StatusAccepted:
+		var session uploadSessionInfo
+		if err := json.NewDecoder(resp.Body).Decode(&session); err != nil {
+			return 0, fmt.Errorf("could not decode upload progress: %w", err)
+		}
+		return nextExpectedOffset(session.NextExpectedRanges, offset+length)
+	default:
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return 0, &sessionStatusError{status: resp.StatusCode, body: strings.TrimSpace(string(body))}
+	}
+}
+
+// sessionOffset asks the upload session for the first byte it is missing.
+func (p *OneDriveProvider) sessionOffset(ctx context.Context, uploadURL string) (int64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uploadURL, nil)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, &sessionStatusError{status: resp.StatusCode}
+	}
+
+	var session uploadSessionInfo
+	if err := json.NewDecoder(resp.Body).Decode(&session); err != nil {
+		return 0, fmt.Errorf("could not decode upload session: %w", err)
+	}
+	return nextExpectedOffset(session.NextExpectedRanges, 0)
+}
+
+// cancelUploadSession discards the bytes already uploaded. It runs after the
+// upload context may have been cancelled, so it uses its own timeout.
+func (p *OneDriveProvider) cancelUploadSession(uploadURL string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, uploadURL, nil)
+	if err != nil {
+		return
+	}
+	if resp, err := http.DefaultClient.Do(req); err == nil {
+		resp.Body.Close()
+	}
+}
+
+// nextExpectedOffset parses the start of the first range in a
+// nextExpectedRanges list such as ["26-", "40-49"].
+func nextExpectedOffset(ranges []string, fallback int64) (int64, error) {
+	if len(ranges) == 0 {
+		return fallback, nil
+	}
+	start, _, _ := strings.Cut(ranges[0], "-")
+	offset, err := strconv.ParseInt(start, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid expected range %q", ranges[0])
+	}
+	return offset, nil
+}
+
+type sessionStatusError struct {
+	status int
+	body   string
+}
+
+func (e *sessionStatusError) Error() string {
+	return fmt.Sprintf("upload session returned status %d: %s", e.status, e.body)
+}
@@ -0,0 +1,118 @@
+package onedrive
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"golang.org/x/oauth2"
+)
+
+// fakeUploadSession accepts a Graph upload session and drops the connection
+// halfway through the second range, after keeping the bytes it received.
+type fakeUploadSession struct {
+	mu       sync.Mutex
+	server   *httptest.Server
+	received []byte
+	ranges   int
+	done     bool
+}
+
+func (f *fakeUploadSession) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch {
+	case r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, ":/createUploadSession"):
+		if r.Header.Get("Authorization") != "Bearer test-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprintf(w, `{"uploadUrl": "%s/upload/1", "nextExpectedRanges": ["0-"]}`, f.server.URL)
+	case r.URL.Path == "/upload/1" && r.Method == http.MethodGet:
+		fmt.Fprintf(w, `{"nextExpectedRanges": ["%d-"]}`, len(f.received))
+	case r.URL.Path == "/upload/1" && r.Method == http.MethodPut:
+		if r.Header.Get("Authorization") != "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		var start, end, total int
+		fmt.Sscanf(r.Header.Get("Content-Range"), "bytes %d-%d/%d", &start, &end, &total)
+		if start != len(f.received) {
+			w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+			return
+		}
+
+		f.ranges++
+		if f.ranges == 2 {
+			partial := make([]byte, (end-start+1)/2)
+			io.ReadFull(r.Body, partial)
+			f.received = append(f.received, partial...)
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Close()
+			return
+		}
+
+		body, _ := io.ReadAll(r.Body)
+		f.received = append(f.received, body...)
+		if len(f.received) == total {
+			f.done = true
+			w.WriteHeader(http.StatusCreated)
+			fmt.Fprint(w, `{"id": "item-1"}`)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+		fmt.Fprintf(w, `{"nextExpectedRanges": ["%d-"]}`, len(f.received))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestUploadSessionResumesAfterDroppedConnection(t *testing.T) {
+	fake := &fakeUploadSession{}
+	fake.server = httptest.NewServer(fake)
+	defer fake.server.Close()
+
+	p := NewOneDriveProvider()
+	p.baseURL = fake.server.URL + "/"
+	p.useTokenSource(oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "test-token"}))
+	p.chunkSize = 1024 * 1024
+
+	content := bytes.Repeat([]byte("onedrive"), (simpleUploadLimit+simpleUploadLimit/2)/8)
+	source := filepath.Join(t.TempDir(), "large.tar.gz")
+	if err := os.WriteFile(source, content, 0600); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	if err := p.Upload(context.Background(), source, "Backups/large.tar.gz"); err != nil {
+		t.Fatalf("Failed to upload file: %v", err)
+	}
+	if !fake.done || !bytes.Equal(fake.received, content) {
+		t.Errorf("Uploaded content does not match the source: got %d bytes, want %d", len(fake.received), len(content))
+	}
+}
+
+func TestNextExpectedOffset(t *testing.T) {
+	tests := []struct {
+		ranges []string
+		want   int64
+	}{
+		{nil, 42},
+		{[]string{"26-"}, 26},
+		{[]string{"12345-55232", "77829-99375"}, 12345},
+	}
+	for _, tt := range tests {
+		got, err := nextExpectedOffset(tt.ranges, 42)
+		if err != nil || got != tt.want {
+			t.Errorf("nextExpectedOffset(%v) = %d, %v, want %d", tt.ranges, got, err, tt.want)
+		}
+	}
+}
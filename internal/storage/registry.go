@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/amankumarsingh77/automated_backup_tool/internal/security/credentials"
+	"github.com/amankumarsingh77/automated_backup_tool/internal/storage/oauthutil"
+)
+
+var ErrUnknownProvider = errors.New("unknown storage provider")
+
+// Config is handed to a Factory when a provider is instantiated.
+type Config struct {
+	// Name is the remote the provider is instantiated for. Providers keep
+	// per-remote state, such as upload sessions, under it.
+	Name       string
+	Credential *credentials.Credential
+	// Tokens stores the OAuth token of the remote, for providers that
+	// sign in to a cloud account.
+	Tokens oauthutil.TokenStore
+}
+
+// Factory builds a ready to use provider from its stored configuration.
+type Factory func(cfg Config) (StorageProvider, error)
+
+var (
+	registryMu sync.RWMutex
+	factories  = make(map[string]Factory)
+)
+
+// Register makes a provider available under name. It is meant to be called
+// from the init function of the package implementing the provider and panics
+// if the name is registered twice.
+func Register(name string, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if factory == nil {
+		panic("storage: Register factory is nil for " + name)
+	}
+	if _, exists := factories[name]; exists {
+		panic("storage: Register called twice for " + name)
+	}
+	factories[name] = factory
+}
+
+// New instantiates the provider registered under name.
+func New(name string, cfg Config) (StorageProvider, error) {
+	registryMu.RLock()
+	factory, exists := factories[name]
+	registryMu.RUnlock()
+
+	if !exists {
+		return nil, Validate(name)
+	}
+	return factory(cfg)
+}
+
+// Validate returns an ErrUnknownProvider error if no provider is registered
+// under name.
+func Validate(name string) error {
+	registryMu.RLock()
+	_, exists := factories[name]
+	registryMu.RUnlock()
+
+	if !exists {
+		return fmt.Errorf("%w %q (available: %s)", ErrUnknownProvider, name, strings.Join(Providers(), ", "))
+	}
+	return nil
+}
+
+// Providers returns the names of all registered providers in sorted order.
+func Providers() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	names := make([]string, 0, len(factories))
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
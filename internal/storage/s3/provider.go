@@ -0,0 +1,466 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/amankumarsingh77/automated_backup_tool/internal/storage"
+)
+
+const (
+	defaultRegion   = "us-east-1"
+	defaultPartSize = 16 << 20
+	minPartSize     = 5 << 20
+	maxParts        = 10000
+)
+
+// S3Provider stores backups in a bucket of any S3 compatible object store,
+// such as AWS S3, MinIO, Backblaze B2 or Wasabi.
+type S3Provider struct {
+	client    *http.Client
+	signer    *signer
+	endpoint  *url.URL
+	bucket    string
+	prefix    string
+	pathStyle bool
+	partSize  int64
+}
+
+// Options configures an S3Provider. Endpoint defaults to AWS in Region, and
+// path style addressing is always used for custom endpoints.
+type Options struct {
+	Endpoint  string
+	Region    string
+	Bucket    string
+	Prefix    string
+	AccessKey string
+	SecretKey string
+	PathStyle bool
+	PartSize  int64
+}
+
+func init() {
+	storage.Register("s3", func(cfg storage.Config) (storage.StorageProvider, error) {
+		if cfg.Credential == nil {
+			return nil, fmt.Errorf("s3 requires an access key and bucket, run configure first")
+		}
+		opts := cfg.Credential.Options
+		partSize := int64(0)
+		if opts["part_size"] != "" {
+			mb, err := strconv.ParseInt(opts["part_size"], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid part_size %q: %w", opts["part_size"], err)
+			}
+			partSize = mb << 20
+		}
+		return NewS3Provider(Options{
+			Endpoint:  opts["endpoint"],
+			Region:    opts["region"],
+			Bucket:    opts["bucket"],
+			Prefix:    opts["prefix"],
+			AccessKey: cfg.Credential.Key,
+			SecretKey: cfg.Credential.Secret,
+			PathStyle: opts["path_style"] == "true",
+			PartSize:  partSize,
+		})
+	})
+}
+
+func NewS3Provider(opts Options) (*S3Provider, error) {
+	if opts.Bucket == "" {
+		return nil, errors.New("s3 bucket is required")
+	}
+	if opts.AccessKey == "" || opts.SecretKey == "" {
+		return nil, errors.New("s3 access key and secret key are required")
+	}
+	if opts.Region == "" {
+		opts.Region = defaultRegion
+	}
+
+	pathStyle := opts.PathStyle
+	if opts.Endpoint == "" {
+		opts.Endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", opts.Region)
+	} else {
+		pathStyle = true
+	}
+	endpoint, err := url.Parse(strings.TrimRight(opts.Endpoint, "/"))
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid s3 endpoint %q", opts.Endpoint)
+	}
+
+	partSize := opts.PartSize
+	if partSize == 0 {
+		partSize = defaultPartSize
+	}
+	if partSize < minPartSize {
+		return nil, fmt.Errorf("s3 part size must be at least %d MB", minPartSize>>20)
+	}
+
+	return &S3Provider{
+		client: &http.Client{},
+		signer: &signer{
+			accessKey: opts.AccessKey,
+			secretKey: opts.SecretKey,
+			region:    opts.Region,
+		},
+		endpoint:  endpoint,
+		bucket:    opts.Bucket,
+		prefix:    storage.CleanPath(opts.Prefix),
+		pathStyle: pathStyle,
+		partSize:  partSize,
+	}, nil
+}
+
+// Authenticate checks that the credentials grant access to the bucket.
+func (p *S3Provider) Authenticate(ctx context.Context) error {
+	resp, err := p.do(ctx, http.MethodHead, "", nil, nil, emptyPayloadHash)
+	if err != nil {
+		return fmt.Errorf("failed to access bucket %s: %w", p.bucket, err)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (p *S3Provider) Upload(ctx context.Context, localPath, remotePath string) error {
+	file, err := os.Open(localPath)
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat file: %w", err)
+	}
+
+	key := p.objectKey(remotePath)
+	if info.Size() <= p.partSize {
+		data, err := io.ReadAll(file)
+		if err != nil {
+			return fmt.Errorf("failed to read file: %w", err)
+		}
+		resp, err := p.do(ctx, http.MethodPut, key, nil, data, hashHex(data))
+		if err != nil {
+			return fmt.Errorf("failed to upload file: %w", err)
+		}
+		resp.Body.Close()
+		return nil
+	}
+
+	if err := p.uploadMultipart(ctx, key, file, info.Size()); err != nil {
+		return fmt.Errorf("failed to upload file: %w", err)
+	}
+	return nil
+}
+
+type completedPart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+// uploadMultipart sends the file in parts of partSize bytes. The upload is
+// aborted on failure so that the bucket is not left with orphaned parts.
+func (p *S3Provider) uploadMultipart(ctx context.Context, key string, file io.Reader, size int64) error {
+	partSize := p.partSize
+	for size/partSize >= maxParts {
+		partSize *= 2
+	}
+
+	resp, err := p.do(ctx, http.MethodPost, key, url.Values{"uploads": {""}}, nil, emptyPayloadHash)
+	if err != nil {
+		return fmt.Errorf("failed to start multipart upload: %w", err)
+	}
+	var initiated struct {
+		UploadID string `xml:"UploadId"`
+	}
+	err = xml.NewDecoder(resp.Body).Decode(&initiated)
+	resp.Body.Close()
+	if err != nil {
+		return fmt.Errorf("failed to decode multipart upload: %w", err)
+	}
+
+	uploadErr := func() error {
+		var parts []completedPart
+		buf := make([]byte, partSize)
+		for number := 1; ; number++ {
+			n, err := io.ReadFull(file, buf)
+			if err == io.EOF {
+				break
+			}
+			if err != nil && err != io.ErrUnexpectedEOF {
+				return fmt.Errorf("failed to read part %d: %w", number, err)
+			}
+
+			query := url.Values{
+				"partNumber": {strconv.Itoa(number)},
+				"uploadId":   {initiated.UploadID},
+			}
+			resp, err := p.do(ctx, http.MethodPut, key, query, buf[:n], hashHex(buf[:n]))
+			if err != nil {
+				return fmt.Errorf("failed to upload part %d: %w", number, err)
+			}
+			resp.Body.Close()
+			parts = append(parts, completedPart{PartNumber: number, ETag: resp.Header.Get("ETag")})
+
+			if n < len(buf) {
+				break
+			}
+		}
+
+		body, err := xml.Marshal(struct {
+			XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+			Parts   []completedPart `xml:"Part"`
+		}{Parts: parts})
+		if err != nil {
+			return err
+		}
+		resp, err := p.do(ctx, http.MethodPost, key, url.Values{"uploadId": {initiated.UploadID}}, body, hashHex(body))
+		if err != nil {
+			return fmt.Errorf("failed to complete multipart upload: %w", err)
+		}
+		defer resp.Body.Close()
+
+		// S3 can report a failed completion with a 200 status and an
+		// error document in the body.
+		data, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+		if bytes.Contains(data, []byte("<Error>")) {
+			return parseError(http.StatusOK, data)
+		}
+		return nil
+	}()
+
+	if uploadErr != nil {
+		abortCtx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		if resp, err := p.do(abortCtx, http.MethodDelete, key, url.Values{"uploadId": {initiated.UploadID}}, nil, emptyPayloadHash); err == nil {
+			resp.Body.Close()
+		}
+	}
+	return uploadErr
+}
+
+func (p *S3Provider) Download(ctx context.Context, localPath, remotePath string) error {
+	resp, err := p.do(ctx, http.MethodGet, p.objectKey(remotePath), nil, nil, emptyPayloadHash)
+	if err != nil {
+		return fmt.Errorf("failed to download file: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if err := os.MkdirAll(filepath.Dir(localPath), 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	outFile, err := os.Create(localPath)
+	if err != nil {
+		return fmt.Errorf("failed to create local file: %w", err)
+	}
+	defer outFile.Close()
+
+	if _, err := io.Copy(outFile, resp.Body); err != nil {
+		return fmt.Errorf("failed to save downloaded file: %w", err)
+	}
+	return nil
+}
+
+// Delete removes the object at remotePath. S3 reports success for keys that
+// do not exist, so the object is looked up first.
+func (p *S3Provider) Delete(ctx context.Context, remotePath string) error {
+	if _, err := p.Stat(ctx, remotePath); err != nil {
+		return fmt.Errorf("failed to delete file: %w", err)
+	}
+
+	resp, err := p.do(ctx, http.MethodDelete, p.objectKey(remotePath), nil, nil, emptyPayloadHash)
+	if err != nil {
+		return fmt.Errorf("failed to delete file: %w", err)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (p *S3Provider) Stat(ctx context.Context, remotePath string) (storage.RemoteObject, error) {
+	resp, err := p.do(ctx, http.MethodHead, p.objectKey(remotePath), nil, nil, emptyPayloadHash)
+	if err != nil {
+		return storage.RemoteObject{}, fmt.Errorf("failed to stat file: %w", err)
+	}
+	resp.Body.Close()
+
+	etag := strings.Trim(resp.Header.Get("ETag"), "\"")
+	object := storage.RemoteObject{
+		Path:     storage.CleanPath(remotePath),
+		Size:     resp.ContentLength,
+		Hash:     etagHash(etag),
+		Metadata: map[string]string{"etag": etag},
+	}
+	if modTime, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		object.ModTime = modTime
+	}
+	if class := resp.Header.Get("X-Amz-Storage-Class"); class != "" {
+		object.Metadata["storage_class"] = class
+	}
+	return object, nil
+}
+
+type listBucketResult struct {
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+	Contents              []struct {
+		Key          string    `xml:"Key"`
+		Size         int64     `xml:"Size"`
+		LastModified time.Time `xml:"LastModified"`
+		ETag         string    `xml:"ETag"`
+		StorageClass string    `xml:"StorageClass"`
+	} `xml:"Contents"`
+}
+
+// ListFiles lists every object below remotePath. S3 has no real folders, so
+// only zero byte "folder/" marker objects are reported as directories.
+func (p *S3Provider) ListFiles(ctx context.Context, remotePath string) ([]storage.RemoteObject, error) {
+	prefix := p.objectKey(remotePath)
+	if prefix != "" {
+		prefix += "/"
+	}
+
+	var objects []storage.RemoteObject
+	token := ""
+	for {
+		query := url.Values{
+			"list-type": {"2"},
+			"prefix":    {prefix},
+		}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+
+		resp, err := p.do(ctx, http.MethodGet, "", query, nil, emptyPayloadHash)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list files: %w", err)
+		}
+		var result listBucketResult
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode listing: %w", err)
+		}
+
+		for _, object := range result.Contents {
+			etag := strings.Trim(object.ETag, "\"")
+			objects = append(objects, storage.RemoteObject{
+				Path:    p.remotePath(object.Key),
+				Size:    object.Size,
+				ModTime: object.LastModified,
+				Hash:    etagHash(etag),
+				IsDir:   strings.HasSuffix(object.Key, "/"),
+				Metadata: map[string]string{
+					"etag":          etag,
+					"storage_class": object.StorageClass,
+				},
+			})
+		}
+
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			break
+		}
+		token = result.NextContinuationToken
+	}
+
+	return objects, nil
+}
+
+// etagHash returns the content hash carried by an ETag. The ETag is the MD5
+// of the content, except for multipart uploads where it has a "-<parts>"
+// suffix and no hash can be derived from it.
+func etagHash(etag string) string {
+	if etag == "" || strings.Contains(etag, "-") {
+		return ""
+	}
+	return "md5:" + etag
+}
+
+// objectKey maps a remote path onto an object key below the configured
+// prefix. The bucket root maps to the empty key.
+func (p *S3Provider) objectKey(remotePath string) string {
+	key := path.Join(p.prefix, storage.CleanPath(remotePath))
+	if key == "." {
+		return ""
+	}
+	return key
+}
+
+// remotePath is the inverse of objectKey.
+func (p *S3Provider) remotePath(key string) string {
+	key = strings.TrimSuffix(key, "/")
+	if p.prefix != "." {
+		key = strings.TrimPrefix(strings.TrimPrefix(key, p.prefix), "/")
+	}
+	return key
+}
+
+func (p *S3Provider) objectURL(key string, query url.Values) *url.URL {
+	u := *p.endpoint
+	if p.pathStyle {
+		u.Path = "/" + p.bucket
+		if key != "" {
+			u.Path += "/" + key
+		}
+	} else {
+		u.Host = p.bucket + "." + u.Host
+		u.Path = "/" + key
+	}
+	u.RawPath = canonicalURI(&u)
+	u.RawQuery = strings.ReplaceAll(query.Encode(), "+", "%20")
+	return &u
+}
+
+// do sends a signed request for key and turns S3 error responses into Go
+// errors. The caller must close the body of the returned response.
+func (p *S3Provider) do(ctx context.Context, method, key string, query url.Values, body []byte, payloadHash string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, p.objectURL(key, query).String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = int64(len(body))
+	p.signer.sign(req, payloadHash, time.Now())
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		return nil, parseError(resp.StatusCode, data)
+	}
+	return resp, nil
+}
+
+func parseError(status int, body []byte) error {
+	var s3Err struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	if err := xml.Unmarshal(body, &s3Err); err != nil || s3Err.Code == "" {
+		// HEAD responses carry no body to tell a missing key apart.
+		if status == http.StatusNotFound {
+			return storage.ErrNotFound
+		}
+		return fmt.Errorf("unexpected status code: %d", status)
+	}
+	if s3Err.Code == "NoSuchKey" {
+		return fmt.Errorf("%w: %s: %s (status %d)", storage.ErrNotFound, s3Err.Code, s3Err.Message, status)
+	}
+	return fmt.Errorf("%s: %s (status %d)", s3Err.Code, s3Err.Message, status)
+}
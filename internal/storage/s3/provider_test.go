@@ -0,0 +1,243 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/amankumarsingh77/automated_backup_tool/internal/storage"
+)
+
+// fakeS3 is a minimal in-memory stand-in for an S3 compatible server using
+// path style addressing. It understands just enough of the API for the
+// provider: objects, ListObjectsV2 and multipart uploads.
+type fakeS3 struct {
+	mu      sync.Mutex
+	bucket  string
+	objects map[string][]byte
+	uploads map[string]map[int][]byte
+	nextID  int
+}
+
+func newFakeS3(bucket string) *fakeS3 {
+	return &fakeS3{
+		bucket:  bucket,
+		objects: make(map[string][]byte),
+		uploads: make(map[string]map[int][]byte),
+	}
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if !strings.HasPrefix(r.Header.Get("Authorization"), signingAlgorithm+" Credential=test-access/") {
+		http.Error(w, "<Error><Code>AccessDenied</Code><Message>unsigned</Message></Error>", http.StatusForbidden)
+		return
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 2)
+	if parts[0] != f.bucket {
+		http.Error(w, "<Error><Code>NoSuchBucket</Code><Message>no bucket</Message></Error>", http.StatusNotFound)
+		return
+	}
+	key := ""
+	if len(parts) == 2 {
+		key = parts[1]
+	}
+	query := r.URL.Query()
+	body, _ := io.ReadAll(r.Body)
+
+	switch {
+	case key == "" && r.Method == http.MethodHead:
+	case key == "" && r.Method == http.MethodGet:
+		f.list(w, query.Get("prefix"), query.Get("continuation-token"))
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		f.nextID++
+		id := strconv.Itoa(f.nextID)
+		f.uploads[id] = make(map[int][]byte)
+		fmt.Fprintf(w, "<InitiateMultipartUploadResult><UploadId>%s</UploadId></InitiateMultipartUploadResult>", id)
+	case r.Method == http.MethodPut && query.Has("uploadId"):
+		number, _ := strconv.Atoi(query.Get("partNumber"))
+		f.uploads[query.Get("uploadId")][number] = body
+		w.Header().Set("ETag", fmt.Sprintf("\"etag-%d\"", number))
+	case r.Method == http.MethodPost && query.Has("uploadId"):
+		var complete struct {
+			Parts []completedPart `xml:"Part"`
+		}
+		xml.Unmarshal(body, &complete)
+		var data []byte
+		for _, part := range complete.Parts {
+			data = append(data, f.uploads[query.Get("uploadId")][part.PartNumber]...)
+		}
+		f.objects[key] = data
+		delete(f.uploads, query.Get("uploadId"))
+		fmt.Fprint(w, "<CompleteMultipartUploadResult></CompleteMultipartUploadResult>")
+	case r.Method == http.MethodPut:
+		f.objects[key] = body
+	case r.Method == http.MethodHead:
+		data, ok := f.objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		w.Header().Set("ETag", "\"abc\"")
+	case r.Method == http.MethodGet:
+		data, ok := f.objects[key]
+		if !ok {
+			http.Error(w, "<Error><Code>NoSuchKey</Code><Message>missing</Message></Error>", http.StatusNotFound)
+			return
+		}
+		w.Write(data)
+	case r.Method == http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// list returns one key per page to exercise pagination.
+func (f *fakeS3) list(w http.ResponseWriter, prefix, after string) {
+	var keys []string
+	for key := range f.objects {
+		if strings.HasPrefix(key, prefix) && key > after {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	var b bytes.Buffer
+	if len(keys) > 1 {
+		fmt.Fprintf(&b, "<ListBucketResult><IsTruncated>true</IsTruncated><NextContinuationToken>%s</NextContinuationToken>", keys[0])
+	} else {
+		b.WriteString("<ListBucketResult><IsTruncated>false</IsTruncated>")
+	}
+	if len(keys) > 0 {
+		fmt.Fprintf(&b, "<Contents><Key>%s</Key><Size>%d</Size><ETag>\"abc\"</ETag></Contents>", keys[0], len(f.objects[keys[0]]))
+	}
+	b.WriteString("</ListBucketResult>")
+	w.Write(b.Bytes())
+}
+
+func newTestProvider(t *testing.T, fake *fakeS3) *S3Provider {
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	p, err := NewS3Provider(Options{
+		Endpoint:  server.URL,
+		Bucket:    fake.bucket,
+		Prefix:    "host-a",
+		AccessKey: "test-access",
+		SecretKey: "test-secret",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create provider: %v", err)
+	}
+	return p
+}
+
+func TestS3ProviderRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	fake := newFakeS3("backups")
+	p := newTestProvider(t, fake)
+
+	if err := p.Authenticate(ctx); err != nil {
+		t.Fatalf("Failed to authenticate: %v", err)
+	}
+
+	work := t.TempDir()
+	source := filepath.Join(work, "archive.gz")
+	content := []byte("nightly archive")
+	if err := os.WriteFile(source, content, 0600); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	if err := p.Upload(ctx, source, "/daily/archive.gz"); err != nil {
+		t.Fatalf("Failed to upload file: %v", err)
+	}
+	if _, ok := fake.objects["host-a/daily/archive.gz"]; !ok {
+		t.Fatalf("Object not stored below the prefix: %v", fake.objects)
+	}
+
+	if err := p.Upload(ctx, source, "/weekly/archive.gz"); err != nil {
+		t.Fatalf("Failed to upload file: %v", err)
+	}
+
+	files, err := p.ListFiles(ctx, "/")
+	if err != nil {
+		t.Fatalf("Failed to list files: %v", err)
+	}
+	if len(files) != 2 || files[0].Path != "daily/archive.gz" || files[1].Path != "weekly/archive.gz" {
+		t.Fatalf("Unexpected root listing: %+v", files)
+	}
+	if files[0].Size != int64(len(content)) || files[0].Hash != "md5:abc" {
+		t.Errorf("Listing is missing size or hash: %+v", files[0])
+	}
+
+	object, err := p.Stat(ctx, "/daily/archive.gz")
+	if err != nil {
+		t.Fatalf("Failed to stat file: %v", err)
+	}
+	if object.Path != "daily/archive.gz" || object.Size != int64(len(content)) || object.Hash != "md5:abc" {
+		t.Errorf("Unexpected stat result: %+v", object)
+	}
+
+	restored := filepath.Join(work, "restored.gz")
+	if err := p.Download(ctx, restored, "daily/archive.gz"); err != nil {
+		t.Fatalf("Failed to download file: %v", err)
+	}
+	data, _ := os.ReadFile(restored)
+	if !bytes.Equal(data, content) {
+		t.Error("Downloaded content does not match uploaded content")
+	}
+
+	if err := p.Delete(ctx, "daily/archive.gz"); err != nil {
+		t.Fatalf("Failed to delete file: %v", err)
+	}
+	if err := p.Download(ctx, restored, "daily/archive.gz"); err == nil || !strings.Contains(err.Error(), "NoSuchKey") {
+		t.Errorf("Expected NoSuchKey after delete, got %v", err)
+	}
+	if _, err := p.Stat(ctx, "daily/archive.gz"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound from stat after delete, got %v", err)
+	}
+	if err := p.Delete(ctx, "daily/archive.gz"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound from a second delete, got %v", err)
+	}
+}
+
+func TestS3ProviderMultipartUpload(t *testing.T) {
+	ctx := context.Background()
+	fake := newFakeS3("backups")
+	p := newTestProvider(t, fake)
+	p.partSize = 1024
+
+	content := bytes.Repeat([]byte("0123456789"), 350)
+	source := filepath.Join(t.TempDir(), "large.tar.gz")
+	if err := os.WriteFile(source, content, 0600); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	if err := p.Upload(ctx, source, "large.tar.gz"); err != nil {
+		t.Fatalf("Failed to upload file: %v", err)
+	}
+	if !bytes.Equal(fake.objects["host-a/large.tar.gz"], content) {
+		t.Error("Reassembled multipart object does not match the source")
+	}
+	if len(fake.uploads) != 0 {
+		t.Error("Multipart upload was not completed")
+	}
+}
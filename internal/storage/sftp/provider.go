@@ -0,0 +1,339 @@
+package sftp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/amankumarsingh77/automated_backup_tool/internal/storage"
+	sftpclient "github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// SFTPProvider uploads backups to a remote host over SSH.
+type SFTPProvider struct {
+	addr       string
+	root       string
+	sshConfig  *ssh.ClientConfig
+	sshClient  *ssh.Client
+	sftpClient *sftpclient.Client
+}
+
+// Options configures an SFTPProvider. PrivateKey holds the PEM encoded key
+// itself, so it can be kept in the encrypted credential store. When both a
+// key and a password are given, the password is tried as the key passphrase
+// and as a fallback password login.
+type Options struct {
+	Host           string
+	Port           string
+	User           string
+	Password       string
+	PrivateKey     string
+	KnownHostsFile string
+	Root           string
+}
+
+func init() {
+	storage.Register("sftp", func(cfg storage.Config) (storage.StorageProvider, error) {
+		if cfg.Credential == nil {
+			return nil, errors.New("sftp requires a host and user, run configure first")
+		}
+		opts := cfg.Credential.Options
+		return NewSFTPProvider(Options{
+			Host:           opts["host"],
+			Port:           opts["port"],
+			User:           cfg.Credential.Key,
+			Password:       cfg.Credential.Secret,
+			PrivateKey:     opts["private_key"],
+			KnownHostsFile: opts["known_hosts"],
+			Root:           opts["root"],
+		})
+	})
+}
+
+func NewSFTPProvider(opts Options) (*SFTPProvider, error) {
+	if opts.Host == "" || opts.User == "" {
+		return nil, errors.New("sftp host and user are required")
+	}
+	if opts.Port == "" {
+		opts.Port = "22"
+	}
+
+	var auth []ssh.AuthMethod
+	if opts.PrivateKey != "" {
+		signer, err := ssh.ParsePrivateKey([]byte(opts.PrivateKey))
+		var missing *ssh.PassphraseMissingError
+		if errors.As(err, &missing) {
+			signer, err = ssh.ParsePrivateKeyWithPassphrase([]byte(opts.PrivateKey), []byte(opts.Password))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse private key: %w", err)
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+	if opts.Password != "" {
+		auth = append(auth, ssh.Password(opts.Password))
+	}
+	if len(auth) == 0 {
+		return nil, errors.New("sftp requires a private key or a password")
+	}
+
+	if opts.KnownHostsFile == "" {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get home directory: %w", err)
+		}
+		opts.KnownHostsFile = filepath.Join(homeDir, ".ssh", "known_hosts")
+	}
+	hostKeyCallback, err := knownhosts.New(opts.KnownHostsFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load known hosts from %s: %w", opts.KnownHostsFile, err)
+	}
+
+	root := opts.Root
+	if root == "" {
+		root = "."
+	}
+
+	return &SFTPProvider{
+		addr: net.JoinHostPort(opts.Host, opts.Port),
+		root: root,
+		sshConfig: &ssh.ClientConfig{
+			User:            opts.User,
+			Auth:            auth,
+			HostKeyCallback: hostKeyCallback,
+			Timeout:         30 * time.Second,
+		},
+	}, nil
+}
+
+// Authenticate opens the SSH connection and the SFTP session on top of it.
+// The host key must be listed in the known hosts file.
+func (p *SFTPProvider) Authenticate(ctx context.Context) error {
+	if p.sftpClient != nil {
+		return nil
+	}
+
+	dialer := &net.Dialer{Timeout: p.sshConfig.Timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", p.addr)
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s: %w", p.addr, err)
+	}
+
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, p.addr, p.sshConfig)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("ssh handshake with %s failed: %w", p.addr, err)
+	}
+	p.sshClient = ssh.NewClient(sshConn, chans, reqs)
+
+	p.sftpClient, err = sftpclient.NewClient(p.sshClient)
+	if err != nil {
+		p.sshClient.Close()
+		p.sshClient = nil
+		return fmt.Errorf("failed to start sftp session: %w", err)
+	}
+	return nil
+}
+
+// Close ends the SFTP session and the underlying SSH connection.
+func (p *SFTPProvider) Close() error {
+	if p.sftpClient == nil {
+		return nil
+	}
+	p.sftpClient.Close()
+	err := p.sshClient.Close()
+	p.sftpClient, p.sshClient = nil, nil
+	return err
+}
+
+// Upload writes to a temporary file in the target directory and renames it
+// into place, so an interrupted transfer never replaces a complete backup.
+func (p *SFTPProvider) Upload(ctx context.Context, localPath, remotePath string) error {
+	if err := p.Authenticate(ctx); err != nil {
+		return err
+	}
+
+	src, err := os.Open(localPath)
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+	defer src.Close()
+
+	target := p.resolve(remotePath)
+	if err := p.sftpClient.MkdirAll(path.Dir(target)); err != nil {
+		return fmt.Errorf("failed to create remote directory: %w", err)
+	}
+
+	tmpPath := storage.TempName(target)
+	dst, err := p.sftpClient.Create(tmpPath)
+	if err != nil {
+		return fmt.Errorf("failed to create remote file: %w", err)
+	}
+
+	if _, err := dst.ReadFrom(contextReader{ctx, src}); err != nil {
+		dst.Close()
+		p.sftpClient.Remove(tmpPath)
+		return fmt.Errorf("failed to upload file: %w", err)
+	}
+	if err := dst.Close(); err != nil {
+		p.sftpClient.Remove(tmpPath)
+		return fmt.Errorf("failed to upload file: %w", err)
+	}
+
+	if err := p.sftpClient.PosixRename(tmpPath, target); err != nil {
+		if err := p.replace(tmpPath, target); err != nil {
+			p.sftpClient.Remove(tmpPath)
+			return fmt.Errorf("failed to move uploaded file into place: %w", err)
+		}
+	}
+	return nil
+}
+
+// replace renames tmpPath to target on servers without the posix-rename
+// extension, which refuse to rename over an existing file. The previous
+// backup at target is moved aside first, put back if the new file cannot
+// take its place and deleted only once it has.
+func (p *SFTPProvider) replace(tmpPath, target string) error {
+	aside := storage.TempName(target)
+	moved := p.sftpClient.Rename(target, aside) == nil
+	if err := p.sftpClient.Rename(tmpPath, target); err != nil {
+		if moved {
+			p.sftpClient.Rename(aside, target)
+		}
+		return err
+	}
+	if moved {
+		p.sftpClient.Remove(aside)
+	}
+	return nil
+}
+
+func (p *SFTPProvider) Download(ctx context.Context, localPath, remotePath string) error {
+	if err := p.Authenticate(ctx); err != nil {
+		return err
+	}
+
+	src, err := p.sftpClient.Open(p.resolve(remotePath))
+	if err != nil {
+		return fmt.Errorf("failed to open remote file: %w", notFound(err, remotePath))
+	}
+	defer src.Close()
+
+	if err := os.MkdirAll(filepath.Dir(localPath), 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	dst, err := os.Create(localPath)
+	if err != nil {
+		return fmt.Errorf("failed to create local file: %w", err)
+	}
+	defer dst.Close()
+
+	if _, err := io.Copy(dst, contextReader{ctx, src}); err != nil {
+		return fmt.Errorf("failed to download file: %w", err)
+	}
+	return nil
+}
+
+func (p *SFTPProvider) Delete(ctx context.Context, remotePath string) error {
+	if err := p.Authenticate(ctx); err != nil {
+		return err
+	}
+
+	if err := p.sftpClient.Remove(p.resolve(remotePath)); err != nil {
+		return fmt.Errorf("failed to delete file: %w", notFound(err, remotePath))
+	}
+	return nil
+}
+
+func (p *SFTPProvider) Stat(ctx context.Context, remotePath string) (storage.RemoteObject, error) {
+	if err := p.Authenticate(ctx); err != nil {
+		return storage.RemoteObject{}, err
+	}
+
+	info, err := p.sftpClient.Stat(p.resolve(remotePath))
+	if err != nil {
+		return storage.RemoteObject{}, fmt.Errorf("failed to stat file: %w", notFound(err, remotePath))
+	}
+	return objectFromInfo(storage.CleanPath(remotePath), info), nil
+}
+
+func (p *SFTPProvider) ListFiles(ctx context.Context, remotePath string) ([]storage.RemoteObject, error) {
+	if err := p.Authenticate(ctx); err != nil {
+		return nil, err
+	}
+
+	remotePath = storage.CleanPath(remotePath)
+	dir := p.resolve(remotePath)
+
+	var objects []storage.RemoteObject
+	walker := p.sftpClient.Walk(dir)
+	for walker.Step() {
+		if err := walker.Err(); err != nil {
+			return nil, fmt.Errorf("failed to list files: %w", notFound(err, remotePath))
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if walker.Path() == dir {
+			continue
+		}
+		// Uploads in progress, or left behind by a lost connection, are
+		// not backups yet.
+		if !walker.Stat().IsDir() && storage.IsTempName(path.Base(walker.Path())) {
+			continue
+		}
+
+		objectPath := path.Join(remotePath, strings.TrimPrefix(walker.Path(), dir+"/"))
+		objects = append(objects, objectFromInfo(objectPath, walker.Stat()))
+	}
+	return objects, nil
+}
+
+func objectFromInfo(remotePath string, info os.FileInfo) storage.RemoteObject {
+	object := storage.RemoteObject{
+		Path:    remotePath,
+		ModTime: info.ModTime(),
+		IsDir:   info.IsDir(),
+		Metadata: map[string]string{
+			"mode": info.Mode().String(),
+		},
+	}
+	if !info.IsDir() {
+		object.Size = info.Size()
+	}
+	return object
+}
+
+// notFound translates a missing remote file into storage.ErrNotFound.
+func notFound(err error, remotePath string) error {
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("%w: %s", storage.ErrNotFound, storage.CleanPath(remotePath))
+	}
+	return err
+}
+
+func (p *SFTPProvider) resolve(remotePath string) string {
+	return path.Join(p.root, storage.CleanPath(remotePath))
+}
+
+// contextReader stops a transfer once its context is cancelled.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r contextReader) Read(b []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(b)
+}
@@ -0,0 +1,235 @@
+package sftp
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/amankumarsingh77/automated_backup_tool/internal/storage"
+	sftpclient "github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// startSSHServer runs an in-process SSH server that serves the sftp
+// subsystem from root and accepts password logins for user "backup". It
+// returns the listen address and the server host key.
+func startSSHServer(t *testing.T, root string) (string, ssh.PublicKey) {
+	t.Helper()
+
+	_, hostKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate host key: %v", err)
+	}
+	signer, err := ssh.NewSignerFromKey(hostKey)
+	if err != nil {
+		t.Fatalf("Failed to create host key signer: %v", err)
+	}
+
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if conn.User() == "backup" && string(password) == "secret" {
+				return nil, nil
+			}
+			return nil, ssh.ErrNoAuth
+		},
+	}
+	config.AddHostKey(signer)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveSSH(conn, config, root)
+		}
+	}()
+
+	return listener.Addr().String(), signer.PublicKey()
+}
+
+func serveSSH(conn net.Conn, config *ssh.ServerConfig, root string) {
+	_, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+
+	for newChannel := range chans {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "unsupported channel type")
+			continue
+		}
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			for req := range requests {
+				ok := req.Type == "subsystem" && string(req.Payload[4:]) == "sftp"
+				req.Reply(ok, nil)
+				if !ok {
+					continue
+				}
+				server, err := sftpclient.NewServer(channel, sftpclient.WithServerWorkingDirectory(root))
+				if err != nil {
+					channel.Close()
+					return
+				}
+				server.Serve()
+				channel.Close()
+				return
+			}
+		}()
+	}
+}
+
+func newTestProvider(t *testing.T, root string, trusted bool) *SFTPProvider {
+	t.Helper()
+
+	addr, hostKey := startSSHServer(t, root)
+	host, port, _ := net.SplitHostPort(addr)
+
+	knownHosts := filepath.Join(t.TempDir(), "known_hosts")
+	line := ""
+	if trusted {
+		line = knownhosts.Line([]string{knownhosts.Normalize(addr)}, hostKey) + "\n"
+	}
+	if err := os.WriteFile(knownHosts, []byte(line), 0600); err != nil {
+		t.Fatalf("Failed to write known hosts: %v", err)
+	}
+
+	p, err := NewSFTPProvider(Options{
+		Host:           host,
+		Port:           port,
+		User:           "backup",
+		Password:       "secret",
+		KnownHostsFile: knownHosts,
+		Root:           "backups",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create provider: %v", err)
+	}
+	t.Cleanup(func() { p.Close() })
+	return p
+}
+
+func TestSFTPProvider(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	p := newTestProvider(t, root, true)
+
+	work := t.TempDir()
+	source := filepath.Join(work, "archive.gz")
+	content := []byte("offsite archive")
+	if err := os.WriteFile(source, content, 0600); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	if err := p.Upload(ctx, source, "/host-a/archive.gz"); err != nil {
+		t.Fatalf("Failed to upload file: %v", err)
+	}
+	stored, err := os.ReadFile(filepath.Join(root, "backups", "host-a", "archive.gz"))
+	if err != nil || string(stored) != string(content) {
+		t.Fatalf("Uploaded file not stored on the server: %v", err)
+	}
+
+	// A temporary file left by an interrupted upload is not listed.
+	stray := filepath.Join(root, "backups", "host-a", ".archive.gz.123456.tmp")
+	if err := os.WriteFile(stray, content[:4], 0600); err != nil {
+		t.Fatalf("Failed to create temporary file: %v", err)
+	}
+
+	files, err := p.ListFiles(ctx, "/")
+	if err != nil {
+		t.Fatalf("Failed to list files: %v", err)
+	}
+	if len(files) != 2 || !files[0].IsDir || files[1].Path != "host-a/archive.gz" || files[1].Size != int64(len(content)) {
+		t.Errorf("Unexpected listing, temporary files left behind? %+v", files)
+	}
+
+	object, err := p.Stat(ctx, "/host-a/archive.gz")
+	if err != nil {
+		t.Fatalf("Failed to stat file: %v", err)
+	}
+	if object.Path != "host-a/archive.gz" || object.Size != int64(len(content)) {
+		t.Errorf("Unexpected stat result: %+v", object)
+	}
+
+	restored := filepath.Join(work, "restored.gz")
+	if err := p.Download(ctx, restored, "host-a/archive.gz"); err != nil {
+		t.Fatalf("Failed to download file: %v", err)
+	}
+	if data, _ := os.ReadFile(restored); string(data) != string(content) {
+		t.Error("Downloaded content does not match uploaded content")
+	}
+
+	if err := p.Delete(ctx, "host-a/archive.gz"); err != nil {
+		t.Fatalf("Failed to delete file: %v", err)
+	}
+	if files, _ := p.ListFiles(ctx, "host-a"); len(files) != 0 {
+		t.Errorf("File still listed after delete: %v", files)
+	}
+	if _, err := p.Stat(ctx, "host-a/archive.gz"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound from stat after delete, got %v", err)
+	}
+}
+
+func TestSFTPProviderReplaceKeepsBackupOnFailure(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	p := newTestProvider(t, root, true)
+	if err := p.Authenticate(ctx); err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+
+	dir := filepath.Join(root, "backups")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	target := filepath.Join(dir, "archive.gz")
+	if err := os.WriteFile(target, []byte("old"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// The new file is missing, so it cannot take the place of the old one.
+	if err := p.replace(p.resolve(".archive.gz.1.tmp"), p.resolve("archive.gz")); err == nil {
+		t.Fatal("Expected replacing with a missing file to fail")
+	}
+	if data, err := os.ReadFile(target); err != nil || string(data) != "old" {
+		t.Fatalf("Expected the previous backup to be kept, got %q: %v", data, err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, ".archive.gz.2.tmp"), []byte("new"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.replace(p.resolve(".archive.gz.2.tmp"), p.resolve("archive.gz")); err != nil {
+		t.Fatalf("Failed to replace the backup: %v", err)
+	}
+	if data, err := os.ReadFile(target); err != nil || string(data) != "new" {
+		t.Errorf("Expected the new backup in place, got %q: %v", data, err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("Expected only the backup to be left, got %d files", len(entries))
+	}
+}
+
+func TestSFTPProviderRejectsUnknownHost(t *testing.T) {
+	p := newTestProvider(t, t.TempDir(), false)
+
+	if err := p.Authenticate(context.Background()); err == nil {
+		t.Error("Expected the connection to fail for a host missing from known_hosts")
+	}
+}
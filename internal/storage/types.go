@@ -1,8 +1,158 @@
 package storage
 
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is wrapped by the errors Stat, Download and Delete return when
+// nothing exists at the given remote path.
+var ErrNotFound = errors.New("remote object not found")
+
+// ErrUnsupported is wrapped by the errors of operations a provider cannot
+// perform on a particular object, such as downloading a Google Form.
+var ErrUnsupported = errors.New("operation not supported for this object")
+
+// ErrCursorExpired is wrapped by the errors a ChangeFeed returns when the
+// cursor is too old to continue from. Callers start over with a listing.
+var ErrCursorExpired = errors.New("change feed cursor expired")
+
+// MetaExportExtension is the Metadata key naming the file extension, such
+// as ".docx", of objects that only exist as cloud documents and are
+// converted to a file format by Download.
+const MetaExportExtension = "export_extension"
+
+// RemoteObject describes a file or folder stored by a provider, independent
+// of the backend.
+type RemoteObject struct {
+	// Path is slash separated and relative to the root of the destination,
+	// so it can be passed back to Download and Delete.
+	Path string
+	// ID is the provider's own identifier, empty for path addressed stores.
+	ID      string
+	Size    int64
+	ModTime time.Time
+	// Hash is the content hash reported by the backend in the form
+	// "<algorithm>:<hex digest>", or empty if the backend has none.
+	Hash  string
+	IsDir bool
+	// Metadata holds backend specific attributes such as MIME types.
+	Metadata map[string]string
+}
+
+// Name returns the last element of the object's path.
+func (o RemoteObject) Name() string {
+	return path.Base(o.Path)
+}
+
+// StorageProvider is implemented by every backup destination. Remote paths
+// are slash separated and relative to the root of the destination, so the
+// path a file was uploaded to is all that is needed to fetch it again.
 type StorageProvider interface {
-	Authenticate() error
-	Upload(localPath, remotePath string) error
-	Download(localPath, remotePath string) error
-	ListFiles(remotePath string) ([]string, error) //TODO: Add File Struct
+	Authenticate(ctx context.Context) error
+	Upload(ctx context.Context, localPath, remotePath string) error
+	// Download writes the object at remotePath to the file localPath.
+	Download(ctx context.Context, localPath, remotePath string) error
+	Delete(ctx context.Context, remotePath string) error
+	// Stat describes the single object at remotePath.
+	Stat(ctx context.Context, remotePath string) (RemoteObject, error)
+	// ListFiles returns every object below remotePath, descending into
+	// folders and following pagination until the listing is complete.
+	ListFiles(ctx context.Context, remotePath string) ([]RemoteObject, error)
+}
+
+// CleanPath normalises a remote path to a slash separated path without
+// leading or trailing slashes. The root is returned as ".".
+func CleanPath(remotePath string) string {
+	remotePath = strings.ReplaceAll(remotePath, "\\", "/")
+	remotePath = strings.TrimPrefix(path.Clean("/"+remotePath), "/")
+	if remotePath == "" {
+		return "."
+	}
+	return remotePath
+}
+
+// tempSuffix ends the names of the temporary files uploads are written to.
+const tempSuffix = ".tmp"
+
+// TempName returns a name for the temporary file an upload to target is
+// written to before it is moved into place: a dot, the base name of target,
+// a dot, digits and ".tmp", in the folder of target.
+func TempName(target string) string {
+	return path.Join(path.Dir(target), fmt.Sprintf(".%s.%d%s", path.Base(target), time.Now().UnixNano(), tempSuffix))
+}
+
+// IsTempName reports whether name, the last element of a path, is that of
+// a temporary upload file as made by TempName. Providers leave them out of
+// listings, since they are not backups yet.
+func IsTempName(name string) bool {
+	rest, ok := strings.CutPrefix(name, ".")
+	if !ok {
+		return false
+	}
+	if rest, ok = strings.CutSuffix(rest, tempSuffix); !ok {
+		return false
+	}
+	i := strings.LastIndexByte(rest, '.')
+	if i <= 0 || i == len(rest)-1 {
+		return false
+	}
+	for _, c := range rest[i+1:] {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+type uploadIDKey struct{}
+
+// WithUploadID returns a context for uploading the same file under the same
+// ID again, such as the archive of a backup run retried after a restart.
+// Providers with resumable uploads use the ID to find the saved session.
+func WithUploadID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, uploadIDKey{}, id)
+}
+
+// UploadID returns the ID set by WithUploadID, or "".
+func UploadID(ctx context.Context) string {
+	id, _ := ctx.Value(uploadIDKey{}).(string)
+	return id
+}
+
+// Change is one entry of a provider's change feed.
+type Change struct {
+	// ID identifies the object that changed.
+	ID string
+	// Removed is set when the object was deleted or moved to the trash.
+	// Object and ParentID are empty then.
+	Removed bool
+	// Object describes the object after the change. Feeds report objects
+	// by ID, so its Path holds only the object's name.
+	Object RemoteObject
+	// ParentID is the ID of the folder now holding the object.
+	ParentID string
+}
+
+// ChangeFeed is implemented by providers that can report what changed
+// since an earlier point, so copying a cloud folder does not need to walk
+// the whole tree on every run.
+type ChangeFeed interface {
+	// Changes returns what changed below remotePath since cursor, and the
+	// cursor to pass next time. An empty cursor returns no changes, only
+	// the cursor for the current state. Feeds may report changes outside
+	// remotePath, callers ignore objects whose parent they do not know.
+	Changes(ctx context.Context, remotePath, cursor string) ([]Change, string, error)
+}
+
+// SourceChecker is implemented by providers whose login may not reach every
+// folder of the account, such as a Google Drive remote signed in with
+// device login. CheckSource returns why folders cannot be backed up from
+// the remote, or nil.
+type SourceChecker interface {
+	CheckSource() error
 }
@@ -0,0 +1,347 @@
+package webdav
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/amankumarsingh77/automated_backup_tool/internal/storage"
+)
+
+const propfindBody = `<?xml version="1.0" encoding="utf-8"?>
+<d:propfind xmlns:d="DAV:"><d:prop><d:resourcetype/><d:getcontentlength/><d:getlastmodified/><d:getetag/></d:prop></d:propfind>`
+
+// WebDAVProvider stores backups on a WebDAV server such as Nextcloud,
+// ownCloud or Apache mod_dav.
+type WebDAVProvider struct {
+	client   *http.Client
+	baseURL  *url.URL
+	user     string
+	password string
+}
+
+func init() {
+	storage.Register("webdav", func(cfg storage.Config) (storage.StorageProvider, error) {
+		if cfg.Credential == nil {
+			return nil, errors.New("webdav requires a server URL, run configure first")
+		}
+		return NewWebDAVProvider(cfg.Credential.Options["url"], cfg.Credential.Key, cfg.Credential.Secret)
+	})
+}
+
+// NewWebDAVProvider creates a provider rooted at baseURL, for Nextcloud
+// typically https://host/remote.php/dav/files/<user>/.
+func NewWebDAVProvider(baseURL, user, password string) (*WebDAVProvider, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, fmt.Errorf("invalid webdav url %q", baseURL)
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/")
+
+	return &WebDAVProvider{
+		client:   &http.Client{},
+		baseURL:  u,
+		user:     user,
+		password: password,
+	}, nil
+}
+
+// Authenticate checks that the base URL is a collection the configured user
+// can access.
+func (p *WebDAVProvider) Authenticate(ctx context.Context) error {
+	resp, err := p.do(ctx, "PROPFIND", ".", strings.NewReader(propfindBody), map[string]string{
+		"Depth":        "0",
+		"Content-Type": "application/xml",
+	})
+	if err != nil {
+		return fmt.Errorf("failed to access %s: %w", p.baseURL.Redacted(), err)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Upload PUTs the file under a temporary name and MOVEs it over the target,
+// so readers never see a partially uploaded backup. The temporary file is
+// deleted when either step fails.
+func (p *WebDAVProvider) Upload(ctx context.Context, localPath, remotePath string) error {
+	file, err := os.Open(localPath)
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat file: %w", err)
+	}
+
+	remotePath = storage.CleanPath(remotePath)
+	if err := p.getOrCreateFolder(ctx, path.Dir(remotePath)); err != nil {
+		return fmt.Errorf("failed to create/get folder: %w", err)
+	}
+
+	tmpPath := storage.TempName(remotePath)
+	req, err := p.newRequest(ctx, http.MethodPut, tmpPath, file, nil)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = info.Size()
+	resp, err := p.send(req)
+	if err != nil {
+		// The server may have kept what it received.
+		p.Delete(context.WithoutCancel(ctx), tmpPath)
+		return fmt.Errorf("failed to upload file: %w", err)
+	}
+	resp.Body.Close()
+
+	resp, err = p.do(ctx, "MOVE", tmpPath, nil, map[string]string{
+		"Destination": p.url(remotePath).String(),
+		"Overwrite":   "T",
+	})
+	if err != nil {
+		p.Delete(context.WithoutCancel(ctx), tmpPath)
+		return fmt.Errorf("failed to move uploaded file into place: %w", err)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (p *WebDAVProvider) Download(ctx context.Context, localPath, remotePath string) error {
+	resp, err := p.do(ctx, http.MethodGet, storage.CleanPath(remotePath), nil, nil)
+	if err != nil {
+		return fmt.Errorf("failed to download file: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if err := os.MkdirAll(filepath.Dir(localPath), 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	outFile, err := os.Create(localPath)
+	if err != nil {
+		return fmt.Errorf("failed to create local file: %w", err)
+	}
+	defer outFile.Close()
+
+	if _, err := io.Copy(outFile, resp.Body); err != nil {
+		return fmt.Errorf("failed to save downloaded file: %w", err)
+	}
+	return nil
+}
+
+func (p *WebDAVProvider) Delete(ctx context.Context, remotePath string) error {
+	resp, err := p.do(ctx, http.MethodDelete, storage.CleanPath(remotePath), nil, nil)
+	if err != nil {
+		return fmt.Errorf("failed to delete file: %w", err)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+type multistatus struct {
+	Responses []propfindResponse `xml:"response"`
+}
+
+type propfindResponse struct {
+	Href     string `xml:"href"`
+	Propstat []struct {
+		Prop struct {
+			ResourceType struct {
+				Collection *struct{} `xml:"collection"`
+			} `xml:"resourcetype"`
+			ContentLength int64  `xml:"getcontentlength"`
+			LastModified  string `xml:"getlastmodified"`
+			ETag          string `xml:"getetag"`
+		} `xml:"prop"`
+		Status string `xml:"status"`
+	} `xml:"propstat"`
+}
+
+// object converts the properties of a PROPFIND response to a RemoteObject
+// at remotePath.
+func (r propfindResponse) object(remotePath string) storage.RemoteObject {
+	object := storage.RemoteObject{Path: remotePath}
+	for _, propstat := range r.Propstat {
+		if !strings.Contains(propstat.Status, " 200 ") {
+			continue
+		}
+		prop := propstat.Prop
+		object.IsDir = prop.ResourceType.Collection != nil
+		object.Size = prop.ContentLength
+		if modTime, err := http.ParseTime(prop.LastModified); err == nil {
+			object.ModTime = modTime
+		}
+		if prop.ETag != "" {
+			object.Metadata = map[string]string{"etag": strings.Trim(prop.ETag, "\"")}
+		}
+	}
+	return object
+}
+
+func (p *WebDAVProvider) Stat(ctx context.Context, remotePath string) (storage.RemoteObject, error) {
+	remotePath = storage.CleanPath(remotePath)
+	result, err := p.propfind(ctx, remotePath, "0")
+	if err != nil {
+		return storage.RemoteObject{}, fmt.Errorf("failed to stat file: %w", err)
+	}
+	if len(result.Responses) == 0 {
+		return storage.RemoteObject{}, fmt.Errorf("failed to stat file: %w: %s", storage.ErrNotFound, remotePath)
+	}
+	return result.Responses[0].object(remotePath), nil
+}
+
+// ListFiles walks the collection tree one PROPFIND at a time, since many
+// servers, Nextcloud included, refuse "Depth: infinity".
+func (p *WebDAVProvider) ListFiles(ctx context.Context, remotePath string) ([]storage.RemoteObject, error) {
+	var objects []storage.RemoteObject
+	pending := []string{storage.CleanPath(remotePath)}
+
+	for len(pending) > 0 {
+		folder := pending[0]
+		pending = pending[1:]
+
+		children, err := p.listFolder(ctx, folder)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list files: %w", err)
+		}
+		for _, child := range children {
+			if child.IsDir {
+				pending = append(pending, child.Path)
+			}
+		}
+		objects = append(objects, children...)
+	}
+	return objects, nil
+}
+
+func (p *WebDAVProvider) listFolder(ctx context.Context, folder string) ([]storage.RemoteObject, error) {
+	result, err := p.propfind(ctx, folder, "1")
+	if err != nil {
+		return nil, err
+	}
+
+	folderURL := strings.TrimSuffix(p.url(folder).Path, "/")
+	var objects []storage.RemoteObject
+	for _, entry := range result.Responses {
+		href, err := url.Parse(entry.Href)
+		if err != nil {
+			continue
+		}
+		entryPath := strings.TrimSuffix(href.Path, "/")
+		// Depth 1 includes the collection itself.
+		if entryPath == folderURL {
+			continue
+		}
+		object := entry.object(path.Join(folder, path.Base(entryPath)))
+		// Uploads in progress, or left behind by a failed cleanup, are not
+		// backups yet.
+		if !object.IsDir && storage.IsTempName(object.Name()) {
+			continue
+		}
+		objects = append(objects, object)
+	}
+	return objects, nil
+}
+
+func (p *WebDAVProvider) propfind(ctx context.Context, remotePath, depth string) (*multistatus, error) {
+	resp, err := p.do(ctx, "PROPFIND", remotePath, strings.NewReader(propfindBody), map[string]string{
+		"Depth":        depth,
+		"Content-Type": "application/xml",
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result multistatus
+	if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode listing: %w", err)
+	}
+	return &result, nil
+}
+
+// getOrCreateFolder creates every missing collection along folder with
+// MKCOL, the way the Drive provider creates its folder chain.
+func (p *WebDAVProvider) getOrCreateFolder(ctx context.Context, folder string) error {
+	current := ""
+	for _, part := range strings.Split(folder, "/") {
+		if part == "" || part == "." {
+			continue
+		}
+		current = path.Join(current, part)
+
+		req, err := p.newRequest(ctx, "MKCOL", current, nil, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := p.client.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+
+		// 405 Method Not Allowed means the collection already exists.
+		if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusMethodNotAllowed {
+			return fmt.Errorf("MKCOL %s: unexpected status %s", current, resp.Status)
+		}
+	}
+	return nil
+}
+
+func (p *WebDAVProvider) url(remotePath string) *url.URL {
+	u := *p.baseURL
+	if remotePath != "." && remotePath != "" {
+		u.Path = u.Path + "/" + remotePath
+	} else {
+		u.Path = u.Path + "/"
+	}
+	u.RawPath = ""
+	return &u
+}
+
+func (p *WebDAVProvider) newRequest(ctx context.Context, method, remotePath string, body io.Reader, headers map[string]string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, p.url(remotePath).String(), body)
+	if err != nil {
+		return nil, err
+	}
+	if p.user != "" {
+		req.SetBasicAuth(p.user, p.password)
+	}
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	return req, nil
+}
+
+func (p *WebDAVProvider) do(ctx context.Context, method, remotePath string, body io.Reader, headers map[string]string) (*http.Response, error) {
+	req, err := p.newRequest(ctx, method, remotePath, body, headers)
+	if err != nil {
+		return nil, err
+	}
+	return p.send(req)
+}
+
+// send performs req and turns error statuses into Go errors. The caller must
+// close the body of the returned response.
+func (p *WebDAVProvider) send(req *http.Request) (*http.Response, error) {
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s %s: %w", req.Method, req.URL.Path, storage.ErrNotFound)
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s %s: unexpected status %s", req.Method, req.URL.Path, resp.Status)
+	}
+	return resp, nil
+}
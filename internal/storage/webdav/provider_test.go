@@ -0,0 +1,167 @@
+package webdav
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/amankumarsingh77/automated_backup_tool/internal/storage"
+	"golang.org/x/net/webdav"
+)
+
+func newTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	server, _ := newFailingServer(t, "")
+	return server
+}
+
+// newFailingServer is newTestServer answering requests with the given
+// method with an error, like a server running out of space. The body of a
+// failed PUT is stored nonetheless. It also returns the file system the
+// server stores files in.
+func newFailingServer(t *testing.T, failMethod string) (*httptest.Server, webdav.FileSystem) {
+	t.Helper()
+
+	fs := webdav.NewMemFS()
+	handler := &webdav.Handler{
+		Prefix:     "/remote.php/dav/files/backup",
+		FileSystem: fs,
+		LockSystem: webdav.NewMemLS(),
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, password, ok := r.BasicAuth()
+		if !ok || user != "backup" || password != "app-password" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.Method == failMethod {
+			if r.Method == http.MethodPut {
+				handler.ServeHTTP(httptest.NewRecorder(), r)
+			}
+			w.WriteHeader(http.StatusInsufficientStorage)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+	return server, fs
+}
+
+func TestWebDAVProvider(t *testing.T) {
+	ctx := context.Background()
+	server := newTestServer(t)
+
+	p, err := NewWebDAVProvider(server.URL+"/remote.php/dav/files/backup/", "backup", "app-password")
+	if err != nil {
+		t.Fatalf("Failed to create provider: %v", err)
+	}
+	if err := p.Authenticate(ctx); err != nil {
+		t.Fatalf("Failed to authenticate: %v", err)
+	}
+
+	work := t.TempDir()
+	source := filepath.Join(work, "archive.gz")
+	content := []byte("nextcloud archive")
+	if err := os.WriteFile(source, content, 0600); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	if err := p.Upload(ctx, source, "/Backups/host a/archive.gz"); err != nil {
+		t.Fatalf("Failed to upload file: %v", err)
+	}
+	if err := p.Upload(ctx, source, "/Backups/host a/archive-2.gz"); err != nil {
+		t.Fatalf("Failed to upload second file: %v", err)
+	}
+	// A temporary file left by an interrupted upload is not listed.
+	resp, err := p.do(ctx, http.MethodPut, "Backups/host a/.archive.gz.123456.tmp", strings.NewReader("part"), nil)
+	if err != nil {
+		t.Fatalf("Failed to create temporary file: %v", err)
+	}
+	resp.Body.Close()
+
+	files, err := p.ListFiles(ctx, "/")
+	if err != nil {
+		t.Fatalf("Failed to list files: %v", err)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	if len(files) != 4 || !files[0].IsDir || !files[1].IsDir ||
+		files[2].Path != "Backups/host a/archive-2.gz" || files[3].Path != "Backups/host a/archive.gz" {
+		t.Fatalf("Unexpected listing, temporary files left behind? %+v", files)
+	}
+	if files[3].Size != int64(len(content)) || files[3].ModTime.IsZero() {
+		t.Errorf("Listing is missing size or modification time: %+v", files[3])
+	}
+
+	object, err := p.Stat(ctx, "Backups/host a/archive.gz")
+	if err != nil {
+		t.Fatalf("Failed to stat file: %v", err)
+	}
+	if object.Path != "Backups/host a/archive.gz" || object.Size != int64(len(content)) || object.IsDir {
+		t.Errorf("Unexpected stat result: %+v", object)
+	}
+
+	restored := filepath.Join(work, "restored.gz")
+	if err := p.Download(ctx, restored, "Backups/host a/archive.gz"); err != nil {
+		t.Fatalf("Failed to download file: %v", err)
+	}
+	if data, _ := os.ReadFile(restored); string(data) != string(content) {
+		t.Error("Downloaded content does not match uploaded content")
+	}
+
+	if err := p.Delete(ctx, "Backups/host a/archive.gz"); err != nil {
+		t.Fatalf("Failed to delete file: %v", err)
+	}
+	if err := p.Download(ctx, restored, "Backups/host a/archive.gz"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound when downloading a deleted file, got %v", err)
+	}
+}
+
+func TestWebDAVProviderWrongPassword(t *testing.T) {
+	server := newTestServer(t)
+
+	p, err := NewWebDAVProvider(server.URL+"/remote.php/dav/files/backup", "backup", "wrong")
+	if err != nil {
+		t.Fatalf("Failed to create provider: %v", err)
+	}
+	if err := p.Authenticate(context.Background()); err == nil {
+		t.Error("Expected authentication to fail with a wrong password")
+	}
+}
+
+func TestWebDAVProviderRemovesTemporaryFileOnFailure(t *testing.T) {
+	ctx := context.Background()
+	source := filepath.Join(t.TempDir(), "archive.gz")
+	if err := os.WriteFile(source, []byte("nextcloud archive"), 0600); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	for _, method := range []string{http.MethodPut, "MOVE"} {
+		server, fs := newFailingServer(t, method)
+		p, err := NewWebDAVProvider(server.URL+"/remote.php/dav/files/backup/", "backup", "app-password")
+		if err != nil {
+			t.Fatalf("Failed to create provider: %v", err)
+		}
+		if err := p.Upload(ctx, source, "Backups/archive.gz"); err == nil {
+			t.Fatalf("Expected the upload to fail when %s fails", method)
+		}
+
+		folder, err := fs.OpenFile(ctx, "/Backups", os.O_RDONLY, 0)
+		if err != nil {
+			t.Fatalf("Failed to open the backup folder: %v", err)
+		}
+		entries, err := folder.Readdir(-1)
+		folder.Close()
+		if err != nil {
+			t.Fatalf("Failed to read the backup folder: %v", err)
+		}
+		for _, entry := range entries {
+			t.Errorf("Expected nothing left on the server after a failed %s, found %s", method, entry.Name())
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package filesystem
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// AppDataDir returns the directory holding the tool's private state, such
+// as the encrypted credentials and pending upload sessions, creating it if
+// necessary.
+func AppDataDir() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+
+	dir := filepath.Join(homeDir, ".backup")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create app data directory: %w", err)
+	}
+	return dir, nil
+}
+
+var tempDir string
+
+// SetTempDir sets where intermediate files such as archives are written.
+// An empty dir selects the system temporary directory.
+func SetTempDir(dir string) {
+	tempDir = dir
+}
+
+// TempDir returns the directory for intermediate files.
+func TempDir() string {
+	if tempDir != "" {
+		return tempDir
+	}
+	return os.TempDir()
+}
@@ -3,6 +3,7 @@ package filesystem
 import (
 	"archive/tar"
 	"compress/gzip"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -10,11 +11,25 @@ import (
 )
 
 func CompressFile(folderPath string) (string, error) {
-	compressedFile, err := os.Create(filepath.Base(folderPath) + ".gz")
+	return compress(folderPath, nil)
+}
+
+// CompressFiles archives like CompressFile, but only the entries of
+// folderPath whose slash separated relative path is in files.
+func CompressFiles(folderPath string, files map[string]bool) (string, error) {
+	return compress(folderPath, files)
+}
+
+func compress(folderPath string, files map[string]bool) (string, error) {
+	// Every archive gets its own name, so tasks archiving folders of the
+	// same name, or overlapping runs of one task, do not write to the same
+	// file.
+	compressedFile, err := os.CreateTemp(TempDir(), filepath.Base(folderPath)+"-*.gz")
 	if err != nil {
 		return "", fmt.Errorf("could not create a compressed file : %v", err.Error())
 	}
 	defer compressedFile.Close()
+	archivePath := compressedFile.Name()
 
 	gzipWriter := gzip.NewWriter(compressedFile)
 	defer gzipWriter.Close()
@@ -29,16 +44,29 @@ func CompressFile(folderPath string) (string, error) {
 		if path == folderPath {
 			return nil
 		}
-		file, err := os.Open(path)
+		relpath, err := filepath.Rel(folderPath, path)
 		if err != nil {
 			return err
 		}
-		defer file.Close()
+		relpath = filepath.ToSlash(relpath)
+		if files != nil && !files[relpath] {
+			return nil
+		}
 
-		relpath, err := filepath.Rel(folderPath, path)
+		if info.IsDir() {
+			return tarWriter.WriteHeader(&tar.Header{
+				Name:     relpath + "/",
+				Mode:     int64(info.Mode().Perm()),
+				ModTime:  info.ModTime(),
+				Typeflag: tar.TypeDir,
+			})
+		}
+
+		file, err := os.Open(path)
 		if err != nil {
 			return err
 		}
+		defer file.Close()
 
 		header := &tar.Header{
 			Name: relpath,
@@ -58,7 +86,68 @@ func CompressFile(folderPath string) (string, error) {
 		return nil
 	})
 	if err != nil {
+		os.Remove(archivePath)
 		return "", fmt.Errorf("could not compress file : %v", err.Error())
 	}
-	return filepath.Base(folderPath) + ".gz", nil
+	return archivePath, nil
+}
+
+// ExtractArchive unpacks an archive written by CompressFile into target.
+// Existing files are overwritten.
+func ExtractArchive(archivePath, target string) error {
+	file, err := os.Open(archivePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	gzipReader, err := gzip.NewReader(file)
+	if err != nil {
+		return fmt.Errorf("could not read archive: %w", err)
+	}
+	defer gzipReader.Close()
+
+	tarReader := tar.NewReader(gzipReader)
+	for {
+		header, err := tarReader.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("could not read archive: %w", err)
+		}
+		name := filepath.FromSlash(header.Name)
+		if !filepath.IsLocal(name) {
+			return fmt.Errorf("archive holds an invalid path %q", header.Name)
+		}
+		name = filepath.Join(target, name)
+		perm := os.FileMode(header.Mode).Perm()
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(name, 0755); err != nil {
+				return err
+			}
+			if err := os.Chmod(name, perm); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+				return err
+			}
+			out, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(out, tarReader)
+			if closeErr := out.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				return fmt.Errorf("could not extract %s: %w", header.Name, err)
+			}
+			if err := os.Chmod(name, perm); err != nil {
+				return err
+			}
+		}
+	}
 }
@@ -0,0 +1,87 @@
+package filesystem
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCompressFilesAndExtract(t *testing.T) {
+	SetTempDir(t.TempDir())
+	defer SetTempDir("")
+
+	source := filepath.Join(t.TempDir(), "source")
+	files := map[string]string{
+		"a.txt":        "alpha",
+		"docs/b.txt":   "beta",
+		"docs/c/d.txt": "delta",
+	}
+	for name, content := range files {
+		name = filepath.Join(source, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, []byte(content), 0640); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	archive, err := CompressFiles(source, map[string]bool{"docs/b.txt": true, "docs/c/d.txt": true})
+	if err != nil {
+		t.Fatalf("Failed to compress: %v", err)
+	}
+	target := t.TempDir()
+	if err := ExtractArchive(archive, target); err != nil {
+		t.Fatalf("Failed to extract: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(target, "a.txt")); !os.IsNotExist(err) {
+		t.Errorf("Expected a.txt to be left out of the archive, got %v", err)
+	}
+	for _, name := range []string{"docs/b.txt", "docs/c/d.txt"} {
+		data, err := os.ReadFile(filepath.Join(target, filepath.FromSlash(name)))
+		if err != nil {
+			t.Fatalf("Failed to read extracted %s: %v", name, err)
+		}
+		if string(data) != files[name] {
+			t.Errorf("Expected %s to hold %q, got %q", name, files[name], data)
+		}
+		info, err := os.Stat(filepath.Join(target, filepath.FromSlash(name)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != 0640 {
+			t.Errorf("Expected %s to keep mode 0640, got %v", name, info.Mode().Perm())
+		}
+	}
+}
+
+func TestCompressFileUsesUniqueNames(t *testing.T) {
+	SetTempDir(t.TempDir())
+	defer SetTempDir("")
+
+	source := filepath.Join(t.TempDir(), "source")
+	if err := os.MkdirAll(source, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(source, "a.txt"), []byte("alpha"), 0640); err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := CompressFile(source)
+	if err != nil {
+		t.Fatalf("Failed to compress: %v", err)
+	}
+	second, err := CompressFile(source)
+	if err != nil {
+		t.Fatalf("Failed to compress again: %v", err)
+	}
+	if first == second {
+		t.Fatalf("Expected two archives, both were written to %s", first)
+	}
+	for _, archive := range []string{first, second} {
+		if err := ExtractArchive(archive, t.TempDir()); err != nil {
+			t.Errorf("Failed to extract %s: %v", archive, err)
+		}
+	}
+}
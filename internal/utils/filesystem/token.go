@@ -4,36 +4,20 @@ import (
 	"encoding/json"
 	"fmt"
 	"golang.org/x/oauth2"
-	"log"
 	"os"
 	"path/filepath"
 )
 
-func SaveTokenLocally(provider string, token *oauth2.Token) error {
+// legacyTokenFile is where releases before the encrypted token store kept
+// the plaintext token of a provider, relative to the working directory.
+func legacyTokenFile(provider string) string {
 	dir, _ := os.Getwd()
-	tokenFile := filepath.Join(dir, os.Getenv("APP_NAME"), provider+"-token.json")
-	log.Println("Saving token to ", tokenFile)
-	dir = filepath.Dir(tokenFile)
-	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
-		return err
-	}
-	file, err := os.Create(tokenFile)
-	if err != nil {
-		return fmt.Errorf("Error occured while saving token: %v\n", err.Error())
-	}
-	log.Println(file.Name())
-	defer file.Close()
-	if err := json.NewEncoder(file).Encode(token); err != nil {
-		return fmt.Errorf("Error occured while saving token: %v\n", err.Error())
-	}
-	fmt.Println("Token saved locally!")
-	return nil
+	return filepath.Join(dir, os.Getenv("APP_NAME"), provider+"-token.json")
 }
 
+// GetToken reads a plaintext token file left behind by an older release.
 func GetToken(provider string) (*oauth2.Token, error) {
-	dir, _ := os.Getwd()
-	tokenFile := filepath.Join(dir, os.Getenv("APP_NAME"), provider+"-token.json")
-	jsonFile, err := os.Open(tokenFile)
+	jsonFile, err := os.Open(legacyTokenFile(provider))
 	if err != nil {
 		return nil, fmt.Errorf("Error occured while opening token file: %v\n", err.Error())
 	}
@@ -45,3 +29,9 @@ func GetToken(provider string) (*oauth2.Token, error) {
 	}
 	return token, nil
 }
+
+// RemoveToken deletes a plaintext token file once its token is stored
+// elsewhere.
+func RemoveToken(provider string) error {
+	return os.Remove(legacyTokenFile(provider))
+}
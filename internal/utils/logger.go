@@ -38,8 +38,17 @@ type Logger struct {
 var (
 	defaultLogger *Logger
 	once         sync.Once
+	logsDir      = "logs"
 )
 
+// SetLogDir sets the directory the default logger writes to. It has no
+// effect once the logger has been created.
+func SetLogDir(dir string) {
+	if dir != "" {
+		logsDir = dir
+	}
+}
+
 func GetLogger() *Logger {
 	once.Do(func() {
 		var err error
@@ -52,8 +61,6 @@ func GetLogger() *Logger {
 }
 
 func NewLogger(filename string, minLevel LogLevel) (*Logger, error) {
-	
-	logsDir := "logs"
 	if err := os.MkdirAll(logsDir, 0755); err != nil {
 		return nil, fmt.Errorf("failed to create logs directory: %v", err)
 	}
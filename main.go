@@ -1,33 +1,66 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
 	"syscall"
-	"time"
 
 	"os/signal"
 
+	"github.com/amankumarsingh77/automated_backup_tool/internal/config"
 	"github.com/amankumarsingh77/automated_backup_tool/internal/core/backup"
+	"github.com/amankumarsingh77/automated_backup_tool/internal/core/snapshot"
 	"github.com/amankumarsingh77/automated_backup_tool/internal/security/credentials"
-	"github.com/google/uuid"
+	"github.com/amankumarsingh77/automated_backup_tool/internal/security/secret"
+	"github.com/amankumarsingh77/automated_backup_tool/internal/storage"
+	_ "github.com/amankumarsingh77/automated_backup_tool/internal/storage/gdrive"
+	_ "github.com/amankumarsingh77/automated_backup_tool/internal/storage/local"
+	_ "github.com/amankumarsingh77/automated_backup_tool/internal/storage/onedrive"
+	_ "github.com/amankumarsingh77/automated_backup_tool/internal/storage/s3"
+	_ "github.com/amankumarsingh77/automated_backup_tool/internal/storage/sftp"
+	_ "github.com/amankumarsingh77/automated_backup_tool/internal/storage/webdav"
 )
 
-var masterPassword string
+var (
+	masterPassword       string
+	masterPasswordSource string
+	configFile           string
+)
+
+// masterPasswordEnv holds the master password when no source is given.
+const masterPasswordEnv = "BACKUP_MASTER_PASSWORD"
 
 func init() {
-	flag.StringVar(&masterPassword, "master-password", "", "Master password for credential encryption")
+	flag.StringVar(&masterPassword, "master-password", "", "Master password for credential encryption (visible in ps, prefer -master-password-source)")
+	flag.StringVar(&masterPasswordSource, "master-password-source", "", "Where to read the master password: env:NAME, file:PATH, fd:N, cmd:COMMAND or prompt")
+	flag.StringVar(&configFile, "config", config.DefaultFile(), fmt.Sprintf("YAML config file declaring remotes, tasks and settings (default: $%s)", config.EnvConfigFile))
 }
 
 func main() {
 	flag.Parse()
 	args := flag.Args()
 
-	if masterPassword == "" {
-		log.Fatal("Master password is required. Use -master-password flag")
+	if len(args) < 1 {
+		printUsage()
+		os.Exit(1)
+	}
+
+	// validate needs neither the master password nor the task manager, so
+	// it can run in CI against a checked in config file.
+	cfg := loadConfig(args[0] == "validate" || args[0] == "apply")
+	if args[0] == "validate" {
+		handleValidate(cfg)
+		return
+	}
+
+	if err := resolveMasterPassword(); err != nil {
+		log.Fatal(err)
 	}
 
 	if err := backup.GlobalTaskManager.Initialize(masterPassword); err != nil {
@@ -37,79 +70,214 @@ func main() {
 	createCmd := flag.NewFlagSet("create", flag.ExitOnError)
 	listCmd := flag.NewFlagSet("list", flag.ExitOnError)
 	configureCmd := flag.NewFlagSet("configure", flag.ExitOnError)
+	changePasswordCmd := flag.NewFlagSet("change-master-password", flag.ExitOnError)
+
+	providers := strings.Join(storage.Providers(), ", ")
 
 	sourcePath := createCmd.String("source", "", "Source path to backup")
-	provider := createCmd.String("provider", "gdrive", "Cloud provider (gdrive or onedrive)")
+	provider := createCmd.String("provider", "gdrive", fmt.Sprintf("Storage provider (%s)", providers))
+	remote := createCmd.String("remote", "", "Configured remote to back up to; its provider is used")
 	destPath := createCmd.String("dest", "", "Destination path in cloud storage")
+	repository := createCmd.Bool("repository", false, "Store runs deduplicated in a repository at -dest instead of uploading an archive")
+	mode := createCmd.String("mode", "full", "Backup mode: full, incremental (files changed since the last run) or differential (files changed since the last full backup)")
+	fullEvery := createCmd.Int("full-every", 0, "Make a full backup every N runs of an incremental or differential task (default: only the first)")
+	nameTemplate := createCmd.String("name-template", "", "Name of each run's archive below -dest, e.g. {task}/{date}-{host}.tar.gz (default: the archive name, replaced by every run)")
+	keepLast := createCmd.Int("keep-last", 0, "Keep the latest N snapshots")
+	keepHourly := createCmd.Int("keep-hourly", 0, "Keep the latest snapshot of each of the last N hours")
+	keepDaily := createCmd.Int("keep-daily", 0, "Keep the latest snapshot of each of the last N days")
+	keepWeekly := createCmd.Int("keep-weekly", 0, "Keep the latest snapshot of each of the last N weeks")
+	keepMonthly := createCmd.Int("keep-monthly", 0, "Keep the latest snapshot of each of the last N months")
+	keepYearly := createCmd.Int("keep-yearly", 0, "Keep the latest snapshot of each of the last N years")
+	keepWithin := createCmd.String("keep-within", "", "Keep every snapshot younger than the duration, e.g. 30d")
 	schedule := createCmd.String("schedule", "", "Backup schedule in cron format (optional)")
 	recurring := createCmd.Bool("recurring", false, "Whether the backup should recur")
 	compress := createCmd.Bool("compress", false, "Whether to compress the backup")
 	encrypt := createCmd.Bool("encrypt", false, "Whether to encrypt the backup")
-	encryptKey := createCmd.String("key", "", "Encryption key (required if encrypt is true)")
+	encryptKey := createCmd.String("key", "", "Encryption key (stored in the task file, prefer -key-source)")
+	keySource := createCmd.String("key-source", "", "Where to read the encryption key on every run: env:NAME, file:PATH or cmd:COMMAND")
 	isSingle := createCmd.Bool("single", false, "Whether to backup single file")
 	isSync := createCmd.Bool("sync", false, "Whether to enable folder synchronization")
+	from := createCmd.String("from", "", "Cloud remote to back up from; -source is then a folder on it")
+	mirrorPath := createCmd.String("mirror", "", "Local folder to keep the copy of a -from folder in")
+	keepDeleted := createCmd.String("keep-deleted", "", "How long the copy keeps files deleted in the cloud, e.g. 90d (default: 30d, 0 keeps them forever)")
 
-	configProvider := configureCmd.String("provider", "gdrive", "Provider to configure (gdrive or onedrive)")
+	configProvider := configureCmd.String("provider", "gdrive", fmt.Sprintf("Provider to configure (%s)", providers))
+	remoteName := configureCmd.String("name", "", "Name of the remote, to configure several accounts of a provider (default: the provider)")
 	clientID := configureCmd.String("client-id", "", "OAuth client ID")
 	clientSecret := configureCmd.String("client-secret", "", "OAuth client secret")
-	redirectURL := configureCmd.String("redirect-url", "http://localhost:8080/callback", "OAuth redirect URL")
-
-	if len(args) < 1 {
-		printUsage()
-		os.Exit(1)
-	}
+	redirectURL := configureCmd.String("redirect-url", "http://localhost:8080/callback", "OAuth redirect URL; browser login listens on its port")
+	tenant := configureCmd.String("tenant", "", "Microsoft tenant for onedrive (default: common)")
+	root := configureCmd.String("root", "", "Root directory for the local and sftp providers")
+	accessKey := configureCmd.String("access-key", "", "S3 access key ID")
+	secretKey := configureCmd.String("secret-key", "", "S3 secret access key")
+	endpoint := configureCmd.String("endpoint", "", "S3 endpoint URL (default: AWS for the region)")
+	region := configureCmd.String("region", "", "S3 region (default: us-east-1)")
+	bucket := configureCmd.String("bucket", "", "S3 bucket")
+	prefix := configureCmd.String("prefix", "", "S3 key prefix for all backups")
+	partSize := configureCmd.String("part-size", "", "S3 multipart part size in MB (default: 16)")
+	login := configureCmd.String("login", "", "OAuth login mode for gdrive and onedrive: browser, device or manual (default: browser)")
+	chunkSize := configureCmd.String("chunk-size", "", "Google Drive resumable upload chunk size in MB (default: 8)")
+	exportFormat := configureCmd.String("export-format", "", "Format Google Docs, Sheets and Slides are backed up in: office or pdf (default: office)")
+	sharedDrive := configureCmd.String("shared-drive", "", "Name or ID of the Google Shared Drive to store backups in (default: My Drive)")
+	host := configureCmd.String("host", "", "SFTP host")
+	port := configureCmd.String("port", "", "SFTP port (default: 22)")
+	user := configureCmd.String("user", "", "SFTP or WebDAV user")
+	password := configureCmd.String("password", "", "SFTP or WebDAV password, or SFTP private key passphrase")
+	keyFile := configureCmd.String("key-file", "", "SFTP private key file, stored encrypted with the credentials")
+	knownHosts := configureCmd.String("known-hosts", "", "SFTP known_hosts file (default: ~/.ssh/known_hosts)")
+	davURL := configureCmd.String("url", "", "WebDAV URL, e.g. https://cloud.example.com/remote.php/dav/files/<user>/")
+
+	newPassword := changePasswordCmd.String("new-password", "", "New master password (visible in ps, prefer -new-password-source)")
+	newPasswordSource := changePasswordCmd.String("new-password-source", "", "Where to read the new master password: env:NAME, file:PATH, fd:N, cmd:COMMAND or prompt")
 
 	switch args[0] {
 	case "create":
 		createCmd.Parse(args[1:])
-		handleCreate(*sourcePath, *provider, *destPath, *schedule, *recurring, *compress, *encrypt, *encryptKey, *isSingle, *isSync)
+		providerSet := false
+		createCmd.Visit(func(f *flag.Flag) { providerSet = providerSet || f.Name == "provider" })
+		if (*remote != "" || *from != "") && !providerSet {
+			*provider = ""
+		}
+		handleCreate(&backup.BackupTask{
+			SourcePath:          *sourcePath,
+			Provider:            *provider,
+			Remote:              *remote,
+			DestinationPath:     *destPath,
+			NameTemplate:        *nameTemplate,
+			Repository:          *repository,
+			Mode:                *mode,
+			FullEvery:           *fullEvery,
+			Schedule:            *schedule,
+			Recurring:           *recurring,
+			Compress:            *compress,
+			Encrypt:             *encrypt,
+			EncryptionKey:       *encryptKey,
+			EncryptionKeySource: *keySource,
+			IsSingle:            *isSingle,
+			IsSync:              *isSync,
+			SourceRemote:        *from,
+			MirrorPath:          *mirrorPath,
+			KeepDeleted:         *keepDeleted,
+			Retention: &backup.RetentionPolicy{
+				KeepLast:    *keepLast,
+				KeepHourly:  *keepHourly,
+				KeepDaily:   *keepDaily,
+				KeepWeekly:  *keepWeekly,
+				KeepMonthly: *keepMonthly,
+				KeepYearly:  *keepYearly,
+				KeepWithin:  *keepWithin,
+			},
+		})
 	case "list":
 		listCmd.Parse(args[1:])
 		handleList()
 	case "configure":
 		configureCmd.Parse(args[1:])
-		handleConfigure(*configProvider, *clientID, *clientSecret, *redirectURL)
+		if *accessKey != "" {
+			*clientID = *accessKey
+		}
+		if *secretKey != "" {
+			*clientSecret = *secretKey
+		}
+		if *user != "" {
+			*clientID = *user
+		}
+		if *password != "" {
+			*clientSecret = *password
+		}
+		privateKey := ""
+		if *keyFile != "" {
+			data, err := os.ReadFile(*keyFile)
+			if err != nil {
+				log.Fatalf("Failed to read private key: %v", err)
+			}
+			privateKey = string(data)
+		}
+		handleConfigure(credentials.Credential{
+			Name:        *remoteName,
+			Provider:    *configProvider,
+			Key:         *clientID,
+			Secret:      *clientSecret,
+			RedirectURL: *redirectURL,
+			Options: configureOptions(map[string]string{
+				"root":          *root,
+				"endpoint":      *endpoint,
+				"region":        *region,
+				"bucket":        *bucket,
+				"prefix":        *prefix,
+				"part_size":     *partSize,
+				"chunk_size":    *chunkSize,
+				"export_format": *exportFormat,
+				"shared_drive":  *sharedDrive,
+				"login":         *login,
+				"tenant":        *tenant,
+				"host":          *host,
+				"port":          *port,
+				"private_key":   privateKey,
+				"known_hosts":   *knownHosts,
+				"url":           *davURL,
+			}),
+		})
+	case "apply":
+		handleApply(cfg, args[1:])
+	case "credentials":
+		handleCredentials(args[1:])
+	case "snapshots":
+		handleSnapshots(args[1:])
+	case "prune":
+		handlePrune(args[1:])
+	case "change-master-password":
+		changePasswordCmd.Parse(args[1:])
+		handleChangeMasterPassword(*newPassword, *newPasswordSource)
 	default:
 		printUsage()
 		os.Exit(1)
 	}
 }
 
-func handleCreate(sourcePath, provider, destPath, schedule string, recurring, compress, encrypt bool, encryptKey string, isSingle, isSync bool) {
-	if sourcePath == "" || destPath == "" {
-		log.Fatal("Source path and destination path are required")
+// handleCreate creates the task given by the create flags and runs or
+// schedules it. The task is validated by Create; only what needs the
+// credential store or the working directory is resolved here.
+func handleCreate(task *backup.BackupTask) {
+	credManager, err := credentials.NewCredentialManager(masterPassword)
+	if err != nil {
+		log.Fatalf("Failed to initialize credential manager: %v", err)
 	}
 
-	absPath, err := filepath.Abs(sourcePath)
-	if err != nil {
-		log.Fatalf("Error getting absolute path: %v", err)
+	if task.SourceRemote != "" {
+		if _, err := credManager.GetCredential(task.SourceRemote); err != nil {
+			log.Fatalf("Remote %s is not configured: %v", task.SourceRemote, err)
+		}
+		if task.MirrorPath != "" {
+			if task.MirrorPath, err = filepath.Abs(task.MirrorPath); err != nil {
+				log.Fatalf("Error getting absolute path: %v", err)
+			}
+		}
 	}
 
-	task := &backup.BackupTask{
-		ID:              uuid.New().String(),
-		SourcePath:      absPath,
-		Provider:        provider,
-		DestinationPath: destPath,
-		Schedule:        schedule,
-		Recurring:       recurring,
-		Compress:        compress,
-		Encrypt:         encrypt,
-		EncryptionKey:   encryptKey,
-		CreatedAt:       time.Now(),
-		Status:          backup.StatusPending,
-		IsSingle:        isSingle,
-		IsSync:          isSync,
+	if task.Remote != "" {
+		cred, err := credManager.GetCredential(task.Remote)
+		if err != nil {
+			log.Fatalf("Remote %s is not configured: %v", task.Remote, err)
+		}
+		if task.Provider != "" && task.Provider != cred.Provider {
+			log.Fatalf("Remote %s uses provider %s, not %s", task.Remote, cred.Provider, task.Provider)
+		}
+		task.Provider = cred.Provider
 	}
 
-	if encrypt && encryptKey == "" {
-		log.Fatal("Encryption key is required when encryption is enabled")
+	// The source of a cloud backup is a folder on the remote.
+	if task.SourcePath != "" && task.SourceRemote == "" {
+		if task.SourcePath, err = filepath.Abs(task.SourcePath); err != nil {
+			log.Fatalf("Error getting absolute path: %v", err)
+		}
 	}
 
 	if _, err := task.Create(); err != nil {
 		log.Fatalf("Failed to create task: %v", err)
 	}
 
-	if schedule != "" {
+	if task.Schedule != "" {
 		if err := task.ScheduleTask(); err != nil {
 			log.Fatalf("Failed to schedule task: %v", err)
 		}
@@ -124,7 +292,7 @@ func handleCreate(sourcePath, provider, destPath, schedule string, recurring, co
 	fmt.Printf("Task started with ID: %s\n", task.ID)
 
 	// If this is a sync task, keep the program running
-	if isSync {
+	if task.IsSync {
 		fmt.Println("Folder sync is active. Press Ctrl+C to stop...")
 
 		// Set up signal handling
@@ -160,9 +328,42 @@ func handleList() {
 	fmt.Println("-------------")
 	for _, task := range tasks {
 		fmt.Printf("ID: %s\n", task.ID)
-		fmt.Printf("Source: %s\n", task.SourcePath)
-		fmt.Printf("Provider: %s\n", task.Provider)
-		fmt.Printf("Destination: %s\n", task.DestinationPath)
+		if task.Name != "" {
+			fmt.Printf("Name: %s\n", task.Name)
+		}
+		if task.SourceRemote != "" {
+			fmt.Printf("Source: %s:%s\n", task.SourceRemote, task.SourcePath)
+		} else {
+			fmt.Printf("Source: %s\n", task.SourcePath)
+		}
+		if task.MirrorPath != "" {
+			fmt.Printf("Mirror: %s\n", task.MirrorPath)
+		}
+		if task.Provider != "" {
+			fmt.Printf("Provider: %s\n", task.Provider)
+		}
+		if task.Remote != "" {
+			fmt.Printf("Remote: %s\n", task.Remote)
+		}
+		if task.DestinationPath != "" {
+			fmt.Printf("Destination: %s\n", task.DestinationPath)
+		}
+		if task.NameTemplate != "" {
+			fmt.Printf("Name template: %s\n", task.NameTemplate)
+		}
+		if task.Repository {
+			fmt.Println("Repository: yes")
+		}
+		if task.Mode != "" && task.Mode != snapshot.ModeFull {
+			fmt.Printf("Mode: %s", task.Mode)
+			if task.FullEvery > 0 {
+				fmt.Printf(", full backup every %d runs", task.FullEvery)
+			}
+			fmt.Println()
+		}
+		if !task.Retention.IsZero() {
+			fmt.Printf("Retention: %s\n", retentionSummary(task.Retention))
+		}
 		fmt.Printf("Status: %s\n", task.Status)
 		if task.Schedule != "" {
 			fmt.Printf("Schedule: %s\n", task.Schedule)
@@ -174,55 +375,262 @@ func handleList() {
 	}
 }
 
-func handleConfigure(provider, clientID, clientSecret, redirectURL string) {
-	if clientID == "" || clientSecret == "" {
-		log.Fatal("Client ID and Client Secret are required")
-	}
-
+func handleConfigure(cred credentials.Credential) {
 	credManager, err := credentials.NewCredentialManager(masterPassword)
 	if err != nil {
 		log.Fatalf("Failed to initialize credential manager: %v", err)
 	}
 
-	cred := credentials.Credential{
-		Provider:    provider,
-		Key:         clientID,
-		Secret:      clientSecret,
-		RedirectURL: redirectURL,
+	// Instantiating the provider lets it reject an incomplete configuration
+	// before anything is stored.
+	provider, err := storage.New(cred.Provider, storage.Config{
+		Name:       cred.RemoteName(),
+		Credential: &cred,
+		Tokens:     credManager.TokenStore(cred.RemoteName()),
+	})
+	if err != nil {
+		log.Fatalf("Invalid configuration for %s: %v", cred.Provider, err)
 	}
 
 	if err := credManager.StoreCredential(cred); err != nil {
 		log.Fatalf("Failed to store credentials: %v", err)
 	}
 
-	fmt.Printf("Successfully configured credentials for %s\n", provider)
-	fmt.Println("\nYou can now create backup tasks using this provider.")
+	fmt.Printf("Successfully configured credentials for %s\n", cred.RemoteName())
+
+	// Logging in now stores the OAuth token, so scheduled backups never
+	// need a human to sign in.
+	if err := provider.Authenticate(context.Background()); err != nil {
+		fmt.Printf("Warning: could not connect to %s: %v\n", cred.RemoteName(), err)
+		return
+	}
+	if closer, ok := provider.(io.Closer); ok {
+		closer.Close()
+	}
+	fmt.Println("\nYou can now create backup tasks using this remote.")
+}
+
+func handleChangeMasterPassword(newPassword, newPasswordSource string) {
+	var err error
+	switch {
+	case newPassword != "":
+	case newPasswordSource != "":
+		newPassword, err = secret.Source(newPasswordSource).Read("New master password")
+	default:
+		newPassword, err = secret.ReadPrompt("New master password")
+		if err == nil {
+			var confirm string
+			confirm, err = secret.ReadPrompt("Repeat new master password")
+			if err == nil && confirm != newPassword {
+				err = fmt.Errorf("passwords do not match")
+			}
+		}
+	}
+	if err != nil {
+		log.Fatalf("Failed to read new master password: %v", err)
+	}
+
+	credManager, err := credentials.NewCredentialManager(masterPassword)
+	if err != nil {
+		log.Fatalf("Failed to initialize credential manager: %v", err)
+	}
+	if err := credManager.ChangeMasterPassword(newPassword); err != nil {
+		log.Fatalf("Failed to change master password: %v", err)
+	}
+	fmt.Println("Master password changed. Use the new password from now on.")
+}
+
+// resolveMasterPassword reads the master password from -master-password,
+// -master-password-source or the environment, and asks for it when none
+// of them is set and a terminal is attached.
+func resolveMasterPassword() error {
+	if masterPassword != "" {
+		return nil
+	}
+
+	var err error
+	switch {
+	case masterPasswordSource != "":
+		masterPassword, err = secret.Source(masterPasswordSource).Read("Master password")
+	case os.Getenv(masterPasswordEnv) != "":
+		masterPassword = os.Getenv(masterPasswordEnv)
+	case secret.CanPrompt():
+		masterPassword, err = secret.ReadPrompt("Master password")
+	default:
+		return fmt.Errorf("Master password is required. Use -master-password-source flag or set %s", masterPasswordEnv)
+	}
+	if err != nil {
+		return fmt.Errorf("Failed to read master password: %w", err)
+	}
+	return nil
+}
+
+// configureOptions drops the provider options that were not set on the
+// command line.
+func configureOptions(options map[string]string) map[string]string {
+	for key, value := range options {
+		if value == "" {
+			delete(options, key)
+		}
+	}
+	if len(options) == 0 {
+		return nil
+	}
+	return options
 }
 
 func printUsage() {
+	providers := strings.Join(storage.Providers(), ", ")
+
 	fmt.Println("Usage:")
+	fmt.Println("  backup-service [-master-password-source <source>] [-config <file>] <command> [flags]")
 	fmt.Println("  backup-service create [flags]")
+	fmt.Println("  backup-service create -source /path/to/backup -remote work-gdrive -dest /backups")
+	fmt.Println("  backup-service create -from work-gdrive -source /Team -mirror /srv/mirrors/team -schedule \"0 * * * *\" -recurring")
+	fmt.Println("  backup-service create -from onedrive -source /Documents -remote nas -dest /onedrive -compress")
 	fmt.Println("  backup-service list")
 	fmt.Println("  backup-service configure [flags]")
+	fmt.Println("  backup-service credentials list")
+	fmt.Println("  backup-service credentials show <remote>")
+	fmt.Println("  backup-service credentials remove [-force] <remote>")
+	fmt.Println("  backup-service credentials export -out <file> [-password-source <source>] [remote...]")
+	fmt.Println("  backup-service credentials import -in <file> [-password-source <source>] [-overwrite]")
+	fmt.Println("  backup-service credentials test [remote...]")
+	fmt.Println("  backup-service snapshots list [-task <task>]")
+	fmt.Println("  backup-service snapshots show [-task <task>] <snapshot-id>")
+	fmt.Println("  backup-service snapshots restore [-task <task>] -target <dir> <snapshot-id>")
+	fmt.Println("  backup-service prune [-task <task>] [-dry-run]")
+	fmt.Println("  backup-service change-master-password [flags]")
+	fmt.Println("  backup-service -config <file> validate")
+	fmt.Println("  backup-service -config <file> apply [-dry-run]")
+	fmt.Println("\nSecret sources, for the master password and encryption keys:")
+	fmt.Println("  env:NAME    Environment variable NAME")
+	fmt.Println("  file:PATH   Contents of the file at PATH")
+	fmt.Println("  fd:N        Everything read from file descriptor N")
+	fmt.Println("  cmd:COMMAND Output of a helper command, e.g. cmd:pass show backup")
+	fmt.Println("  prompt      Ask on the terminal without echo")
+	fmt.Println("Encryption keys are read again on every run, so fd: and prompt only work for the master password.")
+	fmt.Printf("Without -master-password-source the master password is read from %s, or asked for on a terminal.\n", masterPasswordEnv)
+	fmt.Printf("Without -config the config file is read from %s, if set. validate checks it and apply\n", config.EnvConfigFile)
+	fmt.Println("stores its remotes and creates, updates or deletes the tasks it declares.")
+	fmt.Println("Every run stores a snapshot listing the files it backed up, with their hashes, in the")
+	fmt.Println("snapshots folder of its destination; snapshots list and show read them from the remote.")
+	fmt.Println("Restoring a snapshot of an incremental or differential task unpacks the archives of its")
+	fmt.Println("chain, from the full backup it builds on, and removes the files deleted in between.")
+	fmt.Println("A task's retention policy decides which snapshots are kept: a snapshot is kept when any")
+	fmt.Println("rule keeps it, along with the snapshots it builds on. Every run applies the policy; prune")
+	fmt.Println("applies it on demand and with -dry-run only shows what it would delete. Pruning a")
+	fmt.Println("repository task also removes the repository data no remaining snapshot references;")
+	fmt.Println("-dry-run shows how much it would free.")
 	fmt.Println("\nCreate flags:")
 	fmt.Println("  -source    Source path to backup")
-	fmt.Println("  -provider  Cloud provider (gdrive or onedrive)")
+	fmt.Printf("  -provider  Storage provider (%s)\n", providers)
+	fmt.Println("  -remote    Configured remote to back up to; its provider is used")
 	fmt.Println("  -dest      Destination path in cloud storage")
+	fmt.Println("  -repository Store runs deduplicated in a repository at -dest: files are cut into chunks")
+	fmt.Println("             and only chunks no earlier run stored are uploaded; -encrypt encrypts it")
+	fmt.Println("  -name-template Name of each run's archive below -dest (default: the archive name, replaced")
+	fmt.Println("             by every run, so only the latest snapshot can be restored). Placeholders:")
+	fmt.Println("             {task}, {id}, {host}, {source}, {ext} for the extensions added by -encrypt and")
+	fmt.Println("             -compress, {date} and {date:LAYOUT} with a Go time layout, e.g.")
+	fmt.Println("             {task}/{date:2006-01-02T150405}-{host}.tar.gz")
+	fmt.Println("  -mode      Backup mode (default: full). incremental archives the files changed since the")
+	fmt.Println("             previous run, differential those changed since the last full backup; both")
+	fmt.Println("             need -compress and name archives {source}-{date}{ext} without -name-template")
+	fmt.Println("  -full-every Make a full backup every N runs of an incremental or differential task")
+	fmt.Println("  -keep-last Keep the latest N snapshots")
+	fmt.Println("  -keep-hourly, -keep-daily, -keep-weekly, -keep-monthly, -keep-yearly")
+	fmt.Println("             Keep the latest snapshot of each of the last N hours, days, weeks, months or years")
+	fmt.Println("  -keep-within Keep every snapshot younger than the duration, e.g. 30d (default: keep all")
+	fmt.Println("             snapshots when no retention flag is given)")
 	fmt.Println("  -schedule  Backup schedule in cron format (optional)")
 	fmt.Println("  -recurring Enable recurring backup")
 	fmt.Println("  -compress  Enable compression (default: true)")
 	fmt.Println("  -encrypt   Enable encryption")
-	fmt.Println("  -key       Encryption key (required if encrypt is true)")
+	fmt.Println("  -key       Encryption key (stored in the task file, prefer -key-source)")
+	fmt.Println("  -key-source Where to read the encryption key on every run: env:, file: or cmd:")
 	fmt.Println("  -single    Single file backup")
 	fmt.Println("  -sync      Enable folder synchronization")
+	fmt.Println("  -from      Cloud remote to back up from; -source is then a folder on it")
+	fmt.Println("  -mirror    Local folder to keep the copy of a -from folder in; files deleted in the")
+	fmt.Println("             cloud are moved to its .deleted folder instead of being removed, and that")
+	fmt.Println("             folder is left out of the backups uploaded to -remote")
+	fmt.Println("  -keep-deleted How long files deleted in the cloud are kept (default: 30d, 0 keeps them forever)")
 	fmt.Println("\nConfigure flags:")
-	fmt.Println("  -provider  Provider to configure (gdrive or onedrive)")
+	fmt.Printf("  -provider  Provider to configure (%s)\n", providers)
+	fmt.Println("  -name      Name of the remote, to configure several accounts of a provider (default: the provider)")
 	fmt.Println("  -client-id OAuth client ID")
 	fmt.Println("  -client-secret OAuth client secret")
-	fmt.Println("  -redirect-url OAuth redirect URL (default: http://localhost:8080/callback)")
+	fmt.Println("  -redirect-url OAuth redirect URL; browser login listens on its port (default: http://localhost:8080/callback)")
+	fmt.Println("  -tenant    Microsoft tenant for onedrive (default: common)")
+	fmt.Println("  -root      Root directory for the local and sftp providers")
+	fmt.Println("  -access-key S3 access key ID")
+	fmt.Println("  -secret-key S3 secret access key")
+	fmt.Println("  -endpoint  S3 endpoint URL (default: AWS for the region)")
+	fmt.Println("  -region    S3 region (default: us-east-1)")
+	fmt.Println("  -bucket    S3 bucket")
+	fmt.Println("  -prefix    S3 key prefix for all backups")
+	fmt.Println("  -part-size S3 multipart part size in MB (default: 16)")
+	fmt.Println("  -chunk-size Google Drive resumable upload chunk size in MB (default: 8)")
+	fmt.Println("  -export-format Format Google Docs, Sheets and Slides are backed up in: office or pdf (default: office)")
+	fmt.Println("  -shared-drive Name or ID of the Google Shared Drive to store backups in (default: My Drive)")
+	fmt.Println("  -login     OAuth login mode for gdrive and onedrive: browser, device or manual (default: browser)")
+	fmt.Println("             Google only lets device login reach the files it uploads, so such a gdrive")
+	fmt.Println("             remote cannot be used with -from")
+	fmt.Println("  -host      SFTP host")
+	fmt.Println("  -port      SFTP port (default: 22)")
+	fmt.Println("  -user      SFTP or WebDAV user")
+	fmt.Println("  -password  SFTP or WebDAV password, or SFTP private key passphrase")
+	fmt.Println("  -key-file  SFTP private key file, stored encrypted with the credentials")
+	fmt.Println("  -known-hosts SFTP known_hosts file (default: ~/.ssh/known_hosts)")
+	fmt.Println("  -url       WebDAV URL, e.g. https://cloud.example.com/remote.php/dav/files/<user>/")
+	fmt.Println("\nChange master password flags:")
+	fmt.Println("  -new-password New master password; the credentials are re-encrypted with it")
+	fmt.Println("  -new-password-source Where to read the new master password (default: ask twice)")
 	fmt.Println("\nExamples:")
 	fmt.Println("  backup-service create -source /path/to/backup -provider gdrive -dest /backups")
 	fmt.Println("  backup-service create -source /path/to/backup -provider gdrive -dest /backups -schedule \"0 0 * * *\" -recurring")
+	fmt.Println("  backup-service create -source /path/to/backup -remote work-gdrive -dest /backups")
+	fmt.Println("  backup-service create -source /srv/data -remote nas -dest /data -compress -mode incremental -full-every 7 -schedule \"0 2 * * *\" -recurring")
+	fmt.Println("  backup-service create -source /srv/data -remote work-gdrive -dest /data -compress -name-template \"{date}.tar.gz\" -keep-daily 7 -keep-weekly 4 -keep-monthly 12")
+	fmt.Println("  backup-service prune -dry-run")
 	fmt.Println("  backup-service list")
 	fmt.Println("  backup-service configure -provider gdrive -client-id <client-id> -client-secret <client-secret>")
+	fmt.Println("  backup-service configure -provider gdrive -client-id <client-id> -client-secret <client-secret> -login device")
+	fmt.Println("  backup-service configure -provider gdrive -name work-gdrive -client-id <client-id> -client-secret <client-secret>")
+	fmt.Println("  backup-service configure -provider gdrive -name team-gdrive -client-id <client-id> -client-secret <client-secret> -shared-drive Backups")
+	fmt.Println("  backup-service configure -provider onedrive -client-id <application-id> -redirect-url http://localhost:53682/callback")
+	fmt.Println("  backup-service configure -provider local -root /mnt/nas/backups")
+	fmt.Println("  backup-service configure -provider s3 -endpoint http://minio:9000 -bucket backups -access-key <key> -secret-key <secret>")
+	fmt.Println("  backup-service configure -provider sftp -host backup.example.com -user backup -key-file ~/.ssh/id_ed25519 -root /srv/backups")
+	fmt.Println("  backup-service configure -provider webdav -url https://cloud.example.com/remote.php/dav/files/alice/ -user alice -password <app-password>")
+	fmt.Println("  backup-service -master-password-source file:/etc/backup/master create -source /srv/data -dest /backups -encrypt -key-source env:BACKUP_KEY")
+	fmt.Println("  backup-service credentials export -out backup-remotes.enc work-gdrive")
+	fmt.Println("  backup-service credentials test")
+	fmt.Println("  backup-service change-master-password")
+	fmt.Println("  backup-service -config backup.yaml apply -dry-run")
+}
+
+// retentionSummary describes the rules of a retention policy.
+func retentionSummary(p *backup.RetentionPolicy) string {
+	var rules []string
+	for _, rule := range []struct {
+		name  string
+		count int
+	}{
+		{"last", p.KeepLast},
+		{"hourly", p.KeepHourly},
+		{"daily", p.KeepDaily},
+		{"weekly", p.KeepWeekly},
+		{"monthly", p.KeepMonthly},
+		{"yearly", p.KeepYearly},
+	} {
+		if rule.count > 0 {
+			rules = append(rules, fmt.Sprintf("%s %d", rule.name, rule.count))
+		}
+	}
+	if p.KeepWithin != "" {
+		rules = append(rules, "within "+p.KeepWithin)
+	}
+	return strings.Join(rules, ", ")
 }
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"github.com/amankumarsingh77/automated_backup_tool/internal/core/backup"
+	"github.com/amankumarsingh77/automated_backup_tool/internal/storage/oauthutil"
+)
+
+func handlePrune(args []string) {
+	pruneCmd := flag.NewFlagSet("prune", flag.ExitOnError)
+	task := pruneCmd.String("task", "", "ID or name of the task to prune (default: every task with a retention policy)")
+	dryRun := pruneCmd.Bool("dry-run", false, "Show which snapshots would be deleted without deleting them")
+	pruneCmd.Parse(args)
+
+	ctx, cancel := context.WithTimeout(oauthutil.WithoutLogin(context.Background()), snapshotTimeout)
+	defer cancel()
+
+	pruned := false
+	for _, t := range snapshotTasks(*task) {
+		if t.Retention.IsZero() {
+			if *task != "" {
+				fmt.Printf("Task %s has no retention policy, all its snapshots are kept\n", taskLabel(t))
+			}
+			continue
+		}
+		result, err := t.Prune(ctx, *dryRun)
+		if err != nil {
+			log.Fatalf("Failed to prune task %s: %v", taskLabel(t), err)
+		}
+		printPrune(t, result, *dryRun)
+		pruned = true
+	}
+	if !pruned && *task == "" {
+		fmt.Println("No task has a retention policy")
+	}
+}
+
+func printPrune(task backup.BackupTask, result backup.PruneResult, dryRun bool) {
+	action, freed := "removed", "Freed"
+	if dryRun {
+		action, freed = "would remove", "Would free"
+	}
+	remove := result.Remove
+	fmt.Printf("Task %s: keeping %d snapshots, %s %d\n", taskLabel(task), len(result.Keep), action, len(remove))
+	if stats := result.Repository; stats.Blobs > 0 {
+		fmt.Printf("%s %s of repository data, deleting %d and rewriting %d packs\n", freed, formatSize(stats.Bytes), stats.Deleted, stats.Repacked)
+	}
+	if len(remove) == 0 {
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tTIME\tFILES\tSIZE\tDATA")
+	for _, s := range remove {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\n", s.ShortID(), s.Started.Local().Format("2006-01-02 15:04:05"),
+			len(s.Files), formatSize(s.Size()), orDash(s.Data))
+	}
+	w.Flush()
+}
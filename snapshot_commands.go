@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/amankumarsingh77/automated_backup_tool/internal/core/backup"
+	"github.com/amankumarsingh77/automated_backup_tool/internal/core/snapshot"
+	"github.com/amankumarsingh77/automated_backup_tool/internal/storage/oauthutil"
+)
+
+// snapshotTimeout bounds how long reading the snapshots of a remote takes.
+// Like backup runs, the snapshot commands never start a login; configure
+// does that.
+const snapshotTimeout = 10 * time.Minute
+
+func handleSnapshots(args []string) {
+	if len(args) < 1 {
+		printUsage()
+		os.Exit(1)
+	}
+
+	switch args[0] {
+	case "list":
+		listCmd := flag.NewFlagSet("snapshots list", flag.ExitOnError)
+		task := listCmd.String("task", "", "ID or name of the task to list snapshots of (default: all tasks)")
+		listCmd.Parse(args[1:])
+		handleSnapshotsList(*task)
+	case "show":
+		showCmd := flag.NewFlagSet("snapshots show", flag.ExitOnError)
+		task := showCmd.String("task", "", "ID or name of the task the snapshot belongs to (default: search all tasks)")
+		showCmd.Parse(args[1:])
+		if showCmd.NArg() != 1 {
+			log.Fatal("Usage: snapshots show [-task <task>] <snapshot-id>")
+		}
+		handleSnapshotsShow(*task, showCmd.Arg(0))
+	case "restore":
+		restoreCmd := flag.NewFlagSet("snapshots restore", flag.ExitOnError)
+		task := restoreCmd.String("task", "", "ID or name of the task the snapshot belongs to (default: search all tasks)")
+		target := restoreCmd.String("target", "", "Directory to restore the files into")
+		restoreCmd.Parse(args[1:])
+		if restoreCmd.NArg() != 1 || *target == "" {
+			log.Fatal("Usage: snapshots restore [-task <task>] -target <dir> <snapshot-id>")
+		}
+		handleSnapshotsRestore(*task, *target, restoreCmd.Arg(0))
+	default:
+		printUsage()
+		os.Exit(1)
+	}
+}
+
+// snapshotTasks returns the task named by idOrName, or every task that
+// uploads to a remote when it is empty.
+func snapshotTasks(idOrName string) []backup.BackupTask {
+	if idOrName != "" {
+		task, err := backup.FindTask(idOrName)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return []backup.BackupTask{*task}
+	}
+
+	tasks, err := backup.ListTasks()
+	if err != nil {
+		log.Fatalf("Failed to list tasks: %v", err)
+	}
+	var uploading []backup.BackupTask
+	for _, task := range tasks {
+		if task.RemoteName() != "" && !task.IsSync {
+			uploading = append(uploading, task)
+		}
+	}
+	return uploading
+}
+
+func handleSnapshotsList(idOrName string) {
+	ctx, cancel := context.WithTimeout(oauthutil.WithoutLogin(context.Background()), snapshotTimeout)
+	defer cancel()
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tTASK\tHOST\tTIME\tFILES\tSIZE\tSOURCE")
+	found := false
+	for _, task := range snapshotTasks(idOrName) {
+		snapshots, err := task.Snapshots(ctx)
+		if err != nil {
+			log.Fatalf("Failed to list snapshots of task %s: %v", task.ID, err)
+		}
+		for _, s := range snapshots {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\t%s\n", s.ShortID(), taskLabel(task), s.Host,
+				s.Started.Local().Format("2006-01-02 15:04:05"), len(s.Files), formatSize(s.Size()), orDash(s.Source))
+			found = true
+		}
+	}
+	if !found {
+		fmt.Println("No snapshots found")
+		return
+	}
+	w.Flush()
+}
+
+// findSnapshot returns the snapshot whose ID starts with id, searching the
+// task named by idOrName or every task, along with its task and the
+// snapshots of that task.
+func findSnapshot(ctx context.Context, idOrName, id string) (backup.BackupTask, *snapshot.Snapshot, []*snapshot.Snapshot) {
+	var tasks []backup.BackupTask
+	var matches []*snapshot.Snapshot
+	var lists [][]*snapshot.Snapshot
+	for _, task := range snapshotTasks(idOrName) {
+		snapshots, err := task.Snapshots(ctx)
+		if err != nil {
+			log.Fatalf("Failed to list snapshots of task %s: %v", task.ID, err)
+		}
+		if s, err := snapshot.Find(snapshots, id); err == nil {
+			tasks = append(tasks, task)
+			matches = append(matches, s)
+			lists = append(lists, snapshots)
+		} else if idOrName != "" {
+			log.Fatal(err)
+		}
+	}
+	if len(matches) == 0 {
+		log.Fatalf("Snapshot %s not found", id)
+	}
+	if len(matches) > 1 {
+		log.Fatalf("Snapshot ID %s is ambiguous, give more characters or -task", id)
+	}
+	return tasks[0], matches[0], lists[0]
+}
+
+func handleSnapshotsShow(idOrName, id string) {
+	ctx, cancel := context.WithTimeout(oauthutil.WithoutLogin(context.Background()), snapshotTimeout)
+	defer cancel()
+
+	_, s, snapshots := findSnapshot(ctx, idOrName, id)
+
+	fmt.Printf("ID: %s\n", s.ID)
+	fmt.Printf("Task: %s\n", s.TaskID)
+	if s.TaskName != "" {
+		fmt.Printf("Task name: %s\n", s.TaskName)
+	}
+	fmt.Printf("Host: %s\n", s.Host)
+	fmt.Printf("Source: %s\n", s.Source)
+	fmt.Printf("Started: %s\n", s.Started.Local().Format(time.RFC3339))
+	fmt.Printf("Finished: %s\n", s.Finished.Local().Format(time.RFC3339))
+	if by := snapshot.ReplacedBy(snapshots, s); by != nil {
+		fmt.Printf("Data: %s, replaced by snapshot %s and no longer restorable\n", s.Data, by.ShortID())
+	} else if s.Data != "" {
+		fmt.Printf("Data: %s\n", s.Data)
+	}
+	if s.Tree != "" {
+		fmt.Printf("Tree: %s\n", s.Tree)
+	}
+	if len(s.Sealed) > 0 {
+		fmt.Println("The rest of the snapshot is encrypted and the key of the task is unknown")
+		return
+	}
+	if s.Mode != "" {
+		fmt.Printf("Mode: %s\n", s.Mode)
+	}
+	if s.Parent != "" {
+		fmt.Printf("Parent: %s\n", s.Parent)
+	}
+	if len(s.Deleted) > 0 {
+		fmt.Printf("Deleted since parent: %d\n", len(s.Deleted))
+	}
+	fmt.Printf("Files: %d, %s\n\n", len(s.Files), formatSize(s.Size()))
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "MODE\tSIZE\tMODIFIED\tSHA256\tPATH")
+	for _, file := range s.Files {
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\n", file.Mode, file.Size,
+			file.ModTime.Local().Format("2006-01-02 15:04:05"), orDash(file.SHA256), file.Path)
+	}
+	w.Flush()
+}
+
+func handleSnapshotsRestore(idOrName, target, id string) {
+	ctx, cancel := context.WithTimeout(oauthutil.WithoutLogin(context.Background()), snapshotTimeout)
+	defer cancel()
+	task, s, _ := findSnapshot(ctx, idOrName, id)
+
+	// Restoring a large backup can take hours.
+	if err := task.Restore(oauthutil.WithoutLogin(context.Background()), s, target); err != nil {
+		log.Fatalf("Failed to restore snapshot %s: %v", s.ShortID(), err)
+	}
+	fmt.Printf("Restored snapshot %s to %s\n", s.ShortID(), target)
+}
+
+// taskLabel names a task by its name, or its ID when it has none.
+func taskLabel(task backup.BackupTask) string {
+	if task.Name != "" {
+		return task.Name
+	}
+	return task.ID
+}
+
+// formatSize prints a byte count with a binary unit.
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}